@@ -1,7 +1,15 @@
 package config
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/Azure/webhook-tls-manager/consts"
 	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
+	"github.com/Azure/webhook-tls-manager/toolkit/retrypolicy"
 )
 
 type Config struct {
@@ -9,16 +17,105 @@ type Config struct {
 	CaValidityYears     int
 	ServerValidityYears int
 	Namespace           string
+	RetryMaxAttempts    int
+	RetryDeadline       time.Duration
+	// CleanupForce deletes objects not managed on cleanup.
+	CleanupForce bool
+	// CleanupConfigMap also deletes the ConfigMap holding the webhook configuration on cleanup.
+	CleanupConfigMap bool
+	// Adopt takes over a secret or webhook that exists without the managed label.
+	Adopt bool
+	// OrphanPolicy is what a reconcile does with the objects of instances no longer configured.
+	OrphanPolicy OrphanPolicy
+	// ExtraLabels and ExtraAnnotations are added to the secret and the webhook.
+	ExtraLabels      map[string]string
+	ExtraAnnotations map[string]string
+	// Profile marks the objects as managed. Defaults to the aks profile.
+	Profile Profile
+	// ExcludedNamespaces and ExcludedObjectLabels are excluded from every webhook through its
+	// namespaceSelector and objectSelector.
+	ExcludedNamespaces   []string
+	ExcludedObjectLabels map[string]string
+	// IncludeWebhookNamespace stops excluding the namespace of the webhook service.
+	IncludeWebhookNamespace bool
+	// ForceConflicts takes over the fields of the secret and webhook the job applies when another
+	// field manager owns them, instead of failing.
+	ForceConflicts bool
+	// CABundleFlipThreshold is the number of consecutive runs finding the caBundle of the webhook
+	// changed by another field manager after which the job stops writing it. 0 never stops.
+	CABundleFlipThreshold int
+	// VerifyEndpoints verifies the certificates served by the endpoints of the webhook after a
+	// reconcile.
+	VerifyEndpoints bool
+	// BreakerThreshold is how long a webhook with failurePolicy Fail may have no ready endpoints
+	// or serve an untrusted certificate before the breaker applies BreakerAction to it. 0 disables
+	// the breaker, which only runs in controller mode.
+	BreakerThreshold time.Duration
+	BreakerAction    BreakerAction
+	// ReadinessTimeout is how long the job waits for the services of the webhooks to have ready
+	// endpoints before creating the webhook configuration. 0 does not wait.
+	ReadinessTimeout time.Duration
+	// DisableMode is how the disable command takes the managed webhooks out of the request path.
+	DisableMode DisableMode
 }
 
+// OrphanPolicy is what a reconcile does with orphaned objects: secrets and webhooks labelled
+// by another instance in the namespace whose ConfigMap no longer exists.
+type OrphanPolicy string
+
+const (
+	OrphanPolicyIgnore OrphanPolicy = "ignore"
+	OrphanPolicyReport OrphanPolicy = "report"
+	OrphanPolicyDelete OrphanPolicy = "delete"
+)
+
+func ParseOrphanPolicy(s string) (OrphanPolicy, error) {
+	switch policy := OrphanPolicy(s); policy {
+	case OrphanPolicyIgnore, OrphanPolicyReport, OrphanPolicyDelete:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown orphan policy %q. expected ignore, report or delete", s)
+}
+
+// BreakerAction is what the breaker does with a webhook whose backend stays unhealthy.
+type BreakerAction string
+
+const (
+	// BreakerActionIgnore switches the failurePolicy of the webhook to Ignore.
+	BreakerActionIgnore BreakerAction = "ignore"
+	// BreakerActionRemove removes the webhook from the configuration.
+	BreakerActionRemove BreakerAction = "remove"
+)
+
+// DisableMode is how the disable command takes a managed webhook configuration out of the
+// request path.
+type DisableMode string
+
+const (
+	// DisableModeIgnore switches the failurePolicy of every webhook to Ignore.
+	DisableModeIgnore DisableMode = "ignore"
+	// DisableModeDetach removes every webhook from the configuration.
+	DisableModeDetach DisableMode = "detach"
+)
+
+// DefaultCABundleFlipThreshold is the default of Config.CABundleFlipThreshold.
+const DefaultCABundleFlipThreshold = 3
+
 var AppConfig Config
 
 func NewConfig() {
 	AppConfig = Config{
-		ObjectName:          "webhook-tls-manager",
-		CaValidityYears:     certificates.CaValidityYears,
-		ServerValidityYears: certificates.ServerValidityYears,
-		Namespace:           "kube-system",
+		ObjectName:            "webhook-tls-manager",
+		CaValidityYears:       certificates.CaValidityYears,
+		ServerValidityYears:   certificates.ServerValidityYears,
+		Namespace:             "kube-system",
+		RetryMaxAttempts:      retrypolicy.DefaultMaxAttempts,
+		RetryDeadline:         retrypolicy.DefaultDeadline,
+		OrphanPolicy:          OrphanPolicyIgnore,
+		Profile:               aksProfile(),
+		CABundleFlipThreshold: DefaultCABundleFlipThreshold,
+		BreakerAction:         BreakerActionIgnore,
+		DisableMode:           DisableModeIgnore,
 	}
 }
 
@@ -37,12 +134,172 @@ func UpdateConfig(objectName string, caValidityYears int, serverValidityYears in
 	}
 }
 
+func UpdateRetryConfig(maxAttempts int, deadline time.Duration) error {
+	if maxAttempts < 1 {
+		return fmt.Errorf("invalid retry max attempts %d. expected 1 or more", maxAttempts)
+	}
+	if deadline <= 0 {
+		return fmt.Errorf("invalid retry deadline %s. expected more than 0", deadline)
+	}
+	AppConfig.RetryMaxAttempts = maxAttempts
+	AppConfig.RetryDeadline = deadline
+	return nil
+}
+
+func UpdateCleanupConfig(force bool, deleteConfigMap bool) {
+	AppConfig.CleanupForce = force
+	AppConfig.CleanupConfigMap = deleteConfigMap
+}
+
+func UpdateAdoptConfig(adopt bool) {
+	AppConfig.Adopt = adopt
+}
+
+func UpdateApplyConfig(forceConflicts bool) {
+	AppConfig.ForceConflicts = forceConflicts
+}
+
+func UpdateDriftConfig(caBundleFlipThreshold int) error {
+	if caBundleFlipThreshold < 0 {
+		return fmt.Errorf("invalid caBundle flip threshold %d. expected 0 or more", caBundleFlipThreshold)
+	}
+	AppConfig.CABundleFlipThreshold = caBundleFlipThreshold
+	return nil
+}
+
+func UpdateVerifyConfig(verifyEndpoints bool) {
+	AppConfig.VerifyEndpoints = verifyEndpoints
+}
+
+func UpdateBreakerConfig(threshold time.Duration, action string) error {
+	if threshold < 0 {
+		return fmt.Errorf("invalid breaker threshold %s. expected 0 or more", threshold)
+	}
+	switch breakerAction := BreakerAction(action); breakerAction {
+	case BreakerActionIgnore, BreakerActionRemove:
+		AppConfig.BreakerAction = breakerAction
+	default:
+		return fmt.Errorf("unknown breaker action %q. expected ignore or remove", action)
+	}
+	AppConfig.BreakerThreshold = threshold
+	return nil
+}
+
+func UpdateReadinessConfig(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("invalid readiness timeout %s. expected 0 or more", timeout)
+	}
+	AppConfig.ReadinessTimeout = timeout
+	return nil
+}
+
+func UpdateDisableConfig(mode string) error {
+	switch disableMode := DisableMode(mode); disableMode {
+	case DisableModeIgnore, DisableModeDetach:
+		AppConfig.DisableMode = disableMode
+	default:
+		return fmt.Errorf("unknown disable mode %q. expected ignore or detach", mode)
+	}
+	return nil
+}
+
+func UpdateOrphanConfig(policy OrphanPolicy) {
+	AppConfig.OrphanPolicy = policy
+}
+
+// UpdateMetadataConfig sets the extra labels and annotations. Keys the tool sets itself are
+// refused, so an extra label cannot unmark an object as managed.
+func UpdateMetadataConfig(labels map[string]string, annotations map[string]string) error {
+	for k, v := range labels {
+		if err := validateMetadataKey(k); err != nil {
+			return fmt.Errorf("invalid extra label %s: %w", k, err)
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("invalid extra label %s: %s", k, strings.Join(errs, "; "))
+		}
+	}
+	for k := range annotations {
+		if err := validateMetadataKey(k); err != nil {
+			return fmt.Errorf("invalid extra annotation %s: %w", k, err)
+		}
+	}
+	AppConfig.ExtraLabels = labels
+	AppConfig.ExtraAnnotations = annotations
+	return nil
+}
+
+// UpdateExclusionConfig sets the namespaces and object labels excluded from the webhooks.
+func UpdateExclusionConfig(namespaces []string, objectLabels map[string]string, includeWebhookNamespace bool) error {
+	for _, namespace := range namespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("invalid excluded namespace %s: %s", namespace, strings.Join(errs, "; "))
+		}
+	}
+	for k, v := range objectLabels {
+		if errs := append(validation.IsQualifiedName(k), validation.IsValidLabelValue(v)...); len(errs) > 0 {
+			return fmt.Errorf("invalid excluded object label %s=%s: %s", k, v, strings.Join(errs, "; "))
+		}
+	}
+	AppConfig.ExcludedNamespaces = namespaces
+	AppConfig.ExcludedObjectLabels = objectLabels
+	AppConfig.IncludeWebhookNamespace = includeWebhookNamespace
+	return nil
+}
+
+func validateMetadataKey(key string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	if key == AppConfig.Profile.ManagedLabelKey || key == consts.AdmissionEnforcerDisabledLabel || strings.HasPrefix(key, consts.MetadataPrefix) {
+		return fmt.Errorf("the key is set by webhook-tls-manager")
+	}
+	return nil
+}
+
+const (
+	secretNameSuffix        = "-tls-certs"
+	webhookConfigNameSuffix = "-webhook-config"
+)
+
 func SecretName() string {
-	return AppConfig.ObjectName + "-tls-certs"
+	return AppConfig.ObjectName + secretNameSuffix
 }
 
 func WebhookConfigName() string {
-	return AppConfig.ObjectName + "-webhook-config"
+	return AppConfig.ObjectName + webhookConfigNameSuffix
+}
+
+// SecretInstance returns the managed object name of the instance whose secret is named name, and
+// false if name is not the name of a secret of any instance.
+func SecretInstance(name string) (string, bool) {
+	instance, ok := strings.CutSuffix(name, secretNameSuffix)
+	return instance, ok && instance != ""
+}
+
+// WebhookConfigInstance returns the managed object name of the instance whose mutating webhook
+// configuration is named name, and false if name is not the name of one of any instance.
+func WebhookConfigInstance(name string) (string, bool) {
+	instance, ok := strings.CutSuffix(name, webhookConfigNameSuffix)
+	return instance, ok && instance != ""
+}
+
+func ConfigMapName() string {
+	return InstanceConfigMapName(AppConfig.ObjectName)
+}
+
+// InstanceConfigMapName returns the name of the ConfigMap declaring the instance with the given
+// managed object name.
+func InstanceConfigMapName(instance string) string {
+	return instance + webhookConfigNameSuffix
+}
+
+// InstanceLabels returns the labels identifying the objects of this instance, so the objects a
+// renamed instance left behind can be told apart from those of the other instances.
+func InstanceLabels() map[string]string {
+	return map[string]string{
+		consts.InstanceLabelKey:       AppConfig.ObjectName,
+		consts.OwnerNamespaceLabelKey: AppConfig.Namespace,
+	}
 }
 
 func ServiceName() string {
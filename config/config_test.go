@@ -1,7 +1,9 @@
 package config
 
 import (
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestConfig(t *testing.T) {
@@ -25,6 +27,207 @@ func TestConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("UpdateRetryConfig", func(t *testing.T) {
+		NewConfig()
+		if AppConfig.RetryMaxAttempts != 10 || AppConfig.RetryDeadline != time.Minute {
+			t.Errorf("expected defaults, got %d and %s", AppConfig.RetryMaxAttempts, AppConfig.RetryDeadline)
+		}
+		for _, maxAttempts := range []int{0, -1} {
+			if err := UpdateRetryConfig(maxAttempts, time.Minute); err == nil {
+				t.Errorf("expected an error for %d retry max attempts", maxAttempts)
+			}
+		}
+		if err := UpdateRetryConfig(3, 0); err == nil {
+			t.Errorf("expected an error for a retry deadline of 0")
+		}
+		if AppConfig.RetryMaxAttempts != 10 || AppConfig.RetryDeadline != time.Minute {
+			t.Errorf("expected rejected values to keep the defaults, got %d and %s", AppConfig.RetryMaxAttempts, AppConfig.RetryDeadline)
+		}
+		if err := UpdateRetryConfig(3, 30*time.Second); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if AppConfig.RetryMaxAttempts != 3 {
+			t.Errorf("expected 3, got %d", AppConfig.RetryMaxAttempts)
+		}
+		if AppConfig.RetryDeadline != 30*time.Second {
+			t.Errorf("expected 30s, got %s", AppConfig.RetryDeadline)
+		}
+	})
+
+	t.Run("UpdateCleanupConfig", func(t *testing.T) {
+		NewConfig()
+		if AppConfig.CleanupForce || AppConfig.CleanupConfigMap {
+			t.Errorf("expected cleanup to keep unmanaged objects and the configmap by default")
+		}
+		UpdateCleanupConfig(true, true)
+		if !AppConfig.CleanupForce || !AppConfig.CleanupConfigMap {
+			t.Errorf("expected cleanup to be forced and to delete the configmap")
+		}
+	})
+
+	t.Run("UpdateAdoptConfig", func(t *testing.T) {
+		NewConfig()
+		if AppConfig.Adopt {
+			t.Errorf("expected adoption to be off by default")
+		}
+		UpdateAdoptConfig(true)
+		if !AppConfig.Adopt {
+			t.Errorf("expected adoption to be on")
+		}
+	})
+
+	t.Run("ParseOrphanPolicy", func(t *testing.T) {
+		NewConfig()
+		if AppConfig.OrphanPolicy != OrphanPolicyIgnore {
+			t.Errorf("expected orphan policy %s by default, got %s", OrphanPolicyIgnore, AppConfig.OrphanPolicy)
+		}
+		for _, s := range []string{"ignore", "report", "delete"} {
+			policy, err := ParseOrphanPolicy(s)
+			if err != nil || string(policy) != s {
+				t.Errorf("expected orphan policy %s, got %s, error: %v", s, policy, err)
+			}
+		}
+		if _, err := ParseOrphanPolicy("keep"); err == nil {
+			t.Errorf("expected an error for an unknown orphan policy")
+		}
+	})
+
+	t.Run("UpdateMetadataConfig", func(t *testing.T) {
+		NewConfig()
+		labels := map[string]string{"app.kubernetes.io/part-of": "vpa"}
+		annotations := map[string]string{"backup.example.com/exclude": "true, with a comma"}
+		if err := UpdateMetadataConfig(labels, annotations); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(AppConfig.ExtraLabels, labels) || !reflect.DeepEqual(AppConfig.ExtraAnnotations, annotations) {
+			t.Errorf("expected %v and %v, got %v and %v", labels, annotations, AppConfig.ExtraLabels, AppConfig.ExtraAnnotations)
+		}
+		for _, invalid := range []struct {
+			labels      map[string]string
+			annotations map[string]string
+		}{
+			{labels: map[string]string{"team": "not a label value"}},
+			{labels: map[string]string{"-team": "autoscaling"}},
+			{labels: map[string]string{"app.kubernetes.io/managed-by": "helm"}},
+			{annotations: map[string]string{"webhook-tls-manager.azure.com/rotation-phase": "complete"}},
+		} {
+			if err := UpdateMetadataConfig(invalid.labels, invalid.annotations); err == nil {
+				t.Errorf("expected an error for %v and %v", invalid.labels, invalid.annotations)
+			}
+		}
+	})
+
+	t.Run("UpdateProfileConfig", func(t *testing.T) {
+		NewConfig()
+		if AppConfig.Profile.Name != ProfileAKS || !AppConfig.Profile.AdmissionEnforcerLabel {
+			t.Errorf("expected the aks profile by default, got %v", AppConfig.Profile)
+		}
+		if !IsManaged(map[string]string{"app.kubernetes.io/managed-by": "aks"}) {
+			t.Errorf("expected the aks profile to manage objects labelled managed-by aks")
+		}
+
+		if err := UpdateProfileConfig(ProfileGeneric, "", "", []string{"aks"}, false); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		expected := map[string]string{"app.kubernetes.io/managed-by": "webhook-tls-manager"}
+		if !reflect.DeepEqual(ManagedLabels(), expected) || AppConfig.Profile.AdmissionEnforcerLabel {
+			t.Errorf("expected %v without the admissions enforcer label, got %v", expected, AppConfig.Profile)
+		}
+		for value, managed := range map[string]bool{"webhook-tls-manager": true, "aks": true, "helm": false} {
+			if IsManaged(map[string]string{"app.kubernetes.io/managed-by": value}) != managed {
+				t.Errorf("expected IsManaged to be %t for managed-by %s", managed, value)
+			}
+		}
+
+		if err := UpdateProfileConfig(ProfileCustom, "example.com/owner", "platform", nil, true); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !IsManaged(map[string]string{"example.com/owner": "platform"}) || IsManaged(map[string]string{"app.kubernetes.io/managed-by": "aks"}) {
+			t.Errorf("expected the custom profile to manage objects labelled example.com/owner platform only")
+		}
+
+		for _, invalid := range []struct {
+			name, key, value string
+		}{
+			{name: "azure"},
+			{name: ProfileCustom, key: "example.com/owner"},
+			{name: ProfileCustom, key: "example.com/owner", value: "not a label value"},
+			{name: ProfileAKS, key: "example.com/owner", value: "platform"},
+		} {
+			if err := UpdateProfileConfig(invalid.name, invalid.key, invalid.value, nil, false); err == nil {
+				t.Errorf("expected an error for %v", invalid)
+			}
+		}
+	})
+
+	t.Run("UpdateExclusionConfig", func(t *testing.T) {
+		NewConfig()
+		if err := UpdateExclusionConfig([]string{"monitoring"}, map[string]string{"example.com/skip": "true"}, true); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(AppConfig.ExcludedNamespaces, []string{"monitoring"}) || AppConfig.ExcludedObjectLabels["example.com/skip"] != "true" || !AppConfig.IncludeWebhookNamespace {
+			t.Errorf("unexpected exclusion config %v", AppConfig)
+		}
+		if err := UpdateExclusionConfig([]string{"Not_A_Namespace"}, nil, false); err == nil {
+			t.Errorf("expected an error for an invalid namespace")
+		}
+		if err := UpdateExclusionConfig(nil, map[string]string{"example.com/skip": "not a value"}, false); err == nil {
+			t.Errorf("expected an error for an invalid object label")
+		}
+	})
+
+	t.Run("UpdateDriftConfig", func(t *testing.T) {
+		NewConfig()
+		if AppConfig.CABundleFlipThreshold != DefaultCABundleFlipThreshold {
+			t.Errorf("expected caBundle flip threshold %d by default, got %d", DefaultCABundleFlipThreshold, AppConfig.CABundleFlipThreshold)
+		}
+		if err := UpdateDriftConfig(0); err != nil || AppConfig.CABundleFlipThreshold != 0 {
+			t.Errorf("expected caBundle flip threshold 0, got %d, error: %v", AppConfig.CABundleFlipThreshold, err)
+		}
+		if err := UpdateDriftConfig(-1); err == nil {
+			t.Errorf("expected an error for a negative caBundle flip threshold")
+		}
+	})
+
+	t.Run("UpdateBreakerConfig", func(t *testing.T) {
+		NewConfig()
+		if AppConfig.BreakerThreshold != 0 || AppConfig.BreakerAction != BreakerActionIgnore {
+			t.Errorf("expected a disabled breaker ignoring by default, got %s and %s", AppConfig.BreakerThreshold, AppConfig.BreakerAction)
+		}
+		if err := UpdateBreakerConfig(5*time.Minute, "remove"); err != nil || AppConfig.BreakerThreshold != 5*time.Minute || AppConfig.BreakerAction != BreakerActionRemove {
+			t.Errorf("expected a 5m breaker removing webhooks, got %s and %s, error: %v", AppConfig.BreakerThreshold, AppConfig.BreakerAction, err)
+		}
+		if err := UpdateBreakerConfig(-time.Minute, "ignore"); err == nil {
+			t.Errorf("expected an error for a negative breaker threshold")
+		}
+		if err := UpdateBreakerConfig(time.Minute, "delete"); err == nil {
+			t.Errorf("expected an error for an unknown breaker action")
+		}
+	})
+
+	t.Run("UpdateReadinessConfig", func(t *testing.T) {
+		NewConfig()
+		if err := UpdateReadinessConfig(2 * time.Minute); err != nil || AppConfig.ReadinessTimeout != 2*time.Minute {
+			t.Errorf("expected a readiness timeout of 2m, got %s, error: %v", AppConfig.ReadinessTimeout, err)
+		}
+		if err := UpdateReadinessConfig(-time.Minute); err == nil {
+			t.Errorf("expected an error for a negative readiness timeout")
+		}
+	})
+
+	t.Run("UpdateDisableConfig", func(t *testing.T) {
+		NewConfig()
+		if AppConfig.DisableMode != DisableModeIgnore {
+			t.Errorf("expected the ignore disable mode by default, got %s", AppConfig.DisableMode)
+		}
+		if err := UpdateDisableConfig("detach"); err != nil || AppConfig.DisableMode != DisableModeDetach {
+			t.Errorf("expected the detach disable mode, got %s, error: %v", AppConfig.DisableMode, err)
+		}
+		if err := UpdateDisableConfig("delete"); err == nil {
+			t.Errorf("expected an error for an unknown disable mode")
+		}
+	})
+
 	t.Run("SecretName", func(t *testing.T) {
 		expected := "webhook-tls-manager-tls-certs"
 		if SecretName() != expected {
@@ -39,6 +242,23 @@ func TestConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("ConfigMapName", func(t *testing.T) {
+		expected := "webhook-tls-manager-webhook-config"
+		if ConfigMapName() != expected {
+			t.Errorf("expected %s, got %s", expected, ConfigMapName())
+		}
+	})
+
+	t.Run("InstanceLabels", func(t *testing.T) {
+		expected := map[string]string{
+			"webhook-tls-manager.azure.com/instance":        "webhook-tls-manager",
+			"webhook-tls-manager.azure.com/owner-namespace": "kube-system",
+		}
+		if labels := InstanceLabels(); !reflect.DeepEqual(labels, expected) {
+			t.Errorf("expected %v, got %v", expected, labels)
+		}
+	})
+
 	t.Run("ServiceName", func(t *testing.T) {
 		expected := "webhook-tls-manager-webhook"
 		if ServiceName() != expected {
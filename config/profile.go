@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/Azure/webhook-tls-manager/consts"
+)
+
+const (
+	ProfileAKS     = "aks"
+	ProfileGeneric = "generic"
+	ProfileCustom  = "custom"
+
+	// GenericManagedLabelValue is the value of the managed-by label of the generic profile.
+	GenericManagedLabelValue = "webhook-tls-manager"
+)
+
+// Profile is how objects are marked as managed, and which provider specific labels are set.
+type Profile struct {
+	Name              string
+	ManagedLabelKey   string
+	ManagedLabelValue string
+	// AcceptedManagedValues are further values of the managed label that mark an object as
+	// managed, e.g. the value of the profile used before. Such objects are relabelled with
+	// ManagedLabelValue when they are updated.
+	AcceptedManagedValues []string
+	// AdmissionEnforcerLabel sets the admissions enforcer label of AKS to exempt kube-system
+	// from the webhook unless kube-system is blocked.
+	AdmissionEnforcerLabel bool
+}
+
+func aksProfile() Profile {
+	return Profile{
+		Name:                   ProfileAKS,
+		ManagedLabelKey:        consts.ManagedLabelKey,
+		ManagedLabelValue:      consts.ManagedLabelValue,
+		AdmissionEnforcerLabel: true,
+	}
+}
+
+// UpdateProfileConfig selects the profile. The managed label key and value and the admissions
+// enforcer label can only be given for the custom profile, and the key and value are required
+// for it.
+func UpdateProfileConfig(name string, managedLabelKey string, managedLabelValue string, acceptedManagedValues []string, admissionEnforcerLabel bool) error {
+	var profile Profile
+	switch name {
+	case ProfileAKS, ProfileGeneric:
+		if managedLabelKey != "" || managedLabelValue != "" || admissionEnforcerLabel {
+			return fmt.Errorf("the managed label and the admissions enforcer label can only be set with the %s profile", ProfileCustom)
+		}
+		profile = aksProfile()
+		if name == ProfileGeneric {
+			profile = Profile{Name: ProfileGeneric, ManagedLabelKey: consts.ManagedLabelKey, ManagedLabelValue: GenericManagedLabelValue}
+		}
+	case ProfileCustom:
+		if managedLabelKey == "" || managedLabelValue == "" {
+			return fmt.Errorf("the %s profile requires the managed label key and value", ProfileCustom)
+		}
+		if errs := validation.IsQualifiedName(managedLabelKey); len(errs) > 0 {
+			return fmt.Errorf("invalid managed label key %s: %s", managedLabelKey, strings.Join(errs, "; "))
+		}
+		profile = Profile{Name: ProfileCustom, ManagedLabelKey: managedLabelKey, ManagedLabelValue: managedLabelValue, AdmissionEnforcerLabel: admissionEnforcerLabel}
+	default:
+		return fmt.Errorf("unknown profile %q. expected %s, %s or %s", name, ProfileAKS, ProfileGeneric, ProfileCustom)
+	}
+	for _, value := range append([]string{profile.ManagedLabelValue}, acceptedManagedValues...) {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid managed label value %s: %s", value, strings.Join(errs, "; "))
+		}
+	}
+	profile.AcceptedManagedValues = acceptedManagedValues
+	AppConfig.Profile = profile
+	return nil
+}
+
+// ManagedLabels returns the label marking an object as managed.
+func ManagedLabels() map[string]string {
+	return map[string]string{AppConfig.Profile.ManagedLabelKey: AppConfig.Profile.ManagedLabelValue}
+}
+
+// IsManaged reports whether labels mark an object as managed under the profile.
+func IsManaged(labels map[string]string) bool {
+	v, exist := labels[AppConfig.Profile.ManagedLabelKey]
+	if !exist {
+		return false
+	}
+	if v == AppConfig.Profile.ManagedLabelValue {
+		return true
+	}
+	for _, accepted := range AppConfig.Profile.AcceptedManagedValues {
+		if v == accepted {
+			return true
+		}
+	}
+	return false
+}
@@ -4,7 +4,52 @@ const (
 	ManagedLabelValue              = "aks"
 	ManagedLabelKey                = "app.kubernetes.io/managed-by"
 	AdmissionEnforcerDisabledLabel = "admissions.enforcer/disabled"
+	// MetadataPrefix prefixes the labels and annotations of webhook-tls-manager.
+	MetadataPrefix                 = "webhook-tls-manager.azure.com/"
+	InstanceLabelKey               = "webhook-tls-manager.azure.com/instance"
+	OwnerNamespaceLabelKey         = "webhook-tls-manager.azure.com/owner-namespace"
 	AdmissionEnforcerDisabledValue = "true"
 	CleanupJob                     = "cleanup"
 	ReconciliationJob              = "reconciliation"
+	RollbackJob                    = "rollback"
+	ForcedRotationJob              = "forced_rotation"
+	ValidationJob                  = "validation"
+	VerificationJob                = "verification"
+	ProbeJob                       = "probe"
+	DisableJob                     = "disable"
+	EnableJob                      = "enable"
+	// FieldManager is the field manager of the server-side applies and creates of the job. It is
+	// the name older versions wrote with, as the default of the API server for clients that do
+	// not set one.
+	FieldManager = "webhook-tls-manager"
+
+	// Annotations recording the progress of a certificate rotation on the secret.
+	RotationPhaseAnnotation                 = "webhook-tls-manager.azure.com/rotation-phase"
+	RotationCAFingerprintAnnotation         = "webhook-tls-manager.azure.com/rotation-ca-fingerprint"
+	RotationServerCertFingerprintAnnotation = "webhook-tls-manager.azure.com/rotation-server-cert-fingerprint"
+
+	// Annotations recording the last rotation requested with the rotate command.
+	ForcedRotationScopeAnnotation  = "webhook-tls-manager.azure.com/forced-rotation-scope"
+	ForcedRotationReasonAnnotation = "webhook-tls-manager.azure.com/forced-rotation-reason"
+	ForcedRotationTimeAnnotation   = "webhook-tls-manager.azure.com/forced-rotation-time"
+
+	// Annotations recording the adoption of an object that existed without the managed label.
+	AdoptedAtAnnotation         = "webhook-tls-manager.azure.com/adopted-at"
+	AdoptedFromLabelsAnnotation = "webhook-tls-manager.azure.com/adopted-from-labels"
+
+	// Annotations tracking the caBundle of the webhook being changed by another field manager.
+	CABundleFlipsAnnotation       = "webhook-tls-manager.azure.com/cabundle-flips"
+	CABundleFlipManagerAnnotation = "webhook-tls-manager.azure.com/cabundle-flip-manager"
+	CABundleLastFlipAnnotation    = "webhook-tls-manager.azure.com/cabundle-last-flip"
+	// CABundleFingerprintAnnotation holds the SHA-256 of the caBundle the job last wrote, so a
+	// caBundle changed by another field manager can be told from one the job rotated.
+	CABundleFingerprintAnnotation = "webhook-tls-manager.azure.com/cabundle-fingerprint"
+
+	// BreakerAnnotation records on the webhook configuration, as JSON by webhook name, since when
+	// the backend of a webhook is unhealthy and whether its breaker is open.
+	BreakerAnnotation = "webhook-tls-manager.azure.com/breaker"
+
+	// DisabledAnnotation records on a webhook configuration taken out of the request path by the
+	// disable command, as JSON, the mode and time it was disabled and the webhooks to restore.
+	DisabledAnnotation = "webhook-tls-manager.azure.com/disabled"
 )
@@ -0,0 +1,177 @@
+package errdefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+var (
+	// ErrConfigMapMissing means the ConfigMap holding the webhook configuration does not exist.
+	ErrConfigMapMissing = errors.New("webhook configuration configmap not found")
+	// ErrConfigMapInvalid means the ConfigMap exists but holds no valid webhook configuration.
+	ErrConfigMapInvalid = errors.New("webhook configuration configmap is invalid")
+	// ErrUnmanagedObject means an object exists but does not carry the managed-by label.
+	ErrUnmanagedObject = errors.New("object is not managed by webhook-tls-manager")
+	// ErrPermission means the API server denied a request, e.g. because of missing RBAC rules.
+	ErrPermission = errors.New("permission denied")
+	// ErrCertificateInvalid means a stored certificate cannot be parsed.
+	ErrCertificateInvalid = errors.New("certificate is invalid")
+	// ErrCertificateGeneration means generating a key or signing a certificate failed.
+	ErrCertificateGeneration = errors.New("certificate generation failed")
+	// ErrNoPreviousCertificates means a rollback found no previous certificates in the secret.
+	ErrNoPreviousCertificates = errors.New("no previous certificates to roll back to")
+	// ErrFieldConflict means a server-side apply conflicts with fields owned by another field manager.
+	ErrFieldConflict = errors.New("fields are owned by another field manager")
+	// ErrEndpointUntrusted means an endpoint of the webhook is unreachable or serves a certificate
+	// the caBundle does not trust.
+	ErrEndpointUntrusted = errors.New("webhook endpoint does not serve a trusted certificate")
+	// ErrProbeFailed means an endpoint of the webhook did not answer an AdmissionReview correctly.
+	ErrProbeFailed = errors.New("webhook probe failed")
+	// ErrBackendNotReady means the services of the webhook had no ready endpoints within the
+	// readiness timeout, so the webhook was not registered.
+	ErrBackendNotReady = errors.New("webhook backend has no ready endpoints")
+	// ErrDisabledStateInvalid means the disabled annotation of a webhook configuration cannot be
+	// parsed, so its webhooks cannot be restored.
+	ErrDisabledStateInvalid = errors.New("disabled state of the webhook is invalid")
+)
+
+// APIError is a failed request to the Kubernetes API server. It unwraps to the API error, so
+// the k8s.io/apimachinery/pkg/api/errors helpers such as IsNotFound keep working, and
+// errors.Is(err, ErrPermission) holds for forbidden and unauthorized responses.
+type APIError struct {
+	Verb     string
+	Resource string
+	Name     string
+	Err      error
+}
+
+// NewAPIError returns nil if err is nil.
+func NewAPIError(verb, resource, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &APIError{Verb: verb, Resource: resource, Name: name, Err: err}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s %s: %s", e.Verb, e.Resource, e.Name, e.Err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == ErrPermission && (k8serrors.IsForbidden(e.Err) || k8serrors.IsUnauthorized(e.Err))
+}
+
+// ObjectError is a problem with an object in the cluster that retrying cannot fix. Reason is
+// one of the sentinel errors of this package, Err the underlying cause if there is one.
+type ObjectError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Reason    error
+	Err       error
+}
+
+func (e *ObjectError) Error() string {
+	msg := fmt.Sprintf("%s %s/%s: %s", e.Kind, e.Namespace, e.Name, e.Reason)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ObjectError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Reason}
+	}
+	return []error{e.Reason, e.Err}
+}
+
+// Permanent tells the retry policy not to retry.
+func (e *ObjectError) Permanent() bool {
+	return true
+}
+
+// Reasons are short, stable and low-cardinality, for metric labels and logs.
+const (
+	ReasonNone                   = "none"
+	ReasonConfigMapMissing       = "configmap_missing"
+	ReasonConfigMapInvalid       = "configmap_invalid"
+	ReasonUnmanagedObject        = "unmanaged_object"
+	ReasonPermission             = "permission_denied"
+	ReasonCertificateInvalid     = "certificate_invalid"
+	ReasonCertificateGeneration  = "certificate_generation"
+	ReasonNoPreviousCertificates = "no_previous_certificates"
+	ReasonFieldConflict          = "field_conflict"
+	ReasonEndpointUntrusted      = "endpoint_untrusted"
+	ReasonProbeFailed            = "probe_failed"
+	ReasonBackendNotReady        = "backend_not_ready"
+	ReasonDisabledStateInvalid   = "disabled_state_invalid"
+	ReasonAPI                    = "api_error"
+	ReasonCancelled              = "cancelled"
+	ReasonTimeout                = "timeout"
+	ReasonUnknown                = "unknown"
+)
+
+// reasons is ordered from the most to the least specific, since an error can match several,
+// e.g. a missing ConfigMap wraps the NotFound API error.
+var reasons = []struct {
+	err      error
+	reason   string
+	exitCode int
+}{
+	{context.Canceled, ReasonCancelled, 3},
+	{ErrConfigMapMissing, ReasonConfigMapMissing, 4},
+	{ErrConfigMapInvalid, ReasonConfigMapInvalid, 5},
+	{ErrUnmanagedObject, ReasonUnmanagedObject, 6},
+	{ErrPermission, ReasonPermission, 7},
+	{ErrCertificateInvalid, ReasonCertificateInvalid, 8},
+	{ErrCertificateGeneration, ReasonCertificateGeneration, 9},
+	{context.DeadlineExceeded, ReasonTimeout, 10},
+	{ErrNoPreviousCertificates, ReasonNoPreviousCertificates, 12},
+	{ErrFieldConflict, ReasonFieldConflict, 13},
+	{ErrEndpointUntrusted, ReasonEndpointUntrusted, 14},
+	{ErrProbeFailed, ReasonProbeFailed, 15},
+	{ErrBackendNotReady, ReasonBackendNotReady, 16},
+	{ErrDisabledStateInvalid, ReasonDisabledStateInvalid, 17},
+}
+
+// apiExitCode is returned for API errors not covered by a more specific reason.
+const apiExitCode = 11
+
+// Reason returns the reason of err, ReasonNone for nil.
+func Reason(err error) string {
+	reason, _ := classify(err)
+	return reason
+}
+
+// ExitCode returns the process exit code for err: 0 for nil, 1 for errors of unknown reason,
+// and a distinct code from 3 upwards for every reason, so a job's failure can be told apart
+// from its exit code alone.
+func ExitCode(err error) int {
+	_, exitCode := classify(err)
+	return exitCode
+}
+
+func classify(err error) (string, int) {
+	if err == nil {
+		return ReasonNone, 0
+	}
+	for _, r := range reasons {
+		if errors.Is(err, r.err) {
+			return r.reason, r.exitCode
+		}
+	}
+	var apiErr *APIError
+	var statusErr k8serrors.APIStatus
+	if errors.As(err, &apiErr) || errors.As(err, &statusErr) {
+		return ReasonAPI, apiExitCode
+	}
+	return ReasonUnknown, 1
+}
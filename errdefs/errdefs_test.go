@@ -0,0 +1,77 @@
+package errdefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestErrdefs(t *testing.T) {
+	forbidden := NewAPIError("get", "secrets", "name", k8serrors.NewForbidden(corev1.Resource("secrets"), "name", errors.New("rbac")))
+	notFound := NewAPIError("get", "configmaps", "name", k8serrors.NewNotFound(corev1.Resource("configmaps"), "name"))
+	missing := &ObjectError{Kind: "ConfigMap", Namespace: "kube-system", Name: "name", Reason: ErrConfigMapMissing, Err: notFound}
+
+	t.Run("APIError", func(t *testing.T) {
+		if NewAPIError("get", "secrets", "name", nil) != nil {
+			t.Errorf("expected nil for a nil error")
+		}
+		if !errors.Is(forbidden, ErrPermission) || !k8serrors.IsForbidden(forbidden) {
+			t.Errorf("expected a forbidden permission error, got %s", forbidden)
+		}
+		if errors.Is(notFound, ErrPermission) {
+			t.Errorf("expected NotFound not to be a permission error")
+		}
+	})
+
+	t.Run("ObjectError", func(t *testing.T) {
+		if !errors.Is(missing, ErrConfigMapMissing) || !k8serrors.IsNotFound(missing) {
+			t.Errorf("expected a missing configmap wrapping NotFound, got %s", missing)
+		}
+		var apiErr *APIError
+		if !errors.As(fmt.Errorf("wrapped: %w", missing), &apiErr) || apiErr.Resource != "configmaps" {
+			t.Errorf("expected to find the API error")
+		}
+		expected := `ConfigMap kube-system/name: webhook configuration configmap not found: get configmaps name: configmaps "name" not found`
+		if missing.Error() != expected {
+			t.Errorf("expected %s, got %s", expected, missing.Error())
+		}
+	})
+
+	t.Run("Reason and ExitCode", func(t *testing.T) {
+		for _, tc := range []struct {
+			err      error
+			reason   string
+			exitCode int
+		}{
+			{nil, ReasonNone, 0},
+			{errors.New("boom"), ReasonUnknown, 1},
+			{fmt.Errorf("reconcile: %w", context.Canceled), ReasonCancelled, 3},
+			{missing, ReasonConfigMapMissing, 4},
+			{&ObjectError{Kind: "ConfigMap", Reason: ErrConfigMapInvalid}, ReasonConfigMapInvalid, 5},
+			{&ObjectError{Kind: "Secret", Reason: ErrUnmanagedObject}, ReasonUnmanagedObject, 6},
+			{forbidden, ReasonPermission, 7},
+			{&ObjectError{Kind: "Secret", Reason: ErrCertificateInvalid}, ReasonCertificateInvalid, 8},
+			{fmt.Errorf("%w: %w", ErrCertificateGeneration, errors.New("rsa")), ReasonCertificateGeneration, 9},
+			{context.DeadlineExceeded, ReasonTimeout, 10},
+			{notFound, ReasonAPI, 11},
+			{&ObjectError{Kind: "Secret", Reason: ErrNoPreviousCertificates}, ReasonNoPreviousCertificates, 12},
+			{&ObjectError{Kind: "Secret", Reason: ErrFieldConflict, Err: k8serrors.NewApplyConflict(nil, "conflict")}, ReasonFieldConflict, 13},
+			{&ObjectError{Kind: "MutatingWebhookConfiguration", Reason: ErrEndpointUntrusted}, ReasonEndpointUntrusted, 14},
+			{&ObjectError{Kind: "MutatingWebhookConfiguration", Reason: ErrProbeFailed}, ReasonProbeFailed, 15},
+			{&ObjectError{Kind: "MutatingWebhookConfiguration", Reason: ErrBackendNotReady}, ReasonBackendNotReady, 16},
+			{&ObjectError{Kind: "MutatingWebhookConfiguration", Reason: ErrDisabledStateInvalid}, ReasonDisabledStateInvalid, 17},
+			{k8serrors.NewConflict(corev1.Resource("secrets"), "name", errors.New("conflict")), ReasonAPI, 11},
+		} {
+			if reason := Reason(tc.err); reason != tc.reason {
+				t.Errorf("expected reason %s for %v, got %s", tc.reason, tc.err, reason)
+			}
+			if exitCode := ExitCode(tc.err); exitCode != tc.exitCode {
+				t.Errorf("expected exit code %d for %v, got %d", tc.exitCode, tc.err, exitCode)
+			}
+		}
+	})
+}
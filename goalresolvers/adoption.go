@@ -0,0 +1,67 @@
+package goalresolvers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// shouldAdoptSecret returns true if adoption is enabled and the secret exists without the
+// managed label. The secret must hold a valid CA and a server certificate signed by it, since
+// adopting it hands its rotation to the manager.
+func (g *webhookTlsManagerGoalResolver) shouldAdoptSecret(ctx context.Context) (bool, error) {
+	if !config.AppConfig.Adopt {
+		return false, nil
+	}
+	logger := log.MustGetLogger(ctx)
+	secret, getErr := g.kubeClient.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(getErr) {
+		return false, nil
+	}
+	if getErr != nil {
+		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return false, errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	if config.IsManaged(secret.ObjectMeta.Labels) {
+		return false, nil
+	}
+	if err := validateSecretCertificates(secret); err != nil {
+		logger.Errorf(ctx, "secret %s cannot be adopted. error: %s", config.SecretName(), err)
+		return false, &errdefs.ObjectError{Kind: "Secret", Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Reason: errdefs.ErrCertificateInvalid, Err: err}
+	}
+	logger.Infof(ctx, "secret %s is not managed and will be adopted.", config.SecretName())
+	return true, nil
+}
+
+// validateSecretCertificates checks that secret holds a CA certificate and key and a server
+// certificate and key, and that the server certificate is signed by the CA.
+func validateSecretCertificates(secret *corev1.Secret) error {
+	caCert, err := certificates.ParsePEMCertificate(secret.Data["caCert.pem"])
+	if err != nil {
+		return fmt.Errorf("caCert.pem: %w", err)
+	}
+	if _, err := certificates.ParsePEMPrivateKey(secret.Data["caKey.pem"]); err != nil {
+		return fmt.Errorf("caKey.pem: %w", err)
+	}
+	serverCert, err := certificates.ParsePEMCertificate(secret.Data["serverCert.pem"])
+	if err != nil {
+		return fmt.Errorf("serverCert.pem: %w", err)
+	}
+	if _, err := certificates.ParsePEMPrivateKey(secret.Data["serverKey.pem"]); err != nil {
+		return fmt.Errorf("serverKey.pem: %w", err)
+	}
+	if err := serverCert.CheckSignatureFrom(caCert); err != nil {
+		return fmt.Errorf("serverCert.pem is not signed by caCert.pem: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package goalresolvers
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates/certcreator"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates/certgenerator"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates/certoperator"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// RotationScope is what a forced rotation replaces.
+type RotationScope string
+
+const (
+	// RotationScopeLeaf replaces the server certificate and key, signed by the current CA.
+	RotationScopeLeaf RotationScope = "leaf"
+	// RotationScopeCA replaces the CA and the server certificate. The replaced CA stays in the
+	// caBundle next to the new one until the next rotation.
+	RotationScopeCA RotationScope = "ca"
+	// RotationScopeCARevoke replaces the CA and the server certificate and removes the replaced
+	// CA from the caBundle at once, e.g. after a key compromise. It cannot be rolled back.
+	RotationScopeCARevoke RotationScope = "ca-revoke"
+)
+
+// ParseRotationScope returns the scope named s.
+func ParseRotationScope(s string) (RotationScope, error) {
+	switch scope := RotationScope(s); scope {
+	case RotationScopeLeaf, RotationScopeCA, RotationScopeCARevoke:
+		return scope, nil
+	}
+	return "", fmt.Errorf("unknown rotation scope %q. expected %s, %s or %s", s, RotationScopeLeaf, RotationScopeCA, RotationScopeCARevoke)
+}
+
+// ForcedRotation is a rotation requested by an operator, regardless of the certificate expiry.
+type ForcedRotation struct {
+	Scope RotationScope
+	// Reason is the operator supplied reason, recorded on the secret and in an Event.
+	Reason string
+}
+
+type forcedRotationGoalResolver struct {
+	webhookTlsManagerGoalResolver
+	forcedRotation ForcedRotation
+	// goal is generated on the first successful Resolve and returned by later ones, so a retried
+	// reconcile writes the same certificates instead of rotating again.
+	goal *WebhookTlsManagerGoal
+}
+
+// NewForcedRotationGoalResolver returns a goal resolver that rotates the certificates of the
+// managed secret whether they expire or not. The secret must exist and be managed.
+func NewForcedRotationGoalResolver(ctx context.Context, kubeClient kubernetes.Interface, isKubeSystemNamespaceBlocked bool, forcedRotation ForcedRotation) WebhookTlsManagerGoalResolverInterface {
+	logger := log.MustGetLogger(ctx)
+	logger.Infof(ctx, "NewForcedRotationGoalResolver: isKubeSystemNamespaceBlocked=%v, scope=%s", isKubeSystemNamespaceBlocked, forcedRotation.Scope)
+	generator := certgenerator.NewCertGenerator(certcreator.NewCertCreator())
+	operator := certoperator.NewCertOperator(generator)
+	return &forcedRotationGoalResolver{
+		webhookTlsManagerGoalResolver: webhookTlsManagerGoalResolver{
+			certOperator:                 operator,
+			kubeClient:                   kubeClient,
+			isKubeSystemNamespaceBlocked: isKubeSystemNamespaceBlocked,
+			IsWebhookTlsManagerEnabled:   true,
+		},
+		forcedRotation: forcedRotation,
+	}
+}
+
+func (g *forcedRotationGoalResolver) Resolve(ctx context.Context) (_ *WebhookTlsManagerGoal, cerr error) {
+	ctx, span := log.StartSpan(ctx, "Resolve", map[string]interface{}{"forced.scope": string(g.forcedRotation.Scope)})
+	defer func() { endSpan(span, cerr) }()
+	ctx = log.WithFields(ctx, "component", "goalresolver")
+	logger := log.MustGetLogger(ctx)
+
+	if g.goal != nil {
+		logger.Info(ctx, "forced rotation certificates already generated.")
+		return g.goal, nil
+	}
+
+	secret, getErr := g.kubeClient.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if getErr != nil {
+		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return nil, errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	if !config.IsManaged(secret.ObjectMeta.Labels) {
+		logger.Errorf(ctx, "secret %s is not managed. refusing to rotate it.", config.SecretName())
+		return nil, &errdefs.ObjectError{Kind: "Secret", Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Reason: errdefs.ErrUnmanagedObject}
+	}
+
+	var data *CertificateData
+	if g.forcedRotation.Scope == RotationScopeLeaf {
+		caCert, err := certificates.ParsePEMCertificate(secret.Data["caCert.pem"])
+		if err != nil {
+			return nil, &errdefs.ObjectError{Kind: "Secret", Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Reason: errdefs.ErrCertificateInvalid, Err: err}
+		}
+		caKey, err := certificates.ParsePEMPrivateKey(secret.Data["caKey.pem"])
+		if err != nil {
+			return nil, &errdefs.ObjectError{Kind: "Secret", Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Reason: errdefs.ErrCertificateInvalid, Err: err}
+		}
+		serverCertPem, serverKeyPem, cerr := g.generateServerCertificate(ctx, caCert, caKey)
+		if cerr != nil {
+			return nil, cerr
+		}
+		data = &CertificateData{
+			CaCertPem:     secret.Data["caCert.pem"],
+			CaKeyPem:      secret.Data["caKey.pem"],
+			ServerCertPem: []byte(serverCertPem),
+			ServerKeyPem:  []byte(serverKeyPem),
+		}
+	} else {
+		data, cerr = g.generateCertificates(ctx)
+		if cerr != nil {
+			logger.Errorf(ctx, "generateCertificates. error: %s", cerr)
+			return nil, cerr
+		}
+		data.RevokePrevious = g.forcedRotation.Scope == RotationScopeCARevoke
+	}
+	logger.Infof(ctx, "forced rotation of scope %s generated new certificates. reason: %s", g.forcedRotation.Scope, g.forcedRotation.Reason)
+
+	forcedRotation := g.forcedRotation
+	g.goal = &WebhookTlsManagerGoal{
+		CertData:                     data,
+		RotationReason:               RotationReasonForced,
+		ForcedRotation:               &forcedRotation,
+		IsKubeSystemNamespaceBlocked: g.isKubeSystemNamespaceBlocked,
+		IsWebhookTlsManagerEnabled:   true,
+	}
+	return g.goal, nil
+}
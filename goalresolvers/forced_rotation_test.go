@@ -0,0 +1,119 @@
+package goalresolvers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("ParseRotationScope", func() {
+	It("known scopes", func() {
+		for _, s := range []string{"leaf", "ca", "ca-revoke"} {
+			scope, err := ParseRotationScope(s)
+			Expect(err).To(BeNil())
+			Expect(string(scope)).To(Equal(s))
+		}
+	})
+
+	It("unknown scope", func() {
+		_, err := ParseRotationScope("all")
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("forced rotation goal resolver", func() {
+	var (
+		ctx           context.Context
+		fakeClientset *fake.Clientset
+		current       *CertificateData
+	)
+
+	BeforeEach(func() {
+		ctx = log.NewLogger(3).WithLogger(context.Background())
+		config.NewConfig()
+		if current == nil {
+			var err error
+			current, err = NewWebhookTlsManagerGoalResolver(ctx, fake.NewSimpleClientset(), false, true).(*webhookTlsManagerGoalResolver).generateCertificates(ctx)
+			Expect(err).To(BeNil())
+		}
+		secret := generateSecret(string(current.ServerCertPem), config.AppConfig.Namespace)
+		secret.Data["caCert.pem"] = current.CaCertPem
+		secret.Data["caKey.pem"] = current.CaKeyPem
+		secret.Data["serverKey.pem"] = current.ServerKeyPem
+		fakeClientset = fake.NewSimpleClientset(secret)
+	})
+
+	It("leaf scope keeps the CA and signs a new server certificate with it", func() {
+		resolver := NewForcedRotationGoalResolver(ctx, fakeClientset, false, ForcedRotation{Scope: RotationScopeLeaf, Reason: "test"})
+		goal, err := resolver.Resolve(ctx)
+		Expect(err).To(BeNil())
+		Expect(goal.RotationReason).To(Equal(RotationReasonForced))
+		Expect(goal.ForcedRotation).To(Equal(&ForcedRotation{Scope: RotationScopeLeaf, Reason: "test"}))
+		Expect(goal.CertData.CaCertPem).To(Equal(current.CaCertPem))
+		Expect(goal.CertData.CaKeyPem).To(Equal(current.CaKeyPem))
+		Expect(goal.CertData.ServerCertPem).NotTo(Equal(current.ServerCertPem))
+		Expect(goal.CertData.RevokePrevious).To(BeFalse())
+
+		caCert, err := certificates.ParsePEMCertificate(goal.CertData.CaCertPem)
+		Expect(err).To(BeNil())
+		serverCert, err := certificates.ParsePEMCertificate(goal.CertData.ServerCertPem)
+		Expect(err).To(BeNil())
+		Expect(serverCert.CheckSignatureFrom(caCert)).To(Succeed())
+	})
+
+	It("ca scope replaces the CA", func() {
+		resolver := NewForcedRotationGoalResolver(ctx, fakeClientset, false, ForcedRotation{Scope: RotationScopeCA, Reason: "test"})
+		goal, err := resolver.Resolve(ctx)
+		Expect(err).To(BeNil())
+		Expect(goal.CertData.CaCertPem).NotTo(Equal(current.CaCertPem))
+		Expect(goal.CertData.RevokePrevious).To(BeFalse())
+	})
+
+	It("ca-revoke scope replaces the CA and revokes the previous one", func() {
+		resolver := NewForcedRotationGoalResolver(ctx, fakeClientset, false, ForcedRotation{Scope: RotationScopeCARevoke, Reason: "test"})
+		goal, err := resolver.Resolve(ctx)
+		Expect(err).To(BeNil())
+		Expect(goal.CertData.CaCertPem).NotTo(Equal(current.CaCertPem))
+		Expect(goal.CertData.RevokePrevious).To(BeTrue())
+	})
+
+	It("returns the same goal when resolved again", func() {
+		resolver := NewForcedRotationGoalResolver(ctx, fakeClientset, false, ForcedRotation{Scope: RotationScopeLeaf, Reason: "test"})
+		first, err := resolver.Resolve(ctx)
+		Expect(err).To(BeNil())
+		second, err := resolver.Resolve(ctx)
+		Expect(err).To(BeNil())
+		Expect(second).To(BeIdenticalTo(first))
+	})
+
+	It("refuses an unmanaged secret", func() {
+		secret := generateSecret(string(current.ServerCertPem), config.AppConfig.Namespace)
+		secret.Labels = nil
+		fakeClientset = fake.NewSimpleClientset(secret)
+		resolver := NewForcedRotationGoalResolver(ctx, fakeClientset, false, ForcedRotation{Scope: RotationScopeCA, Reason: "test"})
+		_, err := resolver.Resolve(ctx)
+		Expect(errors.Is(err, errdefs.ErrUnmanagedObject)).To(BeTrue())
+	})
+
+	It("fails without a secret", func() {
+		resolver := NewForcedRotationGoalResolver(ctx, fake.NewSimpleClientset(), false, ForcedRotation{Scope: RotationScopeCA, Reason: "test"})
+		_, err := resolver.Resolve(ctx)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("leaf scope fails with an invalid CA", func() {
+		secret := generateSecret(string(current.ServerCertPem), config.AppConfig.Namespace)
+		fakeClientset = fake.NewSimpleClientset(secret)
+		resolver := NewForcedRotationGoalResolver(ctx, fakeClientset, false, ForcedRotation{Scope: RotationScopeLeaf, Reason: "test"})
+		_, err := resolver.Resolve(ctx)
+		Expect(errors.Is(err, errdefs.ErrCertificateInvalid)).To(BeTrue())
+	})
+})
@@ -2,32 +2,59 @@ package goalresolvers
 
 import (
 	"context"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"fmt"
 	"time"
 
 	"github.com/Azure/webhook-tls-manager/config"
-	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
 	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
 	"github.com/Azure/webhook-tls-manager/toolkit/certificates/certcreator"
 	"github.com/Azure/webhook-tls-manager/toolkit/certificates/certgenerator"
 	"github.com/Azure/webhook-tls-manager/toolkit/certificates/certoperator"
 	"github.com/Azure/webhook-tls-manager/toolkit/log"
+	"github.com/Azure/webhook-tls-manager/toolkit/retrypolicy"
 
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	// RotationReasonSecretNotFound means there is no certificate secret yet.
+	RotationReasonSecretNotFound = "secret_not_found"
+	// RotationReasonCertExpiring means the server certificate expires within a month.
+	RotationReasonCertExpiring = "cert_expiring"
+	// RotationReasonForced means an operator requested the rotation with the rotate command.
+	RotationReasonForced = "forced"
+	// rotationSkippedUnmanaged is returned by shouldRotateCert along with false when the secret
+	// exists but is not managed.
+	rotationSkippedUnmanaged = "unmanaged"
+)
+
 type CertificateData struct {
 	CaCertPem     []byte
 	CaKeyPem      []byte
 	ServerCertPem []byte
 	ServerKeyPem  []byte
+	// RevokePrevious drops the replaced certificates instead of keeping them as the previous
+	// ones, so the replaced CA leaves the caBundle at once and cannot be rolled back to.
+	RevokePrevious bool
 }
 
 type WebhookTlsManagerGoal struct {
-	CertData                     *CertificateData
+	CertData       *CertificateData
+	RotationReason string
+	// SecretUnmanaged is true if the secret exists but is not managed, so its
+	// certificates are neither checked nor rotated.
+	SecretUnmanaged bool
+	// AdoptSecret is true if the secret exists without the managed label and is to be adopted.
+	AdoptSecret bool
+	// ForcedRotation is set if an operator requested the rotation with the rotate command.
+	ForcedRotation               *ForcedRotation
 	IsKubeSystemNamespaceBlocked bool
 	IsWebhookTlsManagerEnabled   bool
 }
@@ -39,7 +66,12 @@ type webhookTlsManagerGoalResolver struct {
 	IsWebhookTlsManagerEnabled   bool
 }
 
-func (g *webhookTlsManagerGoalResolver) shouldRotateCert(ctx context.Context) (bool, *error) {
+func (g *webhookTlsManagerGoalResolver) shouldRotateCert(ctx context.Context) (rotate bool, reason string, cerr error) {
+	ctx, span := log.StartSpan(ctx, "shouldRotateCert", nil)
+	defer func() {
+		span.SetAttributes(map[string]interface{}{"rotate": rotate, "reason": reason})
+		endSpan(span, cerr)
+	}()
 
 	logger := log.MustGetLogger(ctx)
 	logger.Infof(ctx, "config is %v", config.AppConfig)
@@ -47,40 +79,60 @@ func (g *webhookTlsManagerGoalResolver) shouldRotateCert(ctx context.Context) (b
 	secret, getErr := g.kubeClient.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 	if k8serrors.IsNotFound(getErr) {
 		logger.Infof(ctx, "secret %s not exists", config.SecretName())
-		return true, nil
+		return true, RotationReasonSecretNotFound, nil
 	}
 	if getErr != nil {
 		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
-		return false, &getErr
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return false, "", errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
 	}
 	logger.Infof(ctx, "secret %s exists", config.SecretName())
-	if v, exist := secret.ObjectMeta.Labels[consts.ManagedLabelKey]; exist && v == consts.ManagedLabelValue {
-		logger.Infof(ctx, "found secret %s managed by aks. checking expiration date.", config.SecretName())
+	// An unmanaged secret to be adopted was validated by shouldAdoptSecret.
+	if config.IsManaged(secret.ObjectMeta.Labels) || config.AppConfig.Adopt {
+		logger.Infof(ctx, "found secret %s managed by aks or to be adopted. checking expiration date.", config.SecretName())
 		expired, err := certificates.IsPEMCertificateExpired(ctx, string(secret.Data["serverCert.pem"]), config.SecretName(), time.Now().AddDate(0, 1, 0))
 		if err != nil {
 			logger.Errorf(ctx, "failed to check cert %s. error: %s", config.SecretName(), err)
-			return false, &err
+			return false, "", &errdefs.ObjectError{Kind: "Secret", Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Reason: errdefs.ErrCertificateInvalid, Err: err}
 		}
 		if expired {
 			logger.Infof(ctx, "cert expired.")
-			return true, nil
+			return true, RotationReasonCertExpiring, nil
 		}
 		logger.Infof(ctx, "cert valid.")
-		return false, nil
+		return false, "", nil
+	}
+	logger.Warningf(ctx, "found secret %s is not managed.", config.SecretName())
+	return false, rotationSkippedUnmanaged, nil
+}
+
+func (g *webhookTlsManagerGoalResolver) generateCertificates(ctx context.Context) (*CertificateData, error) {
+	logger := log.MustGetLogger(ctx)
+	caCert, caCertPem, caKey, caKeyPem, cerr := g.generateCACertificate(ctx)
+	if cerr != nil {
+		return &CertificateData{}, cerr
+	}
+	serverCertPem, serverKeyPem, cerr := g.generateServerCertificate(ctx, caCert, caKey)
+	if cerr != nil {
+		return &CertificateData{}, cerr
 	}
-	logger.Warningf(ctx, "found secret %s is not managed by AKS.", config.SecretName())
-	return false, nil
+
+	logger.Info(ctx, "new cert generated")
+	return &CertificateData{
+		CaCertPem:     []byte(caCertPem),
+		CaKeyPem:      []byte(caKeyPem),
+		ServerCertPem: []byte(serverCertPem),
+		ServerKeyPem:  []byte(serverKeyPem),
+	}, nil
 }
 
-func (g *webhookTlsManagerGoalResolver) generateCertificates(ctx context.Context) (*CertificateData, *error) {
+func (g *webhookTlsManagerGoalResolver) generateCACertificate(ctx context.Context) (*x509.Certificate, string, *rsa.PrivateKey, string, error) {
 	logger := log.MustGetLogger(ctx)
 	now := time.Now().UTC()
-	notBefore := now.Add(-certificates.ClockSkewDuration)
-	notAfter := now.AddDate(config.AppConfig.CaValidityYears, 0, 0)
 	caCsr := &x509.Certificate{
 		Subject:               pkix.Name{CommonName: config.CACertificateCommonName()},
-		NotBefore:             notBefore,
-		NotAfter:              notAfter,
+		NotBefore:             now.Add(-certificates.ClockSkewDuration),
+		NotAfter:              now.AddDate(config.AppConfig.CaValidityYears, 0, 0),
 		BasicConstraintsValid: true,
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
 		IsCA:                  true,
@@ -90,16 +142,20 @@ func (g *webhookTlsManagerGoalResolver) generateCertificates(ctx context.Context
 	caCert, caCertPem, caKey, caKeyPem, rerr := g.certOperator.CreateSelfSignedCertificateKeyPair(ctx, caCsr)
 	if rerr != nil {
 		logger.Errorf(ctx, "generateCertificates generate ca certs and key failed: %s", rerr.Error())
-		return &CertificateData{}, &rerr.RawError
+		return nil, "", nil, "", fmt.Errorf("%w: %w", errdefs.ErrCertificateGeneration, retrypolicy.NewCryptoError(rerr))
 	}
+	return caCert, caCertPem, caKey, caKeyPem, nil
+}
 
-	notAfter = now.AddDate(config.AppConfig.ServerValidityYears, 0, 0)
-
+// generateServerCertificate issues a server certificate signed by caCert.
+func (g *webhookTlsManagerGoalResolver) generateServerCertificate(ctx context.Context, caCert *x509.Certificate, caKey *rsa.PrivateKey) (string, string, error) {
+	logger := log.MustGetLogger(ctx)
+	now := time.Now().UTC()
 	serverCsr := &x509.Certificate{
 		Subject:               pkix.Name{CommonName: config.ServerCertificateCommonName()},
 		Issuer:                pkix.Name{CommonName: config.CACertificateCommonName()},
-		NotBefore:             notBefore,
-		NotAfter:              notAfter,
+		NotBefore:             now.Add(-certificates.ClockSkewDuration),
+		NotAfter:              now.AddDate(config.AppConfig.ServerValidityYears, 0, 0),
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
@@ -110,16 +166,9 @@ func (g *webhookTlsManagerGoalResolver) generateCertificates(ctx context.Context
 	serverCertPem, serverKeyPem, rerr := g.certOperator.CreateCertificateKeyPair(ctx, serverCsr, caCert, caKey)
 	if rerr != nil {
 		logger.Errorf(ctx, "generateCertificates generate server certs and key failed: %s", rerr.Error())
-		return &CertificateData{}, &rerr.RawError
+		return "", "", fmt.Errorf("%w: %w", errdefs.ErrCertificateGeneration, retrypolicy.NewCryptoError(rerr))
 	}
-
-	logger.Info(ctx, "new cert generated")
-	return &CertificateData{
-		CaCertPem:     []byte(caCertPem),
-		CaKeyPem:      []byte(caKeyPem),
-		ServerCertPem: []byte(serverCertPem),
-		ServerKeyPem:  []byte(serverKeyPem),
-	}, nil
+	return serverCertPem, serverKeyPem, nil
 }
 
 func NewWebhookTlsManagerGoalResolver(ctx context.Context, kubeClient kubernetes.Interface, isKubeSystemNamespaceBlocked bool, IsWebhookTlsManagerEnabled bool) WebhookTlsManagerGoalResolverInterface {
@@ -135,7 +184,11 @@ func NewWebhookTlsManagerGoalResolver(ctx context.Context, kubeClient kubernetes
 	}
 }
 
-func (g *webhookTlsManagerGoalResolver) Resolve(ctx context.Context) (*WebhookTlsManagerGoal, *error) {
+func (g *webhookTlsManagerGoalResolver) Resolve(ctx context.Context) (_ *WebhookTlsManagerGoal, cerr error) {
+	ctx, span := log.StartSpan(ctx, "Resolve", nil)
+	defer func() { endSpan(span, cerr) }()
+	ctx = log.WithFields(ctx, "component", "goalresolver")
+
 	logger := log.MustGetLogger(ctx)
 	logger.Infof(ctx, "Resolve: isKubeSystemNamespaceBlocked=%v, IsWebhookTlsManagerEnabled=%v", g.isKubeSystemNamespaceBlocked, g.IsWebhookTlsManagerEnabled)
 	goal := &WebhookTlsManagerGoal{
@@ -143,21 +196,34 @@ func (g *webhookTlsManagerGoalResolver) Resolve(ctx context.Context) (*WebhookTl
 		IsWebhookTlsManagerEnabled:   g.IsWebhookTlsManagerEnabled,
 	}
 
-	rotateCert, cerr := g.shouldRotateCert(ctx)
+	goal.AdoptSecret, cerr = g.shouldAdoptSecret(ctx)
 	if cerr != nil {
-		logger.Errorf(ctx, "Failed to check cert expiration date. error: %s", *cerr)
+		logger.Errorf(ctx, "Failed to check secret for adoption. error: %s", cerr)
+		return nil, cerr
+	}
+
+	rotateCert, reason, cerr := g.shouldRotateCert(ctx)
+	if cerr != nil {
+		logger.Errorf(ctx, "Failed to check cert expiration date. error: %s", cerr)
 		return nil, cerr
 	}
 	if !rotateCert {
 		logger.Info(ctx, "no need to rotate cert.")
 		goal.CertData = nil
+		goal.SecretUnmanaged = reason == rotationSkippedUnmanaged
 	} else {
 		data, cerr := g.generateCertificates(ctx)
 		if cerr != nil {
-			logger.Errorf(ctx, "generateCertificates. error: %s", *cerr)
+			logger.Errorf(ctx, "generateCertificates. error: %s", cerr)
 			return nil, cerr
 		}
 		goal.CertData = data
+		goal.RotationReason = reason
 	}
 	return goal, nil
 }
+
+func endSpan(span log.Span, cerr error) {
+	span.SetStatus(cerr)
+	span.End()
+}
@@ -2,11 +2,13 @@ package goalresolvers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Azure/webhook-tls-manager/config"
 	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
 	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
 	"github.com/Azure/webhook-tls-manager/toolkit/log"
 	. "github.com/onsi/ginkgo"
@@ -32,9 +34,10 @@ var _ = Describe("shouldRotateCert", func() {
 
 	It("cert secret doesn't exist", func() {
 		resolver := NewWebhookTlsManagerGoalResolver(ctx, fakeClientset, false, true).(*webhookTlsManagerGoalResolver)
-		res, err := resolver.shouldRotateCert(ctx)
+		res, reason, err := resolver.shouldRotateCert(ctx)
 		Expect(err).To(BeNil())
 		Expect(res).To(BeTrue())
+		Expect(reason).To(Equal(RotationReasonSecretNotFound))
 	})
 
 	It("get secret error", func() {
@@ -42,7 +45,7 @@ var _ = Describe("shouldRotateCert", func() {
 			return true, nil, fmt.Errorf("get secrets error")
 		})
 		resolver := NewWebhookTlsManagerGoalResolver(ctx, fakeClientset, false, true).(*webhookTlsManagerGoalResolver)
-		_, err := resolver.shouldRotateCert(ctx)
+		_, _, err := resolver.shouldRotateCert(ctx)
 		Expect(err).NotTo(BeNil())
 	})
 
@@ -51,9 +54,10 @@ var _ = Describe("shouldRotateCert", func() {
 		secret := generateSecret(expiredCert, config.AppConfig.Namespace)
 		fakeClientset = fake.NewSimpleClientset(secret)
 		resolver := NewWebhookTlsManagerGoalResolver(ctx, fakeClientset, false, true).(*webhookTlsManagerGoalResolver)
-		res, err := resolver.shouldRotateCert(ctx)
+		res, reason, err := resolver.shouldRotateCert(ctx)
 		Expect(err).To(BeNil())
 		Expect(res).To(BeTrue())
+		Expect(reason).To(Equal(RotationReasonCertExpiring))
 	})
 
 	It("cert unexpired", func() {
@@ -61,11 +65,19 @@ var _ = Describe("shouldRotateCert", func() {
 		secret := generateSecret(cert, config.AppConfig.Namespace)
 		fakeClientset = fake.NewSimpleClientset(secret)
 		resolver := NewWebhookTlsManagerGoalResolver(ctx, fakeClientset, false, true).(*webhookTlsManagerGoalResolver)
-		res, err := resolver.shouldRotateCert(ctx)
+		res, _, err := resolver.shouldRotateCert(ctx)
 		Expect(err).To(BeNil())
 		Expect(res).To(BeFalse())
 	})
 
+	It("cert invalid", func() {
+		secret := generateSecret("not a certificate", config.AppConfig.Namespace)
+		fakeClientset = fake.NewSimpleClientset(secret)
+		resolver := NewWebhookTlsManagerGoalResolver(ctx, fakeClientset, false, true).(*webhookTlsManagerGoalResolver)
+		_, _, err := resolver.shouldRotateCert(ctx)
+		Expect(errors.Is(err, errdefs.ErrCertificateInvalid)).To(BeTrue())
+	})
+
 	It("secret is not managed by aks", func() {
 		secret := &corev1.Secret{
 			TypeMeta: metav1.TypeMeta{
@@ -81,9 +93,12 @@ var _ = Describe("shouldRotateCert", func() {
 		}
 		fakeClientset = fake.NewSimpleClientset(secret)
 		resolver := NewWebhookTlsManagerGoalResolver(ctx, fakeClientset, false, true).(*webhookTlsManagerGoalResolver)
-		res, err := resolver.shouldRotateCert(ctx)
+		res, _, err := resolver.shouldRotateCert(ctx)
 		Expect(err).To(BeNil())
 		Expect(res).To(BeFalse())
+		goal, err := resolver.Resolve(ctx)
+		Expect(err).To(BeNil())
+		Expect(goal.SecretUnmanaged).To(BeTrue())
 	})
 })
 
@@ -150,6 +165,7 @@ var _ = Describe("webhook tls manager goal resolver", func() {
 		goal, cerr := resolver.Resolve(ctx)
 		Expect(cerr).To(BeNil())
 		Expect(goal.CertData).NotTo(BeNil())
+		Expect(goal.RotationReason).To(Equal(RotationReasonSecretNotFound))
 	})
 })
 
@@ -172,3 +188,76 @@ func generateSecret(cert string, namespace string) *corev1.Secret {
 		Type: "Opaque",
 	}
 }
+
+var _ = Describe("shouldAdoptSecret", func() {
+	var (
+		ctx     context.Context
+		current *CertificateData
+	)
+
+	BeforeEach(func() {
+		ctx = log.NewLogger(3).WithLogger(context.Background())
+		config.NewConfig()
+		if current == nil {
+			var err error
+			current, err = NewWebhookTlsManagerGoalResolver(ctx, fake.NewSimpleClientset(), false, true).(*webhookTlsManagerGoalResolver).generateCertificates(ctx)
+			Expect(err).To(BeNil())
+		}
+	})
+
+	unmanagedSecret := func() *corev1.Secret {
+		secret := generateSecret(string(current.ServerCertPem), config.AppConfig.Namespace)
+		secret.Labels = map[string]string{"app.kubernetes.io/managed-by": "helm"}
+		secret.Data["caCert.pem"] = current.CaCertPem
+		secret.Data["caKey.pem"] = current.CaKeyPem
+		secret.Data["serverKey.pem"] = current.ServerKeyPem
+		return secret
+	}
+
+	It("adoption disabled", func() {
+		resolver := NewWebhookTlsManagerGoalResolver(ctx, fake.NewSimpleClientset(unmanagedSecret()), false, true)
+		goal, err := resolver.Resolve(ctx)
+		Expect(err).To(BeNil())
+		Expect(goal.AdoptSecret).To(BeFalse())
+		Expect(goal.SecretUnmanaged).To(BeTrue())
+	})
+
+	It("adopts a valid unmanaged secret", func() {
+		config.UpdateAdoptConfig(true)
+		resolver := NewWebhookTlsManagerGoalResolver(ctx, fake.NewSimpleClientset(unmanagedSecret()), false, true)
+		goal, err := resolver.Resolve(ctx)
+		Expect(err).To(BeNil())
+		Expect(goal.AdoptSecret).To(BeTrue())
+		Expect(goal.SecretUnmanaged).To(BeFalse())
+		Expect(goal.CertData).To(BeNil())
+	})
+
+	It("does not adopt a managed secret", func() {
+		config.UpdateAdoptConfig(true)
+		secret := unmanagedSecret()
+		secret.Labels = map[string]string{consts.ManagedLabelKey: consts.ManagedLabelValue}
+		resolver := NewWebhookTlsManagerGoalResolver(ctx, fake.NewSimpleClientset(secret), false, true).(*webhookTlsManagerGoalResolver)
+		adopt, err := resolver.shouldAdoptSecret(ctx)
+		Expect(err).To(BeNil())
+		Expect(adopt).To(BeFalse())
+	})
+
+	It("refuses a secret whose server certificate is not signed by its CA", func() {
+		config.UpdateAdoptConfig(true)
+		secret := unmanagedSecret()
+		other, _ := certificates.GetPEMCertificateString(time.Now().Add(time.Hour * 24 * 60))
+		secret.Data["serverCert.pem"] = []byte(other)
+		resolver := NewWebhookTlsManagerGoalResolver(ctx, fake.NewSimpleClientset(secret), false, true)
+		_, err := resolver.Resolve(ctx)
+		Expect(errors.Is(err, errdefs.ErrCertificateInvalid)).To(BeTrue())
+	})
+
+	It("refuses a secret without a CA key", func() {
+		config.UpdateAdoptConfig(true)
+		secret := unmanagedSecret()
+		delete(secret.Data, "caKey.pem")
+		resolver := NewWebhookTlsManagerGoalResolver(ctx, fake.NewSimpleClientset(secret), false, true)
+		_, err := resolver.Resolve(ctx)
+		Expect(errors.Is(err, errdefs.ErrCertificateInvalid)).To(BeTrue())
+	})
+})
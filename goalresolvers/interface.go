@@ -7,5 +7,5 @@ import (
 )
 
 type WebhookTlsManagerGoalResolverInterface interface {
-	Resolve(ctx context.Context) (goal *WebhookTlsManagerGoal, err *error)
+	Resolve(ctx context.Context) (goal *WebhookTlsManagerGoal, err error)
 }
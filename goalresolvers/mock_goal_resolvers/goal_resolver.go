@@ -36,11 +36,11 @@ func (m *MockWebhookTlsManagerGoalResolverInterface) EXPECT() *MockWebhookTlsMan
 }
 
 // Resolve mocks base method.
-func (m *MockWebhookTlsManagerGoalResolverInterface) Resolve(arg0 context.Context) (*goalresolvers.WebhookTlsManagerGoal, *error) {
+func (m *MockWebhookTlsManagerGoalResolverInterface) Resolve(arg0 context.Context) (*goalresolvers.WebhookTlsManagerGoal, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Resolve", arg0)
 	ret0, _ := ret[0].(*goalresolvers.WebhookTlsManagerGoal)
-	ret1, _ := ret[1].(*error)
+	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
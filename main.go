@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Azure/webhook-tls-manager/config"
 	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
 	"github.com/Azure/webhook-tls-manager/goalresolvers"
 	"github.com/Azure/webhook-tls-manager/metrics"
 	"github.com/Azure/webhook-tls-manager/reconcilers"
 	"github.com/Azure/webhook-tls-manager/toolkit/log"
+	"github.com/Azure/webhook-tls-manager/toolkit/retrypolicy"
 	"github.com/Azure/webhook-tls-manager/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -26,40 +35,342 @@ var (
 	objectName                 = flag.String("webhook-tls-manager-managed-object-name", "", "the name of the object to be reconciled")
 	caValidityYears            = flag.Int("ca-validity-years", 0, "the validity of the CA certificate in years")
 	serverValidityYears        = flag.Int("server-validity-years", 0, "the validity of the server certificate in years")
-	logLevel                   = flag.Int("log-level", 3, "log level")
+	logLevel                   = flag.String("log-level", "info", "log level: trace, debug, info, warning or error. 3, 4 and 5 are accepted for info, debug and trace")
+	logBackend                 = flag.String("log-backend", log.LogrusBackend, "log backend: logrus, slog or klog")
+	logFormat                  = flag.String("log-format", log.JSONFormat, "log format: json or text. klog only supports text")
+	retryMaxAttempts           = flag.Int("retry-max-attempts", retrypolicy.DefaultMaxAttempts, "the maximum number of reconcile attempts. at least 1")
+	resultFile                 = flag.String("result-file", "", "if set, the reconcile result is written to this file as JSON, also when the reconcile fails")
+	retryDeadline              = flag.Duration("retry-deadline", retrypolicy.DefaultDeadline, "the time after which no further reconcile attempt is started")
+	cleanupForce               = flag.Bool("cleanup-force", false, "if set to true, cleanup also deletes a secret or webhook not managed")
+	cleanupConfigMap           = flag.Bool("cleanup-configmap", false, "if set to true, cleanup also deletes the configmap holding the webhook configuration")
+	adopt                      = flag.Bool("adopt", false, "if set to true, a secret or webhook existing without the managed-by label is validated, labelled as managed and taken over")
+	profile                    = flag.String("profile", config.ProfileAKS, "how objects are marked as managed: aks, generic or custom")
+	managedLabelKey            = flag.String("managed-label-key", "", "the key of the label marking objects as managed. custom profile only")
+	managedLabelValue          = flag.String("managed-label-value", "", "the value of the label marking objects as managed. custom profile only")
+	acceptManagedValues        = flag.String("accept-managed-values", "", "comma separated further values of the managed label that mark objects as managed, e.g. the value of the previous profile")
+	admissionEnforcerLabel     = flag.Bool("admission-enforcer-label", false, "if set to true, the AKS admissions enforcer label exempts kube-system unless it is blocked. custom profile only")
+	extraLabels                = metadataFlag{}
+	extraAnnotations           = metadataFlag{}
+	excludedNamespaces         = listFlag{}
+	excludedObjectLabels       = metadataFlag{}
+	includeWebhookNamespace    = flag.Bool("include-webhook-namespace", false, "if set to true, the namespace of the webhook service is not excluded from the webhook")
+	forceConflicts             = flag.Bool("force-conflicts", false, "if set to true, the fields of the secret and webhook owned by other field managers are taken over instead of failing")
+	caBundleFlipThreshold      = flag.Int("cabundle-flip-threshold", config.DefaultCABundleFlipThreshold, "the number of consecutive runs finding the webhook caBundle changed by another field manager after which it is no longer written. 0 never stops")
+	verifyEndpoints            = flag.Bool("verify-endpoints", false, "if set to true, a reconcile verifies the certificates served by the endpoints of the webhook and warns about those not trusted")
+	resyncPeriod               = flag.Duration("resync-period", time.Minute, "the time between two reconciles of the controller command")
+	breakerThreshold           = flag.Duration("breaker-threshold", 0, "how long a webhook with failurePolicy Fail may have no ready endpoints or serve an untrusted certificate before its breaker opens. 0 disables the breaker. controller only")
+	breakerAction              = flag.String("breaker-action", string(config.BreakerActionIgnore), "what an open breaker does with the webhook: ignore switches its failurePolicy to Ignore, remove removes it")
+	readinessTimeout           = flag.Duration("readiness-timeout", 0, "if set, the webhook configuration is only created once the services of its webhooks have ready endpoints, waiting up to this long. 0 does not wait")
+	disableMode                = flag.String("disable-mode", string(config.DisableModeIgnore), "how the disable command takes the managed webhooks of this instance out of the request path: ignore switches their failurePolicy to Ignore, detach removes them")
+	orphanPolicy               = flag.String("orphan-policy", string(config.OrphanPolicyIgnore), "what to do with the secrets and webhooks of instances in the namespace whose configmap no longer exists: ignore, report or delete")
 )
 
+// shutdownTimeout bounds flushing traces and stopping the metrics server on exit.
+const shutdownTimeout = 5 * time.Second
+
+// Commands, given as the first argument after the flags. Without one, the job reconciles.
+const (
+	reconcileCommand = "reconcile"
+	rollbackCommand  = "rollback"
+	rotateCommand    = "rotate"
+	validateCommand  = "validate"
+	verifyCommand    = "verify"
+	probeCommand     = "probe"
+	// controllerCommand reconciles every --resync-period until SIGTERM instead of once.
+	controllerCommand = "controller"
+	// disableCommand takes the managed webhooks of this instance out of the request path, and
+	// enableCommand restores them.
+	disableCommand = "disable"
+	enableCommand  = "enable"
+)
+
+func init() {
+	flag.Var(extraLabels, "extra-label", "a key=value label added to the secret and the webhook. can be repeated")
+	flag.Var(extraAnnotations, "extra-annotation", "a key=value annotation added to the secret and the webhook. can be repeated")
+	flag.Var(&excludedNamespaces, "exclude-namespace", "a namespace excluded from every webhook through its namespaceSelector. can be repeated")
+	flag.Var(excludedObjectLabels, "exclude-object-label", "objects with this key=value label are excluded from every webhook through its objectSelector. can be repeated")
+}
+
 func main() {
 
 	flag.Parse()
+	command := flag.Arg(0)
+	var forcedRotation goalresolvers.ForcedRotation
+	switch command {
+	case "", reconcileCommand, rollbackCommand, validateCommand, verifyCommand, probeCommand, controllerCommand, disableCommand, enableCommand:
+	case rotateCommand:
+		var err error
+		if forcedRotation, err = parseRotateFlags(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q. expected %s, %s, %s, %s, %s, %s, %s, %s or %s\n", command, reconcileCommand, rollbackCommand, rotateCommand, validateCommand, verifyCommand, probeCommand, controllerCommand, disableCommand, enableCommand)
+		os.Exit(2)
+	}
+	policy, err := config.ParseOrphanPolicy(*orphanPolicy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	config.NewConfig()
 	config.UpdateConfig(*objectName, *caValidityYears, *serverValidityYears, *namespace)
-	logger := log.NewLogger(*logLevel)
-	ctx := logger.WithLogger(context.TODO())
-	var label prometheus.Labels
-	if *webhookTlsManagerEnabled {
+	if err := config.UpdateRetryConfig(*retryMaxAttempts, *retryDeadline); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	config.UpdateCleanupConfig(*cleanupForce, *cleanupConfigMap)
+	config.UpdateAdoptConfig(*adopt)
+	config.UpdateApplyConfig(*forceConflicts)
+	config.UpdateVerifyConfig(*verifyEndpoints)
+	config.UpdateOrphanConfig(policy)
+	var acceptedValues []string
+	if *acceptManagedValues != "" {
+		acceptedValues = strings.Split(*acceptManagedValues, ",")
+	}
+	if err := config.UpdateProfileConfig(*profile, *managedLabelKey, *managedLabelValue, acceptedValues, *admissionEnforcerLabel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := config.UpdateMetadataConfig(extraLabels, extraAnnotations); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := config.UpdateDriftConfig(*caBundleFlipThreshold); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *breakerThreshold != 0 && command != controllerCommand {
+		fmt.Fprintf(os.Stderr, "--breaker-threshold requires the %s command\n", controllerCommand)
+		os.Exit(2)
+	}
+	if *resyncPeriod <= 0 {
+		fmt.Fprintf(os.Stderr, "invalid resync period %s. expected more than 0\n", *resyncPeriod)
+		os.Exit(2)
+	}
+	if err := config.UpdateBreakerConfig(*breakerThreshold, *breakerAction); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := config.UpdateReadinessConfig(*readinessTimeout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := config.UpdateDisableConfig(*disableMode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := config.UpdateExclusionConfig(excludedNamespaces, excludedObjectLabels, *includeWebhookNamespace); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	level, err := log.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger, err := log.New(log.Options{Backend: *logBackend, Level: level, Format: *logFormat})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// SIGTERM (e.g. a Helm rollback deleting the job) cancels ctx. The reconciler stops retrying
+	// and finishes or rolls back an in-flight rotation before returning.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = logger.WithLogger(ctx)
+	ctx = log.WithFields(ctx, "object", config.AppConfig.ObjectName, "namespace", config.AppConfig.Namespace)
+	// Tracing is optional, a misconfigured exporter must not block the rotation of certificates.
+	shutdownTracer, err := log.InitTracerProvider(ctx, "webhook-tls-manager")
+	if err != nil {
+		logger.Warningf(ctx, "failed to initialize tracer provider, continuing without tracing: %s", err)
+		shutdownTracer = func(context.Context) error { return nil }
+	}
+	ctx = log.ContextWithTraceParent(ctx, os.Getenv("TRACEPARENT"))
+	job := consts.ReconciliationJob
+	if command == rollbackCommand {
+		logger.Info(ctx, "AKS Webhook TLS Manager Rollback Job")
+		job = consts.RollbackJob
+	} else if command == rotateCommand {
+		logger.Infof(ctx, "AKS Webhook TLS Manager Forced Rotation Job. scope: %s, reason: %s", forcedRotation.Scope, forcedRotation.Reason)
+		job = consts.ForcedRotationJob
+	} else if command == validateCommand {
+		logger.Info(ctx, "AKS Webhook TLS Manager Validation Job")
+		job = consts.ValidationJob
+	} else if command == verifyCommand {
+		logger.Info(ctx, "AKS Webhook TLS Manager Verification Job")
+		job = consts.VerificationJob
+	} else if command == probeCommand {
+		logger.Info(ctx, "AKS Webhook TLS Manager Probe Job")
+		job = consts.ProbeJob
+	} else if command == disableCommand {
+		logger.Infof(ctx, "AKS Webhook TLS Manager Disable Job. mode: %s", config.AppConfig.DisableMode)
+		job = consts.DisableJob
+	} else if command == enableCommand {
+		logger.Info(ctx, "AKS Webhook TLS Manager Enable Job")
+		job = consts.EnableJob
+	} else if command == controllerCommand {
+		logger.Infof(ctx, "AKS Webhook TLS Manager Controller. resync period: %s", *resyncPeriod)
+	} else if *webhookTlsManagerEnabled {
 		logger.Info(ctx, "AKS Webhook TLS Manager Reconciliation Job")
-		label = prometheus.Labels{"job": consts.ReconciliationJob}
 	} else {
 		logger.Info(ctx, "AKS Webhook TLS Manager Cleanup Job")
-		label = prometheus.Labels{"job": consts.CleanupJob}
+		job = consts.CleanupJob
 	}
 	kubeClient := getKubeClientFunc()
 	http.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr}
 	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Errorf(ctx, "failed to start http server: %s", err)
 		}
 	}()
 
-	webhookGoalResolver := goalresolvers.NewWebhookTlsManagerGoalResolver(ctx, kubeClient, *kubeSystemNamespaceBlocked, *webhookTlsManagerEnabled)
-	webhookTlsManagerReconciler := reconcilers.NewWebhookTlsManagerReconciler(webhookGoalResolver, kubeClient)
+	var result *reconcilers.Result
+	var cerr error
+	switch command {
+	case rollbackCommand:
+		result, cerr = reconcilers.Rollback(ctx, kubeClient, *kubeSystemNamespaceBlocked)
+	case validateCommand:
+		result, cerr = reconcilers.Validate(ctx, kubeClient, *kubeSystemNamespaceBlocked)
+	case verifyCommand:
+		result, cerr = reconcilers.Verify(ctx, kubeClient)
+	case probeCommand:
+		result, cerr = reconcilers.Probe(ctx, kubeClient)
+	case disableCommand:
+		result, cerr = reconcilers.Disable(ctx, kubeClient)
+	case enableCommand:
+		result, cerr = reconcilers.Enable(ctx, kubeClient)
+	case rotateCommand:
+		forcedGoalResolver := goalresolvers.NewForcedRotationGoalResolver(ctx, kubeClient, *kubeSystemNamespaceBlocked, forcedRotation)
+		result, cerr = reconcilers.NewWebhookTlsManagerReconciler(forcedGoalResolver, kubeClient).Reconcile(ctx)
+	case controllerCommand:
+		webhookGoalResolver := goalresolvers.NewWebhookTlsManagerGoalResolver(ctx, kubeClient, *kubeSystemNamespaceBlocked, *webhookTlsManagerEnabled)
+		runController(ctx, reconcilers.NewWebhookTlsManagerReconciler(webhookGoalResolver, kubeClient), *resyncPeriod, func(result *reconcilers.Result, err error) {
+			reportResult(ctx, job, result, err)
+		})
+	default:
+		webhookGoalResolver := goalresolvers.NewWebhookTlsManagerGoalResolver(ctx, kubeClient, *kubeSystemNamespaceBlocked, *webhookTlsManagerEnabled)
+		webhookTlsManagerReconciler := reconcilers.NewWebhookTlsManagerReconciler(webhookGoalResolver, kubeClient)
+		result, cerr = webhookTlsManagerReconciler.Reconcile(ctx)
+	}
+	// The controller reported each of its reconciles.
+	if result != nil {
+		reportResult(ctx, job, result, cerr)
+	}
 
-	cerr := webhookTlsManagerReconciler.Reconcile(ctx)
+	// ctx may already be cancelled, flush and stop within a short deadline of its own.
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	if err := shutdownTracer(shutdownCtx); err != nil {
+		logger.Warningf(ctx, "failed to flush traces: %s", err)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warningf(ctx, "failed to stop http server: %s", err)
+	}
 	if cerr != nil {
-		logger.Errorf(ctx, "WebhookTlsManagerReconciler failed. error: %s", *cerr)
+		cancel()
+		stop()
+		os.Exit(errdefs.ExitCode(cerr))
+	}
+}
+
+// reportResult logs the result of a job, writes it to --result-file and sets the job result metric.
+func reportResult(ctx context.Context, job string, result *reconcilers.Result, cerr error) {
+	logger := log.MustGetLogger(ctx)
+	logger.Infof(ctx, "reconcile result: rotated=%t, changed=%t, attempts=%d, warnings=%d", result.Rotated, result.Changed(), result.Attempts, len(result.Warnings))
+	for _, warning := range result.Warnings {
+		logger.Warning(ctx, warning)
+	}
+	if *resultFile != "" {
+		if err := writeResult(*resultFile, result); err != nil {
+			logger.Errorf(ctx, "failed to write result file %s: %s", *resultFile, err)
+		}
+	}
+	// A controller reports many results, so the reason of an earlier failure is cleared.
+	metrics.ResultMetric.Reset()
+	label := prometheus.Labels{"job": job, "reason": errdefs.Reason(cerr)}
+	if cerr != nil {
+		logger.Errorf(ctx, "%s job failed. reason: %s, error: %s", job, errdefs.Reason(cerr), cerr)
 		metrics.ResultMetric.With(label).Set(1)
-		os.Exit(1)
+	} else {
+		metrics.ResultMetric.With(label).Set(0)
+	}
+}
+
+// runController reconciles every period until ctx is cancelled and reports each reconcile. A
+// failed reconcile is retried at the next period, so the controller itself never fails.
+func runController(ctx context.Context, reconciler reconcilers.Reconciler, period time.Duration, report func(*reconcilers.Result, error)) {
+	logger := log.MustGetLogger(ctx)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		result, err := reconciler.Reconcile(ctx)
+		report(result, err)
+		select {
+		case <-ctx.Done():
+			logger.Info(ctx, "controller stopped.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseRotateFlags parses the flags following the rotate command.
+func parseRotateFlags(args []string) (goalresolvers.ForcedRotation, error) {
+	flags := flag.NewFlagSet(rotateCommand, flag.ExitOnError)
+	scope := flags.String("scope", string(goalresolvers.RotationScopeLeaf), "what to rotate: leaf, ca, or ca-revoke to also remove the replaced CA from the caBundle at once")
+	reason := flags.String("reason", "", "why the rotation is forced, e.g. an incident number. recorded on the secret and in an Event")
+	if err := flags.Parse(args); err != nil {
+		return goalresolvers.ForcedRotation{}, err
+	}
+	rotationScope, err := goalresolvers.ParseRotationScope(*scope)
+	if err != nil {
+		return goalresolvers.ForcedRotation{}, err
+	}
+	if *reason == "" {
+		return goalresolvers.ForcedRotation{}, fmt.Errorf("--reason is required for %s", rotateCommand)
+	}
+	return goalresolvers.ForcedRotation{Scope: rotationScope, Reason: *reason}, nil
+}
+
+// metadataFlag collects the key=value pairs of a repeated flag.
+type metadataFlag map[string]string
+
+func (f metadataFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f metadataFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[k] = v
+	return nil
+}
+
+// listFlag collects the values of a repeated flag.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func writeResult(path string, result *reconcilers.Result) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
 	}
-	metrics.ResultMetric.With(label).Set(0)
+	return os.WriteFile(path, append(data, '\n'), 0o644)
 }
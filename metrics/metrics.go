@@ -1,8 +1,17 @@
 package metrics
 
 import (
+	"crypto/x509"
+
 	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
 	"github.com/prometheus/client_golang/prometheus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	CACertificateLabelValue     = "ca"
+	ServerCertificateLabelValue = "server"
 )
 
 var (
@@ -10,9 +19,9 @@ var (
 		prometheus.GaugeOpts{
 			Subsystem: config.MetricsPrefix(),
 			Name:      "webhook_job_succeed",
-			Help:      "Result of webhook job, 1 is failed and 0 is successful",
+			Help:      "Result of webhook job, 1 is failed and 0 is successful. reason is none on success",
 		},
-		[]string{"job"},
+		[]string{"job", "reason"},
 	)
 	RotateCertificateMetric = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -21,9 +30,143 @@ var (
 			Help:      "Whether or not to rotate certificate, 0 is not rotate and 1 is rotate",
 		},
 	)
+	CertificateNotBeforeMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "certificate_not_before_timestamp_seconds",
+			Help:      "NotBefore of the managed certificate as a unix timestamp",
+		},
+		[]string{"certificate", "object", "namespace", "secret", "serial", "fingerprint"},
+	)
+	CertificateNotAfterMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "certificate_not_after_timestamp_seconds",
+			Help:      "NotAfter of the managed certificate as a unix timestamp",
+		},
+		[]string{"certificate", "object", "namespace", "secret", "serial", "fingerprint"},
+	)
+	CertificateRotationsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "certificate_rotations_total",
+			Help:      "Number of certificate rotations by reason",
+		},
+		[]string{"reason"},
+	)
+	ReconcileDurationMetric = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "reconcile_duration_seconds",
+			Help:      "Duration of the whole reconcile including retries",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+		},
+	)
+	APIErrorsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "api_errors_total",
+			Help:      "Number of failed Kubernetes API calls by verb and resource",
+		},
+		[]string{"verb", "resource"},
+	)
+	CABundleFlipsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "cabundle_flips_total",
+			Help:      "Number of runs that found the caBundle of the webhook changed by another field manager, by manager",
+		},
+		[]string{"manager"},
+	)
+	CABundleContestedMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "cabundle_contested",
+			Help:      "1 while the job stopped writing the caBundle of the webhook because another field manager keeps changing it",
+		},
+		[]string{"manager"},
+	)
+	WebhookBreakerOpenMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "webhook_breaker_open",
+			Help:      "1 while the breaker of the webhook is open because its backend is unhealthy",
+		},
+		[]string{"webhook"},
+	)
+	WebhookProbesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "webhook_probes_total",
+			Help:      "Number of AdmissionReview probes sent to the endpoints of the webhook, by webhook and status",
+		},
+		[]string{"webhook", "status"},
+	)
+	WebhookProbeDurationMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: config.MetricsPrefix(),
+			Name:      "webhook_probe_duration_seconds",
+			Help:      "Time the endpoints of the webhook took to answer an AdmissionReview probe",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		},
+		[]string{"webhook"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(RotateCertificateMetric)
 	prometheus.MustRegister(ResultMetric)
+	prometheus.MustRegister(CertificateNotBeforeMetric)
+	prometheus.MustRegister(CertificateNotAfterMetric)
+	prometheus.MustRegister(CertificateRotationsMetric)
+	prometheus.MustRegister(ReconcileDurationMetric)
+	prometheus.MustRegister(APIErrorsMetric)
+	prometheus.MustRegister(CABundleFlipsMetric)
+	prometheus.MustRegister(CABundleContestedMetric)
+	prometheus.MustRegister(WebhookBreakerOpenMetric)
+	prometheus.MustRegister(WebhookProbesMetric)
+	prometheus.MustRegister(WebhookProbeDurationMetric)
+}
+
+// RecordAPIError counts a failed Kubernetes API call. NotFound is an expected answer for
+// the get calls that decide between create and update, so it is not counted.
+func RecordAPIError(verb string, resource string, err error) {
+	if err == nil || k8serrors.IsNotFound(err) {
+		return
+	}
+	APIErrorsMetric.WithLabelValues(verb, resource).Inc()
+}
+
+// SetCABundleContested marks the caBundle as contested by manager, or clears the mark if
+// manager is empty.
+func SetCABundleContested(manager string) {
+	CABundleContestedMetric.Reset()
+	if manager != "" {
+		CABundleContestedMetric.WithLabelValues(manager).Set(1)
+	}
+}
+
+// SetWebhookBreakersOpen marks the breakers of webhooks as open and clears the others.
+func SetWebhookBreakersOpen(webhooks []string) {
+	WebhookBreakerOpenMetric.Reset()
+	for _, webhook := range webhooks {
+		WebhookBreakerOpenMetric.WithLabelValues(webhook).Set(1)
+	}
+}
+
+// SetCertificateInventory replaces the NotBefore/NotAfter series of the given certificate
+// ("ca" or "server"), so a rotated certificate does not leave its old serial behind.
+func SetCertificateInventory(certificate string, cert *x509.Certificate) {
+	CertificateNotBeforeMetric.DeletePartialMatch(prometheus.Labels{"certificate": certificate})
+	CertificateNotAfterMetric.DeletePartialMatch(prometheus.Labels{"certificate": certificate})
+	labels := prometheus.Labels{
+		"certificate": certificate,
+		"object":      config.AppConfig.ObjectName,
+		"namespace":   config.AppConfig.Namespace,
+		"secret":      config.SecretName(),
+		"serial":      cert.SerialNumber.Text(16),
+		"fingerprint": certificates.Fingerprint(cert),
+	}
+	CertificateNotBeforeMetric.With(labels).Set(float64(cert.NotBefore.Unix()))
+	CertificateNotAfterMetric.With(labels).Set(float64(cert.NotAfter.Unix()))
 }
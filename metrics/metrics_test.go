@@ -1,13 +1,19 @@
 package metrics
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestMetrics(t *testing.T) {
@@ -26,6 +32,44 @@ func TestMetrics(t *testing.T) {
 	assert.Equal(t, float64(1), metric.GetMetric()[0].GetGauge().GetValue())
 }
 
+func TestRecordAPIError(t *testing.T) {
+	RecordAPIError("get", "secrets", nil)
+	RecordAPIError("get", "secrets", k8serrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "test"))
+	assert.Equal(t, float64(0), testutil.ToFloat64(APIErrorsMetric.WithLabelValues("get", "secrets")))
+
+	RecordAPIError("get", "secrets", errors.New("get secrets error"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(APIErrorsMetric.WithLabelValues("get", "secrets")))
+}
+
+func TestSetCertificateInventory(t *testing.T) {
+	config.NewConfig()
+	notAfter := time.Now().Add(time.Hour * 24).Truncate(time.Second)
+	certPem, err := certificates.GetPEMCertificateString(notAfter)
+	require.NoError(t, err)
+	cert, err := certificates.ParsePEMCertificate([]byte(certPem))
+	require.NoError(t, err)
+
+	SetCertificateInventory(ServerCertificateLabelValue, cert)
+	labels := prometheus.Labels{
+		"certificate": ServerCertificateLabelValue,
+		"object":      config.AppConfig.ObjectName,
+		"namespace":   config.AppConfig.Namespace,
+		"secret":      config.SecretName(),
+		"serial":      cert.SerialNumber.Text(16),
+		"fingerprint": certificates.Fingerprint(cert),
+	}
+	assert.Equal(t, float64(notAfter.Unix()), testutil.ToFloat64(CertificateNotAfterMetric.With(labels)))
+
+	// a rotated certificate replaces the series of the old one
+	newCertPem, err := certificates.GetPEMCertificateString(notAfter.AddDate(1, 0, 0))
+	require.NoError(t, err)
+	newCert, err := certificates.ParsePEMCertificate([]byte(newCertPem))
+	require.NoError(t, err)
+	SetCertificateInventory(ServerCertificateLabelValue, newCert)
+	assert.Equal(t, 1, testutil.CollectAndCount(CertificateNotAfterMetric))
+	assert.Equal(t, 1, testutil.CollectAndCount(CertificateNotBeforeMetric))
+}
+
 func getMetrics(gather []*dto.MetricFamily, metricName string) *dto.MetricFamily {
 	for _, s := range gather {
 		if s.GetName() == metricName {
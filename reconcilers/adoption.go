@@ -0,0 +1,96 @@
+package reconcilers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// adoptionMetadata returns the labels that mark an object with meta as managed by this instance,
+// and the annotations recording the time of the adoption and the labels the object had before,
+// so the previous owner can be identified and restored.
+func adoptionMetadata(meta metav1.ObjectMeta) (map[string]string, map[string]string) {
+	previousLabels := meta.Labels
+	if previousLabels == nil {
+		previousLabels = map[string]string{}
+	}
+	encoded, _ := json.Marshal(previousLabels)
+	annotations := map[string]string{
+		consts.AdoptedAtAnnotation:         time.Now().UTC().Format(time.RFC3339),
+		consts.AdoptedFromLabelsAnnotation: string(encoded),
+	}
+	return withInstanceLabels(config.ManagedLabels()), annotations
+}
+
+// adoptSecret labels the secret as managed. The goal resolver validated its certificates.
+func adoptSecret(ctx context.Context, clientset kubernetes.Interface, result *Result) error {
+	logger := log.MustGetLogger(ctx)
+	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if getErr != nil {
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	if isManaged(secret.Labels) {
+		// Adopted by an earlier attempt.
+		return nil
+	}
+	if _, err := patchSecret(ctx, clientset, metadataFields(adoptionMetadata(secret.ObjectMeta))); err != nil {
+		return err
+	}
+	logger.Infof(ctx, "secret %s adopted.", config.SecretName())
+	result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionUpdated, "adopted")
+	return nil
+}
+
+// adoptWebhook labels the webhook as managed if it registers the same webhooks as the ConfigMap,
+// so an unrelated configuration that happens to have the same name is never taken over.
+func adoptWebhook(ctx context.Context, clientset kubernetes.Interface, result *Result, webhook *admissionregistration.MutatingWebhookConfiguration,
+	isKubeSystemNamespaceBlocked bool) (*admissionregistration.MutatingWebhookConfiguration, error) {
+	logger := log.MustGetLogger(ctx)
+	webhookFromCm, err := getMutatingWebhookConfigFromConfigmap(ctx, clientset, nil, isKubeSystemNamespaceBlocked)
+	if err != nil {
+		return nil, err
+	}
+	if current, expected := webhookNames(webhook), webhookNames(webhookFromCm); !reflect.DeepEqual(current, expected) {
+		err := &errdefs.ObjectError{Kind: webhookKind, Name: config.WebhookConfigName(), Reason: errdefs.ErrUnmanagedObject,
+			Err: fmt.Errorf("webhooks %v do not match the webhooks %v of the configmap", current, expected)}
+		logger.Errorf(ctx, "mutating webhook configuration %s cannot be adopted. error: %s", config.WebhookConfigName(), err)
+		return nil, err
+	}
+
+	var adopted *admissionregistration.MutatingWebhookConfiguration
+	if err := mergePatch(ctx, webhookKind, "mutatingwebhookconfigurations", webhook.Name, metadataFields(adoptionMetadata(webhook.ObjectMeta)),
+		func(ctx context.Context, patch []byte, opts metav1.PatchOptions) error {
+			var patchErr error
+			adopted, patchErr = clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Patch(ctx, webhook.Name, types.MergePatchType, patch, opts)
+			return patchErr
+		}); err != nil {
+		return nil, err
+	}
+	logger.Infof(ctx, "mutating webhook configuration %s adopted.", config.WebhookConfigName())
+	result.record(webhookKind, "", config.WebhookConfigName(), ActionUpdated, "adopted")
+	return adopted, nil
+}
+
+func webhookNames(webhook *admissionregistration.MutatingWebhookConfiguration) []string {
+	names := make([]string, 0, len(webhook.Webhooks))
+	for _, w := range webhook.Webhooks {
+		names = append(names, w.Name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,236 @@
+package reconcilers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	admissionregistrationv1apply "k8s.io/client-go/applyconfigurations/admissionregistration/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// apply server-side applies the fields of an object the job owns as consts.FieldManager by
+// calling applyFunc with the apply options. The apply is not forced, so fields set by other field
+// managers are never overwritten blindly. A conflict only with fields the job itself last wrote
+// through a create or update, e.g. before it used server-side apply or when it recorded the
+// rotation phase, is retried with force. A conflict with another field manager is an ObjectError
+// with the reason ErrFieldConflict naming the fields and their managers, unless
+// config.AppConfig.ForceConflicts is set.
+func apply(ctx context.Context, kind, resource, namespace, name string, applyFunc func(ctx context.Context, opts metav1.ApplyOptions) error) error {
+	logger := log.MustGetLogger(ctx)
+	force := config.AppConfig.ForceConflicts
+	applyErr := applyFunc(ctx, metav1.ApplyOptions{FieldManager: consts.FieldManager, Force: force})
+	if conflicts, ownOnly := fieldConflicts(applyErr); len(conflicts) > 0 && !force {
+		if !ownOnly {
+			logger.Errorf(ctx, "apply %s %s conflicts with other field managers: %s", kind, name, strings.Join(conflicts, "; "))
+			metrics.RecordAPIError("apply", resource, applyErr)
+			return &errdefs.ObjectError{Kind: kind, Namespace: namespace, Name: name, Reason: errdefs.ErrFieldConflict, Err: errors.New(strings.Join(conflicts, "; "))}
+		}
+		logger.Infof(ctx, "taking over the fields of %s %s last updated by %s.", kind, name, consts.FieldManager)
+		applyErr = applyFunc(ctx, metav1.ApplyOptions{FieldManager: consts.FieldManager, Force: true})
+	}
+	if applyErr != nil {
+		logger.Errorf(ctx, "apply %s %s failed. error: %s", kind, name, applyErr)
+		metrics.RecordAPIError("apply", resource, applyErr)
+		return errdefs.NewAPIError("apply", resource, name, applyErr)
+	}
+	return nil
+}
+
+// fieldConflicts describes the field manager conflicts of an apply error, and reports whether
+// all of them are with fields last updated by consts.FieldManager itself.
+func fieldConflicts(err error) ([]string, bool) {
+	var status k8serrors.APIStatus
+	if !k8serrors.IsConflict(err) || !errors.As(err, &status) || status.Status().Details == nil {
+		return nil, false
+	}
+	var conflicts []string
+	ownOnly := true
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		// The message is `conflict with "<manager>"`, followed by the API version and time for
+		// managers that wrote through an update.
+		var manager string
+		if _, scanErr := fmt.Sscanf(cause.Message, "conflict with %q", &manager); scanErr != nil || manager != consts.FieldManager {
+			ownOnly = false
+		}
+		conflicts = append(conflicts, fmt.Sprintf("%s: %s", cause.Field, cause.Message))
+	}
+	return conflicts, ownOnly
+}
+
+// removeFields removes the fields at paths, JSON pointers, from an object with a JSON patch that
+// only applies to resourceVersion. An apply only removes the fields its field manager owns, so
+// this removes those the job wants gone but does not own, e.g. set by an update of an older version.
+func removeFields(ctx context.Context, kind, resource, name, resourceVersion string, paths []string, patchFunc func(ctx context.Context, patch []byte) error) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	logger := log.MustGetLogger(ctx)
+	var ops []map[string]string
+	if resourceVersion != "" {
+		ops = append(ops, map[string]string{"op": "test", "path": "/metadata/resourceVersion", "value": resourceVersion})
+	}
+	for _, path := range paths {
+		ops = append(ops, map[string]string{"op": "remove", "path": path})
+	}
+	patch, _ := json.Marshal(ops)
+	if patchErr := patchFunc(ctx, patch); patchErr != nil {
+		logger.Errorf(ctx, "remove %v from %s %s failed. error: %s", paths, kind, name, patchErr)
+		metrics.RecordAPIError("patch", resource, patchErr)
+		return errdefs.NewAPIError("patch", resource, name, patchErr)
+	}
+	logger.Infof(ctx, "removed %v from %s %s.", paths, kind, name)
+	return nil
+}
+
+// mergePatch merges fields, a partial object, into an object as consts.FieldManager by calling
+// patchFunc with a JSON merge patch. Only the keys in fields are written and a nil value removes
+// its key, so unlike an update it keeps the fields of other actors and does not fail when the
+// object changed since it was read.
+func mergePatch(ctx context.Context, kind, resource, name string, fields map[string]interface{}, patchFunc func(ctx context.Context, patch []byte, opts metav1.PatchOptions) error) error {
+	patch, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if patchErr := patchFunc(ctx, patch, metav1.PatchOptions{FieldManager: consts.FieldManager}); patchErr != nil {
+		log.MustGetLogger(ctx).Errorf(ctx, "patch %s %s failed. error: %s", kind, name, patchErr)
+		metrics.RecordAPIError("patch", resource, patchErr)
+		return errdefs.NewAPIError("patch", resource, name, patchErr)
+	}
+	return nil
+}
+
+// metadataFields returns the fields of a merge patch setting labels and annotations.
+func metadataFields(labels, annotations map[string]string) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	return map[string]interface{}{"metadata": metadata}
+}
+
+// patchSecret merges fields into the secret of the instance, see mergePatch.
+func patchSecret(ctx context.Context, clientset kubernetes.Interface, fields map[string]interface{}) (*corev1.Secret, error) {
+	var patched *corev1.Secret
+	err := mergePatch(ctx, secretKind, "secrets", config.SecretName(), fields, func(ctx context.Context, patch []byte, opts metav1.PatchOptions) error {
+		var patchErr error
+		patched, patchErr = clientset.CoreV1().Secrets(config.AppConfig.Namespace).Patch(ctx, config.SecretName(), types.MergePatchType, patch, opts)
+		return patchErr
+	})
+	return patched, err
+}
+
+// jsonPointerToken escapes a map key for a JSON pointer.
+func jsonPointerToken(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// applySecret applies the labels, annotations and data of secret, which holds only the fields the
+// job owns. If revokePrevious is set, the previous-* keys are removed also if the job does not own them.
+func applySecret(ctx context.Context, clientset kubernetes.Interface, secret *corev1.Secret, revokePrevious bool) error {
+	client := clientset.CoreV1().Secrets(secret.Namespace)
+	applyConfig := corev1apply.Secret(secret.Name, secret.Namespace).
+		WithLabels(secret.Labels).
+		WithAnnotations(secret.Annotations).
+		WithData(secret.Data)
+	var applied *corev1.Secret
+	if err := apply(ctx, secretKind, "secrets", secret.Namespace, secret.Name, func(ctx context.Context, opts metav1.ApplyOptions) error {
+		var applyErr error
+		applied, applyErr = client.Apply(ctx, applyConfig, opts)
+		return applyErr
+	}); err != nil {
+		return err
+	}
+
+	var stale []string
+	if revokePrevious {
+		for _, key := range certificateKeys {
+			if _, ok := applied.Data[previousKeyPrefix+key]; ok {
+				stale = append(stale, "/data/"+jsonPointerToken(previousKeyPrefix+key))
+			}
+		}
+	}
+	return removeFields(ctx, secretKind, "secrets", secret.Name, applied.ResourceVersion, stale, func(ctx context.Context, patch []byte) error {
+		_, patchErr := client.Patch(ctx, secret.Name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: consts.FieldManager})
+		return patchErr
+	})
+}
+
+// webhookApplyConfiguration returns the apply configuration of the name, labels, annotations and
+// webhooks of webhookConfig.
+func webhookApplyConfiguration(webhookConfig *admissionregistration.MutatingWebhookConfiguration) (*admissionregistrationv1apply.MutatingWebhookConfigurationApplyConfiguration, error) {
+	applyConfig := admissionregistrationv1apply.MutatingWebhookConfiguration(webhookConfig.Name).
+		WithLabels(webhookConfig.Labels).
+		WithAnnotations(webhookConfig.Annotations)
+	for i := range webhookConfig.Webhooks {
+		// The apply configurations mirror the JSON of the API types.
+		encoded, err := json.Marshal(&webhookConfig.Webhooks[i])
+		if err != nil {
+			return nil, err
+		}
+		webhook := &admissionregistrationv1apply.MutatingWebhookApplyConfiguration{}
+		if err := json.Unmarshal(encoded, webhook); err != nil {
+			return nil, err
+		}
+		applyConfig.WithWebhooks(webhook)
+	}
+	return applyConfig, nil
+}
+
+// applyWebhookConfig applies webhookConfig, which holds only the fields the job owns, then removes
+// the webhooks and the admissions enforcer label it no longer declares also if the job does not
+// own them.
+func applyWebhookConfig(ctx context.Context, clientset kubernetes.Interface, webhookConfig *admissionregistration.MutatingWebhookConfiguration) error {
+	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	applyConfig, err := webhookApplyConfiguration(webhookConfig)
+	if err != nil {
+		return err
+	}
+	var applied *admissionregistration.MutatingWebhookConfiguration
+	if err := apply(ctx, webhookKind, "mutatingwebhookconfigurations", "", webhookConfig.Name, func(ctx context.Context, opts metav1.ApplyOptions) error {
+		var applyErr error
+		applied, applyErr = client.Apply(ctx, applyConfig, opts)
+		return applyErr
+	}); err != nil {
+		return err
+	}
+
+	var stale []string
+	if _, declared := webhookConfig.Labels[consts.AdmissionEnforcerDisabledLabel]; !declared && config.AppConfig.Profile.AdmissionEnforcerLabel {
+		if _, ok := applied.Labels[consts.AdmissionEnforcerDisabledLabel]; ok {
+			stale = append(stale, "/metadata/labels/"+jsonPointerToken(consts.AdmissionEnforcerDisabledLabel))
+		}
+	}
+	declaredNames := webhookNames(webhookConfig)
+	// Removed from the last index, so the indexes of the others stay valid.
+	for i := len(applied.Webhooks) - 1; i >= 0; i-- {
+		if !slices.Contains(declaredNames, applied.Webhooks[i].Name) {
+			stale = append(stale, fmt.Sprintf("/webhooks/%d", i))
+		}
+	}
+	return removeFields(ctx, webhookKind, "mutatingwebhookconfigurations", webhookConfig.Name, applied.ResourceVersion, stale, func(ctx context.Context, patch []byte) error {
+		_, patchErr := client.Patch(ctx, webhookConfig.Name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: consts.FieldManager})
+		return patchErr
+	})
+}
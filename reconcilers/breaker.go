@@ -0,0 +1,191 @@
+package reconcilers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// breakerEntry is the breaker of one webhook whose backend is unhealthy.
+type breakerEntry struct {
+	UnhealthySince time.Time `json:"unhealthySince"`
+	Reason         string    `json:"reason"`
+	// Open is true while config.AppConfig.BreakerAction is applied to the webhook.
+	Open bool `json:"open,omitempty"`
+}
+
+// breakerState holds the breakers of the webhooks with an unhealthy backend by webhook name. It
+// is kept on the webhook configuration in the consts.BreakerAnnotation annotation.
+type breakerState map[string]breakerEntry
+
+// open returns the sorted names of the webhooks whose breaker is open.
+func (s breakerState) open() []string {
+	var names []string
+	for name, entry := range s {
+		if entry.Open {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readBreakerState returns the breakers recorded on webhookConfig. An annotation that cannot be
+// parsed is treated as no breakers, so the webhook is restored to the ConfigMap policy.
+func readBreakerState(ctx context.Context, webhookConfig *admissionregistration.MutatingWebhookConfiguration) breakerState {
+	state := breakerState{}
+	value, ok := webhookConfig.Annotations[consts.BreakerAnnotation]
+	if !ok {
+		return state
+	}
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		log.MustGetLogger(ctx).Warningf(ctx, "parse annotation %s of mutating webhook configuration %s failed. ignoring it. error: %s", consts.BreakerAnnotation, webhookConfig.Name, err)
+		return breakerState{}
+	}
+	return state
+}
+
+// webhookHealth returns why the backend of webhook is unhealthy: it has no ready endpoints, or an
+// endpoint is unreachable or serves a certificate the caBundle of webhook does not trust. It
+// returns "" for a healthy backend.
+func webhookHealth(ctx context.Context, clientset kubernetes.Interface, webhook admissionregistration.MutatingWebhook) (string, error) {
+	serverName, addresses, err := webhookEndpoints(ctx, clientset, webhook.ClientConfig)
+	if err != nil {
+		return "", err
+	}
+	if len(addresses) == 0 {
+		return "no ready endpoints", nil
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(webhook.ClientConfig.CABundle)
+	for _, address := range addresses {
+		verification := verifyEndpoint(ctx, webhook.Name, address, serverName, roots, nil, nil)
+		if verification.Serving == ServingUnreachable {
+			return fmt.Sprintf("endpoint %s is unreachable: %s", address, verification.Error), nil
+		}
+		if !verification.Trusted {
+			return fmt.Sprintf("endpoint %s serves an untrusted certificate: %s", address, verification.Error), nil
+		}
+	}
+	return "", nil
+}
+
+// updateBreakers checks the backend of every webhook of declared, the configuration of the
+// ConfigMap, whose failurePolicy is Fail, so an unhealthy backend cannot lock the cluster up. A
+// breaker opens once the backend stayed unhealthy for config.AppConfig.BreakerThreshold, and
+// closes as soon as it is healthy again. Each transition is recorded with an Event on current.
+// The state is merged into the annotations of current, and returned along with whether a
+// breaker opened or closed, so the caller updates the webhook even if the ConfigMap did not change.
+func updateBreakers(ctx context.Context, clientset kubernetes.Interface, result *Result, current, declared *admissionregistration.MutatingWebhookConfiguration) (breakerState, bool, error) {
+	logger := log.MustGetLogger(ctx)
+	previous := readBreakerState(ctx, current)
+	state := breakerState{}
+	changed := false
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, webhook := range declared.Webhooks {
+		if webhook.FailurePolicy != nil && *webhook.FailurePolicy != admissionregistration.Fail {
+			continue
+		}
+		reason, err := webhookHealth(ctx, clientset, webhook)
+		if err != nil {
+			return nil, false, err
+		}
+		entry, tracked := previous[webhook.Name]
+		if reason == "" {
+			if entry.Open {
+				logger.Infof(ctx, "backend of webhook %s is healthy again. closing its breaker.", webhook.Name)
+				recordEvent(ctx, clientset, webhookReference(current), corev1.EventTypeNormal, "WebhookBreakerClosed",
+					"backend of webhook %s is healthy again. restored it as declared in the ConfigMap", webhook.Name)
+				changed = true
+			}
+			continue
+		}
+
+		if !tracked {
+			entry = breakerEntry{UnhealthySince: now}
+		}
+		entry.Reason = reason
+		if !entry.Open && now.Sub(entry.UnhealthySince) >= config.AppConfig.BreakerThreshold {
+			logger.Warningf(ctx, "backend of webhook %s is unhealthy since %s. opening its breaker. reason: %s", webhook.Name, entry.UnhealthySince.Format(time.RFC3339), reason)
+			recordEvent(ctx, clientset, webhookReference(current), corev1.EventTypeWarning, "WebhookBreakerOpened",
+				"backend of webhook %s is unhealthy since %s: %s. applied the breaker action %s until it recovers", webhook.Name, entry.UnhealthySince.Format(time.RFC3339), reason, config.AppConfig.BreakerAction)
+			entry.Open = true
+			changed = true
+		}
+		if entry.Open {
+			result.warn("breaker of webhook %s is open: %s", webhook.Name, reason)
+		} else {
+			result.warn("backend of webhook %s is unhealthy: %s", webhook.Name, reason)
+		}
+		state[webhook.Name] = entry
+	}
+	metrics.SetWebhookBreakersOpen(state.open())
+
+	if err := patchBreakerState(ctx, clientset, current, state); err != nil {
+		return nil, false, err
+	}
+	return state, changed, nil
+}
+
+// patchBreakerState merges state into the annotations of webhookConfig, or removes the annotation
+// if there are no breakers.
+func patchBreakerState(ctx context.Context, clientset kubernetes.Interface, webhookConfig *admissionregistration.MutatingWebhookConfiguration, state breakerState) error {
+	current, ok := webhookConfig.Annotations[consts.BreakerAnnotation]
+	var value interface{}
+	if len(state) > 0 {
+		encoded, _ := json.Marshal(state)
+		if ok && current == string(encoded) {
+			return nil
+		}
+		value = string(encoded)
+	} else if !ok {
+		return nil
+	}
+	patch, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{consts.BreakerAnnotation: value}}})
+	_, patchErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Patch(ctx, webhookConfig.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: consts.FieldManager})
+	if patchErr != nil {
+		log.MustGetLogger(ctx).Errorf(ctx, "patch breaker annotation of mutating webhook configuration %s failed. error: %s", webhookConfig.Name, patchErr)
+		metrics.RecordAPIError("patch", "mutatingwebhookconfigurations", patchErr)
+		return errdefs.NewAPIError("patch", "mutatingwebhookconfigurations", webhookConfig.Name, patchErr)
+	}
+	return nil
+}
+
+// applyBreakers applies config.AppConfig.BreakerAction to the webhooks of webhookConfig whose
+// breaker is open in state: their failurePolicy is switched to Ignore, or they are removed.
+func applyBreakers(ctx context.Context, webhookConfig *admissionregistration.MutatingWebhookConfiguration, state breakerState) {
+	open := state.open()
+	if len(open) == 0 {
+		return
+	}
+	log.MustGetLogger(ctx).Warningf(ctx, "breakers of webhooks %s are open. applying the breaker action %s.", strings.Join(open, ", "), config.AppConfig.BreakerAction)
+	if config.AppConfig.BreakerAction == config.BreakerActionRemove {
+		webhookConfig.Webhooks = slices.DeleteFunc(webhookConfig.Webhooks, func(webhook admissionregistration.MutatingWebhook) bool {
+			return slices.Contains(open, webhook.Name)
+		})
+		return
+	}
+	ignore := admissionregistration.Ignore
+	for i := range webhookConfig.Webhooks {
+		if slices.Contains(open, webhookConfig.Webhooks[i].Name) {
+			webhookConfig.Webhooks[i].FailurePolicy = &ignore
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package reconcilers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+const disabledReason = "disabled"
+
+// disabledState is a webhook configuration taken out of the request path by Disable.
+type disabledState struct {
+	Mode       config.DisableMode `json:"mode"`
+	DisabledAt time.Time          `json:"disabledAt"`
+	// Webhooks are the webhooks Enable restores.
+	Webhooks []admissionregistration.MutatingWebhook `json:"webhooks"`
+}
+
+// readDisabledState returns the state recorded on webhookConfig by Disable, or nil if it is not
+// disabled. An annotation that cannot be parsed is an ObjectError with the reason
+// ErrDisabledStateInvalid, as the webhooks to restore are lost.
+func readDisabledState(webhookConfig *admissionregistration.MutatingWebhookConfiguration) (*disabledState, error) {
+	value, ok := webhookConfig.Annotations[consts.DisabledAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	state := &disabledState{}
+	if err := json.Unmarshal([]byte(value), state); err != nil {
+		return nil, &errdefs.ObjectError{Kind: webhookKind, Name: webhookConfig.Name, Reason: errdefs.ErrDisabledStateInvalid,
+			Err: fmt.Errorf("parse annotation %s: %w", consts.DisabledAnnotation, err)}
+	}
+	return state, nil
+}
+
+// managedWebhookConfigs lists the webhook configurations of the cluster managed under the profile
+// by this instance, i.e. labelled with config.AppConfig.ObjectName.
+func managedWebhookConfigs(ctx context.Context, clientset kubernetes.Interface) ([]admissionregistration.MutatingWebhookConfiguration, error) {
+	selector := fmt.Sprintf("%s,%s=%s", config.AppConfig.Profile.ManagedLabelKey, consts.InstanceLabelKey, config.AppConfig.ObjectName)
+	webhooks, listErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if listErr != nil {
+		log.MustGetLogger(ctx).Errorf(ctx, "list mutating webhook configurations failed. error: %s", listErr)
+		metrics.RecordAPIError("list", "mutatingwebhookconfigurations", listErr)
+		return nil, errdefs.NewAPIError("list", "mutatingwebhookconfigurations", "", listErr)
+	}
+	var managed []admissionregistration.MutatingWebhookConfiguration
+	for _, webhook := range webhooks.Items {
+		if isManaged(webhook.Labels) {
+			managed = append(managed, webhook)
+		}
+	}
+	return managed, nil
+}
+
+// patchDisabledWebhooks replaces the webhooks of webhookConfig and sets the disabled annotation to
+// state, or removes it if state is nil, with a JSON patch that only applies to the version read.
+// It is a patch rather than an apply, so taking the webhooks out of the request path never fails
+// on fields owned by other field managers.
+func patchDisabledWebhooks(ctx context.Context, clientset kubernetes.Interface, webhookConfig *admissionregistration.MutatingWebhookConfiguration,
+	webhooks []admissionregistration.MutatingWebhook, state *disabledState) error {
+	if webhooks == nil {
+		webhooks = []admissionregistration.MutatingWebhook{}
+	}
+	var ops []map[string]interface{}
+	if webhookConfig.ResourceVersion != "" {
+		ops = append(ops, map[string]interface{}{"op": "test", "path": "/metadata/resourceVersion", "value": webhookConfig.ResourceVersion})
+	}
+	ops = append(ops, map[string]interface{}{"op": "add", "path": "/webhooks", "value": webhooks})
+	annotationPath := "/metadata/annotations/" + jsonPointerToken(consts.DisabledAnnotation)
+	if state != nil {
+		encoded, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		if webhookConfig.Annotations == nil {
+			ops = append(ops, map[string]interface{}{"op": "add", "path": "/metadata/annotations", "value": map[string]string{consts.DisabledAnnotation: string(encoded)}})
+		} else {
+			ops = append(ops, map[string]interface{}{"op": "add", "path": annotationPath, "value": string(encoded)})
+		}
+	} else if _, ok := webhookConfig.Annotations[consts.DisabledAnnotation]; ok {
+		ops = append(ops, map[string]interface{}{"op": "remove", "path": annotationPath})
+	}
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	_, patchErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Patch(ctx, webhookConfig.Name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: consts.FieldManager})
+	if patchErr != nil {
+		log.MustGetLogger(ctx).Errorf(ctx, "patch webhooks of mutating webhook configuration %s failed. error: %s", webhookConfig.Name, patchErr)
+		metrics.RecordAPIError("patch", "mutatingwebhookconfigurations", patchErr)
+		return errdefs.NewAPIError("patch", "mutatingwebhookconfigurations", webhookConfig.Name, patchErr)
+	}
+	return nil
+}
+
+// disableWebhooks returns webhooks taken out of the request path as mode says.
+func disableWebhooks(webhooks []admissionregistration.MutatingWebhook, mode config.DisableMode) []admissionregistration.MutatingWebhook {
+	if mode == config.DisableModeDetach {
+		return nil
+	}
+	ignore := admissionregistration.Ignore
+	disabled := make([]admissionregistration.MutatingWebhook, len(webhooks))
+	for i := range webhooks {
+		disabled[i] = *webhooks[i].DeepCopy()
+		disabled[i].FailurePolicy = &ignore
+	}
+	return disabled
+}
+
+// Disable takes the managed webhook configurations of this instance out of the request path as
+// config.AppConfig.DisableMode says, without touching the secrets. The webhooks it replaces are
+// recorded in the consts.DisabledAnnotation annotation, for Enable to restore. Configurations
+// already disabled are left as they are, so their recorded webhooks are kept.
+func Disable(ctx context.Context, clientset kubernetes.Interface) (*Result, error) {
+	ctx, span := log.StartSpan(ctx, "Disable", nil)
+	defer span.End()
+	ctx = log.WithFields(ctx, "component", "reconciler", "phase", "disable")
+	result := &Result{Attempts: 1}
+	err := disableAll(ctx, clientset, result)
+	span.SetStatus(err)
+	return result, err
+}
+
+func disableAll(ctx context.Context, clientset kubernetes.Interface, result *Result) error {
+	logger := log.MustGetLogger(ctx)
+	webhooks, err := managedWebhookConfigs(ctx, clientset)
+	if err != nil {
+		return err
+	}
+	mode := config.AppConfig.DisableMode
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		state, readErr := readDisabledState(webhook)
+		if readErr != nil {
+			return readErr
+		}
+		if state != nil {
+			logger.Infof(ctx, "mutating webhook configuration %s is already disabled since %s.", webhook.Name, state.DisabledAt.Format(time.RFC3339))
+			result.record(webhookKind, "", webhook.Name, ActionUnchanged, disabledReason)
+			continue
+		}
+		state = &disabledState{Mode: mode, DisabledAt: time.Now().UTC().Truncate(time.Second), Webhooks: webhook.Webhooks}
+		if err := patchDisabledWebhooks(ctx, clientset, webhook, disableWebhooks(webhook.Webhooks, mode), state); err != nil {
+			return err
+		}
+		logger.Warningf(ctx, "mutating webhook configuration %s disabled. mode: %s", webhook.Name, mode)
+		result.record(webhookKind, "", webhook.Name, ActionUpdated, disabledReason)
+		recordEvent(ctx, clientset, webhookReference(webhook), corev1.EventTypeWarning, "WebhookDisabled",
+			"mutating webhook configuration %s was disabled with mode %s. run the enable command to restore it", webhook.Name, mode)
+	}
+	return nil
+}
+
+// Enable restores the webhooks recorded by Disable on the disabled managed webhook
+// configurations of this instance and removes the consts.DisabledAnnotation annotation. With
+// config.AppConfig.ReadinessTimeout set, a configuration is only restored once the services of its
+// webhooks have ready endpoints.
+func Enable(ctx context.Context, clientset kubernetes.Interface) (*Result, error) {
+	ctx, span := log.StartSpan(ctx, "Enable", nil)
+	defer span.End()
+	ctx = log.WithFields(ctx, "component", "reconciler", "phase", "enable")
+	result := &Result{Attempts: 1}
+	err := enableAll(ctx, clientset, result)
+	span.SetStatus(err)
+	return result, err
+}
+
+func enableAll(ctx context.Context, clientset kubernetes.Interface, result *Result) error {
+	logger := log.MustGetLogger(ctx)
+	webhooks, err := managedWebhookConfigs(ctx, clientset)
+	if err != nil {
+		return err
+	}
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		state, readErr := readDisabledState(webhook)
+		if readErr != nil {
+			return readErr
+		}
+		if state == nil {
+			logger.Infof(ctx, "mutating webhook configuration %s is not disabled.", webhook.Name)
+			result.record(webhookKind, "", webhook.Name, ActionUnchanged, "")
+			continue
+		}
+		restored := webhook.DeepCopy()
+		restored.Webhooks = state.Webhooks
+		if err := waitForBackends(ctx, clientset, restored); err != nil {
+			return err
+		}
+		if err := patchDisabledWebhooks(ctx, clientset, webhook, state.Webhooks, nil); err != nil {
+			return err
+		}
+		logger.Infof(ctx, "mutating webhook configuration %s enabled. it was disabled since %s.", webhook.Name, state.DisabledAt.Format(time.RFC3339))
+		result.record(webhookKind, "", webhook.Name, ActionUpdated, "enabled")
+		recordEvent(ctx, clientset, webhookReference(webhook), corev1.EventTypeNormal, "WebhookEnabled",
+			"mutating webhook configuration %s was restored as before it was disabled at %s", webhook.Name, state.DisabledAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// updateDisabledWebhook is the reconcile of a webhook configuration disabled with state: its
+// webhooks are left out of the request path, and the webhooks recorded for Enable are kept as
+// they were when it was disabled, with only their caBundle following caCert, so Enable restores
+// webhooks that trust the current certificate.
+func updateDisabledWebhook(ctx context.Context, clientset kubernetes.Interface, result *Result, webhookConfig *admissionregistration.MutatingWebhookConfiguration,
+	state *disabledState, caCert []byte) error {
+	logger := log.MustGetLogger(ctx)
+	result.warn("mutating webhook configuration %s is disabled since %s. run the enable command to restore it", webhookConfig.Name, state.DisabledAt.Format(time.RFC3339))
+	changed := false
+	for i := range state.Webhooks {
+		if !bytes.Equal(state.Webhooks[i].ClientConfig.CABundle, caCert) {
+			state.Webhooks[i].ClientConfig.CABundle = caCert
+			changed = true
+		}
+	}
+	if !changed {
+		result.record(webhookKind, "", webhookConfig.Name, ActionUnchanged, disabledReason)
+		return nil
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// The fingerprint follows the caBundle Enable restores, so the restore is not taken for drift.
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]string{
+		consts.DisabledAnnotation:            string(encoded),
+		consts.CABundleFingerprintAnnotation: bundleFingerprint(caCert),
+	}}})
+	if err != nil {
+		return err
+	}
+	_, patchErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Patch(ctx, webhookConfig.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: consts.FieldManager})
+	if patchErr != nil {
+		logger.Errorf(ctx, "patch disabled annotation of mutating webhook configuration %s failed. error: %s", webhookConfig.Name, patchErr)
+		metrics.RecordAPIError("patch", "mutatingwebhookconfigurations", patchErr)
+		return errdefs.NewAPIError("patch", "mutatingwebhookconfigurations", webhookConfig.Name, patchErr)
+	}
+	logger.Infof(ctx, "mutating webhook configuration %s is disabled. updated the caBundle of the webhooks to restore.", webhookConfig.Name)
+	result.record(webhookKind, "", webhookConfig.Name, ActionUpdated, disabledReason)
+	return nil
+}
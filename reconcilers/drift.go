@@ -0,0 +1,149 @@
+package reconcilers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+const contestedReason = "contested"
+
+// caBundleFields is the part of the managed fields of a webhook configuration naming the caBundle.
+type caBundleFields struct {
+	Webhooks map[string]struct {
+		ClientConfig struct {
+			CABundle *struct{} `json:"f:caBundle"`
+		} `json:"f:clientConfig"`
+	} `json:"f:webhooks"`
+}
+
+// caBundleManagers returns the sorted field managers other than consts.FieldManager owning the
+// caBundle of a webhook of webhookConfig.
+func caBundleManagers(webhookConfig *admissionregistration.MutatingWebhookConfiguration) []string {
+	var managers []string
+	for _, entry := range webhookConfig.ManagedFields {
+		if entry.Manager == consts.FieldManager || entry.FieldsV1 == nil || slices.Contains(managers, entry.Manager) {
+			continue
+		}
+		var fields caBundleFields
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		for _, webhook := range fields.Webhooks {
+			if webhook.ClientConfig.CABundle != nil {
+				managers = append(managers, entry.Manager)
+				break
+			}
+		}
+	}
+	slices.Sort(managers)
+	return managers
+}
+
+// bundleFingerprint returns the hex SHA-256 of a caBundle.
+func bundleFingerprint(bundle []byte) string {
+	sum := sha256.Sum256(bundle)
+	return hex.EncodeToString(sum[:])
+}
+
+// trackCABundleDrift records on webhookConfig when another field manager, e.g. the cainjector of
+// cert-manager or a GitOps controller, changed its caBundle away from the one the job last wrote,
+// recorded in the consts.CABundleFingerprintAnnotation annotation, and counts the
+// consecutive runs finding it changed. Once config.AppConfig.CABundleFlipThreshold is reached, it
+// reports the webhook as contested with an Event, a metric and a warning, and returns true so the
+// caller stops writing the webhook instead of flip-flopping with the other manager. Removing the
+// consts.CABundleFlipsAnnotation annotation resumes writing it.
+func trackCABundleDrift(ctx context.Context, clientset kubernetes.Interface, result *Result, webhookConfig *admissionregistration.MutatingWebhookConfiguration) (bool, error) {
+	logger := log.MustGetLogger(ctx)
+	managers := caBundleManagers(webhookConfig)
+	// A webhook written before the fingerprint was recorded has no known bundle to drift from.
+	written, known := webhookConfig.Annotations[consts.CABundleFingerprintAnnotation]
+	drifted := false
+	for _, webhook := range webhookConfig.Webhooks {
+		if known && len(managers) > 0 && bundleFingerprint(webhook.ClientConfig.CABundle) != written {
+			drifted = true
+		}
+	}
+	_, tracked := webhookConfig.Annotations[consts.CABundleFlipsAnnotation]
+	if !drifted {
+		metrics.SetCABundleContested("")
+		if !tracked {
+			return false, nil
+		}
+		logger.Infof(ctx, "caBundle of mutating webhook configuration %s is no longer changed by other field managers.", webhookConfig.Name)
+		return false, patchDriftAnnotations(ctx, clientset, webhookConfig.Name, nil)
+	}
+
+	manager := strings.Join(managers, ",")
+	threshold := config.AppConfig.CABundleFlipThreshold
+	flips, _ := strconv.Atoi(webhookConfig.Annotations[consts.CABundleFlipsAnnotation])
+	if threshold > 0 && flips >= threshold {
+		logger.Warningf(ctx, "caBundle of mutating webhook configuration %s is contested by %s. not updating it.", webhookConfig.Name, manager)
+		metrics.SetCABundleContested(manager)
+		result.record(webhookKind, "", webhookConfig.Name, ActionSkipped, contestedReason)
+		result.warn("caBundle of mutating webhook configuration %s is contested by %s and was not updated", webhookConfig.Name, manager)
+		return true, nil
+	}
+
+	flips++
+	logger.Warningf(ctx, "caBundle of mutating webhook configuration %s was changed by %s. %d consecutive runs found it changed.", webhookConfig.Name, manager, flips)
+	metrics.CABundleFlipsMetric.WithLabelValues(manager).Inc()
+	result.warn("caBundle of mutating webhook configuration %s was changed by %s", webhookConfig.Name, manager)
+	if err := patchDriftAnnotations(ctx, clientset, webhookConfig.Name, map[string]string{
+		consts.CABundleFlipsAnnotation:       strconv.Itoa(flips),
+		consts.CABundleFlipManagerAnnotation: manager,
+		consts.CABundleLastFlipAnnotation:    time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return false, err
+	}
+	if threshold == 0 || flips < threshold {
+		return false, nil
+	}
+
+	logger.Warningf(ctx, "caBundle of mutating webhook configuration %s was changed by %s in %d consecutive runs. no longer updating it.", webhookConfig.Name, manager, flips)
+	metrics.SetCABundleContested(manager)
+	recordEvent(ctx, clientset, webhookReference(webhookConfig), corev1.EventTypeWarning, "CABundleContested",
+		"caBundle was changed by %s in %d consecutive runs. it is no longer updated until the %s annotation is removed", manager, flips, consts.CABundleFlipsAnnotation)
+	result.record(webhookKind, "", webhookConfig.Name, ActionSkipped, contestedReason)
+	result.warn("caBundle of mutating webhook configuration %s is contested by %s and was not updated", webhookConfig.Name, manager)
+	return true, nil
+}
+
+// patchDriftAnnotations sets the drift annotations of the webhook to annotations, or removes
+// them if annotations is nil. They are merged rather than applied, so a webhook update that
+// fails on a conflict keeps them.
+func patchDriftAnnotations(ctx context.Context, clientset kubernetes.Interface, name string, annotations map[string]string) error {
+	values := map[string]interface{}{
+		consts.CABundleFlipsAnnotation:       nil,
+		consts.CABundleFlipManagerAnnotation: nil,
+		consts.CABundleLastFlipAnnotation:    nil,
+	}
+	for k, v := range annotations {
+		values[k] = v
+	}
+	patch, _ := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": values}})
+	_, patchErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: consts.FieldManager})
+	if patchErr != nil {
+		log.MustGetLogger(ctx).Errorf(ctx, "patch drift annotations of mutating webhook configuration %s failed. error: %s", name, patchErr)
+		metrics.RecordAPIError("patch", "mutatingwebhookconfigurations", patchErr)
+		return errdefs.NewAPIError("patch", "mutatingwebhookconfigurations", name, patchErr)
+	}
+	return nil
+}
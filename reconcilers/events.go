@@ -0,0 +1,83 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/goalresolvers"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// eventSource is the component reported on the Events of this tool.
+const eventSource = "webhook-tls-manager"
+
+// recordEvent creates an Event on the object. Events are informational, so failures are logged
+// and never fail the caller.
+func recordEvent(ctx context.Context, clientset kubernetes.Interface, object corev1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	logger := log.MustGetLogger(ctx)
+	namespace := object.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		// Named like the events of the client-go event recorder.
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", object.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        fmt.Sprintf(messageFmt, args...),
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := clientset.CoreV1().Events(namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		logger.Warningf(ctx, "create event %s on %s %s failed. error: %s", reason, object.Kind, object.Name, err)
+		metrics.RecordAPIError("create", "events", err)
+	}
+}
+
+// recordForcedRotationCompleted creates the Event closing a forced rotation on the secret.
+func recordForcedRotationCompleted(ctx context.Context, clientset kubernetes.Interface, forced *goalresolvers.ForcedRotation) {
+	secret, err := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if err != nil {
+		log.MustGetLogger(ctx).Warningf(ctx, "get secret %s for the forced rotation event failed. error: %s", config.SecretName(), err)
+		metrics.RecordAPIError("get", "secrets", err)
+		return
+	}
+	recordEvent(ctx, clientset, secretReference(secret), corev1.EventTypeNormal, "ForcedRotationCompleted", "forced rotation of scope %s completed. reason: %s", forced.Scope, forced.Reason)
+}
+
+// secretReference returns the reference of secret for its Events.
+func secretReference(secret *corev1.Secret) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		Kind:            secretKind,
+		APIVersion:      "v1",
+		Namespace:       secret.Namespace,
+		Name:            secret.Name,
+		UID:             secret.UID,
+		ResourceVersion: secret.ResourceVersion,
+	}
+}
+
+// webhookReference returns the reference of webhookConfig for its Events.
+func webhookReference(webhookConfig *admissionregistration.MutatingWebhookConfiguration) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		Kind:            webhookKind,
+		APIVersion:      "admissionregistration.k8s.io/v1",
+		Name:            webhookConfig.Name,
+		UID:             webhookConfig.UID,
+		ResourceVersion: webhookConfig.ResourceVersion,
+	}
+}
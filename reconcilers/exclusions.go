@@ -0,0 +1,69 @@
+package reconcilers
+
+import (
+	"sort"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Azure/webhook-tls-manager/config"
+)
+
+// injectExclusions merges the excluded namespaces and object labels into the selectors of every
+// webhook. Besides the configured namespaces, kube-system is excluded if it is blocked, and the
+// namespace of the webhook service, kube-system included, is excluded unless
+// config.AppConfig.IncludeWebhookNamespace is set, so a webhook does not intercept the requests
+// that would bring its own backend back.
+func injectExclusions(webhookConfig *admissionregistration.MutatingWebhookConfiguration, isKubeSystemNamespaceBlocked bool) {
+	for i := range webhookConfig.Webhooks {
+		webhook := &webhookConfig.Webhooks[i]
+		namespaces := append([]string{}, config.AppConfig.ExcludedNamespaces...)
+		if isKubeSystemNamespaceBlocked {
+			namespaces = append(namespaces, metav1.NamespaceSystem)
+		}
+		if service := webhook.ClientConfig.Service; service != nil && !config.AppConfig.IncludeWebhookNamespace {
+			namespaces = append(namespaces, service.Namespace)
+		}
+		webhook.NamespaceSelector = excludeValues(webhook.NamespaceSelector, corev1.LabelMetadataName, namespaces)
+		for key, value := range config.AppConfig.ExcludedObjectLabels {
+			webhook.ObjectSelector = excludeValues(webhook.ObjectSelector, key, []string{value})
+		}
+	}
+}
+
+// excludeValues adds values to the NotIn requirement on key of selector, adding the requirement
+// if there is none. Values stay sorted and unique, so injecting again changes nothing.
+func excludeValues(selector *metav1.LabelSelector, key string, values []string) *metav1.LabelSelector {
+	if len(values) == 0 {
+		return selector
+	}
+	if selector == nil {
+		selector = &metav1.LabelSelector{}
+	}
+	for i, requirement := range selector.MatchExpressions {
+		if requirement.Key == key && requirement.Operator == metav1.LabelSelectorOpNotIn {
+			selector.MatchExpressions[i].Values = sortedUnion(requirement.Values, values)
+			return selector
+		}
+	}
+	selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      key,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   sortedUnion(nil, values),
+	})
+	return selector
+}
+
+func sortedUnion(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	union := make([]string, 0, len(a)+len(b))
+	for _, value := range append(append([]string{}, a...), b...) {
+		if !seen[value] {
+			seen[value] = true
+			union = append(union, value)
+		}
+	}
+	sort.Strings(union)
+	return union
+}
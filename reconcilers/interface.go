@@ -5,5 +5,5 @@ import (
 )
 
 type Reconciler interface {
-	Reconcile(ctx context.Context) *error
+	Reconcile(ctx context.Context) (*Result, error)
 }
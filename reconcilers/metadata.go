@@ -0,0 +1,34 @@
+package reconcilers
+
+import (
+	"github.com/Azure/webhook-tls-manager/config"
+)
+
+// mergeMetadata returns a copy of current with the entries of desired added or replaced, so
+// labels and annotations set by others are kept.
+func mergeMetadata(current, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(desired))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range desired {
+		merged[k] = v
+	}
+	return merged
+}
+
+// containsMetadata reports whether current holds every entry of desired.
+func containsMetadata(current, desired map[string]string) bool {
+	for k, v := range desired {
+		if cv, ok := current[k]; !ok || cv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// secretLabels returns the labels of a managed secret: the extra labels, overridden by the
+// managed label and the labels of this instance.
+func secretLabels() map[string]string {
+	return withInstanceLabels(mergeMetadata(config.AppConfig.ExtraLabels, config.ManagedLabels()))
+}
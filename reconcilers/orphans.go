@@ -0,0 +1,180 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+const orphanedReason = "orphaned"
+
+// withInstanceLabels returns a copy of labels with the labels of this instance added.
+func withInstanceLabels(labels map[string]string) map[string]string {
+	return mergeMetadata(labels, config.InstanceLabels())
+}
+
+// labelSecret adds the labels of this instance and the extra labels and annotations to a managed
+// secret that misses them, e.g. one created before they were configured, so the sweep of another
+// instance can find it once this instance is renamed.
+func labelSecret(ctx context.Context, clientset kubernetes.Interface, result *Result) error {
+	logger := log.MustGetLogger(ctx)
+	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(getErr) {
+		return nil
+	}
+	if getErr != nil {
+		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	if !isManaged(secret.Labels) ||
+		containsMetadata(secret.Labels, secretLabels()) && containsMetadata(secret.Annotations, config.AppConfig.ExtraAnnotations) {
+		return nil
+	}
+	if _, err := patchSecret(ctx, clientset, metadataFields(secretLabels(), config.AppConfig.ExtraAnnotations)); err != nil {
+		return err
+	}
+	logger.Infof(ctx, "secret %s labelled.", config.SecretName())
+	result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionUpdated, "labelled")
+	return nil
+}
+
+// managedValues returns the managed value of the profile and its accepted values, as the values
+// of a set-based label selector.
+func managedValues() string {
+	return strings.Join(append([]string{config.AppConfig.Profile.ManagedLabelValue}, config.AppConfig.Profile.AcceptedManagedValues...), ",")
+}
+
+// orphanSelector selects the managed objects of the other instances in the namespace, labelled
+// with the managed value of the profile or one of its accepted values.
+func orphanSelector() string {
+	return fmt.Sprintf("%s in (%s),%s=%s,%s,%s!=%s",
+		config.AppConfig.Profile.ManagedLabelKey, managedValues(),
+		consts.OwnerNamespaceLabelKey, config.AppConfig.Namespace,
+		consts.InstanceLabelKey, consts.InstanceLabelKey, config.AppConfig.ObjectName)
+}
+
+// unlabelledSelector selects the managed objects without the instance label, created before the
+// instance labels were added.
+func unlabelledSelector() string {
+	return fmt.Sprintf("%s in (%s),!%s", config.AppConfig.Profile.ManagedLabelKey, managedValues(), consts.InstanceLabelKey)
+}
+
+// servesNamespace reports whether a webhook of webhook is served from the namespace of this
+// instance, which tells the namespace of a webhook without the owner namespace label.
+func servesNamespace(webhook admissionregistration.MutatingWebhookConfiguration) bool {
+	for _, w := range webhook.Webhooks {
+		if w.ClientConfig.Service != nil && w.ClientConfig.Service.Namespace == config.AppConfig.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// sweepOrphans finds the webhooks and secrets of the other instances in the namespace whose
+// ConfigMap no longer exists, e.g. after the managed object name of a chart changed, and reports
+// or deletes them as config.AppConfig.OrphanPolicy says. Webhooks are deleted before secrets, as
+// on cleanup. Managed objects without the instance label are told apart by their names, and a
+// webhook by the namespace of its service, so they are only reported, never deleted.
+func sweepOrphans(ctx context.Context, clientset kubernetes.Interface, result *Result) error {
+	if config.AppConfig.OrphanPolicy == config.OrphanPolicyIgnore {
+		return nil
+	}
+	logger := log.MustGetLogger(ctx)
+
+	webhookClient := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	for _, selector := range []string{orphanSelector(), unlabelledSelector()} {
+		webhooks, listErr := webhookClient.List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if listErr != nil {
+			logger.Errorf(ctx, "list mutating webhook configurations failed. error: %s", listErr)
+			metrics.RecordAPIError("list", "mutatingwebhookconfigurations", listErr)
+			return errdefs.NewAPIError("list", "mutatingwebhookconfigurations", "", listErr)
+		}
+		for _, webhook := range webhooks.Items {
+			instance, labelled := webhook.Labels[consts.InstanceLabelKey]
+			deleteFunc := webhookClient.Delete
+			if !labelled {
+				var ok bool
+				if instance, ok = config.WebhookConfigInstance(webhook.Name); !ok || instance == config.AppConfig.ObjectName || !servesNamespace(webhook) {
+					continue
+				}
+				deleteFunc = nil
+			}
+			if err := sweepOrphan(ctx, clientset, result, webhookKind, "mutatingwebhookconfigurations", "", webhook.Name, webhook.UID,
+				instance, deleteFunc); err != nil {
+				return err
+			}
+		}
+	}
+
+	secretClient := clientset.CoreV1().Secrets(config.AppConfig.Namespace)
+	for _, selector := range []string{orphanSelector(), unlabelledSelector()} {
+		secrets, listErr := secretClient.List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if listErr != nil {
+			logger.Errorf(ctx, "list secrets failed. error: %s", listErr)
+			metrics.RecordAPIError("list", "secrets", listErr)
+			return errdefs.NewAPIError("list", "secrets", "", listErr)
+		}
+		for _, secret := range secrets.Items {
+			instance, labelled := secret.Labels[consts.InstanceLabelKey]
+			deleteFunc := secretClient.Delete
+			if !labelled {
+				var ok bool
+				if instance, ok = config.SecretInstance(secret.Name); !ok || instance == config.AppConfig.ObjectName {
+					continue
+				}
+				deleteFunc = nil
+			}
+			if err := sweepOrphan(ctx, clientset, result, secretKind, "secrets", secret.Namespace, secret.Name, secret.UID,
+				instance, deleteFunc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sweepOrphan reports or deletes the object of instance if the ConfigMap of instance is gone. A nil
+// deleteFunc marks an object told apart by its name only, which is reported whatever the policy.
+func sweepOrphan(ctx context.Context, clientset kubernetes.Interface, result *Result, kind, resource, namespace, name string, uid types.UID,
+	instance string, deleteFunc func(ctx context.Context, name string, opts metav1.DeleteOptions) error) error {
+	logger := log.MustGetLogger(ctx)
+	configMapName := config.InstanceConfigMapName(instance)
+	_, getErr := clientset.CoreV1().ConfigMaps(config.AppConfig.Namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if getErr == nil {
+		logger.Debugf(ctx, "%s %s belongs to instance %s, which is still configured.", kind, name, instance)
+		return nil
+	}
+	if !k8serrors.IsNotFound(getErr) {
+		logger.Errorf(ctx, "get configmap %s failed. error: %s", configMapName, getErr)
+		metrics.RecordAPIError("get", "configmaps", getErr)
+		return errdefs.NewAPIError("get", "configmaps", configMapName, getErr)
+	}
+
+	if deleteFunc == nil {
+		logger.Warningf(ctx, "found %s %s without the instance label, named after instance %s, which is no longer configured.", kind, name, instance)
+		result.record(kind, namespace, name, ActionSkipped, orphanedReason)
+		result.warn("%s %s has no instance label and is named after instance %s, whose configmap %s no longer exists", kind, name, instance, configMapName)
+		return nil
+	}
+	if config.AppConfig.OrphanPolicy == config.OrphanPolicyDelete {
+		logger.Warningf(ctx, "deleting %s %s of instance %s, which is no longer configured.", kind, name, instance)
+		return deleteObject(ctx, result, kind, resource, namespace, name, uid, orphanedReason, deleteFunc)
+	}
+	logger.Warningf(ctx, "found %s %s of instance %s, which is no longer configured.", kind, name, instance)
+	result.record(kind, namespace, name, ActionSkipped, orphanedReason)
+	result.warn("%s %s belongs to instance %s, whose configmap %s no longer exists", kind, name, instance, configMapName)
+	return nil
+}
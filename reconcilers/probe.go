@@ -0,0 +1,332 @@
+package reconcilers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// ProbeStatus is the outcome of sending an AdmissionReview to one endpoint of a webhook.
+type ProbeStatus string
+
+const (
+	ProbeSucceeded       ProbeStatus = "succeeded"
+	ProbeUnreachable     ProbeStatus = "unreachable"
+	ProbeTimedOut        ProbeStatus = "timed_out"
+	ProbeInvalidResponse ProbeStatus = "invalid_response"
+)
+
+const (
+	// probeObjectName is the name of the synthetic object of a probe.
+	probeObjectName = "webhook-tls-manager-probe"
+	// defaultWebhookTimeout is the timeout the API server uses for a webhook without timeoutSeconds.
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+// WebhookProbe is the result of sending an AdmissionReview to one endpoint of a webhook.
+type WebhookProbe struct {
+	Webhook   string      `json:"webhook"`
+	Address   string      `json:"address"`
+	Resource  string      `json:"resource"`
+	Operation string      `json:"operation"`
+	UID       string      `json:"uid"`
+	Status    ProbeStatus `json:"status"`
+	// Allowed is the answer of the webhook. A webhook denying the synthetic object still answered
+	// correctly.
+	Allowed        bool    `json:"allowed"`
+	LatencySeconds float64 `json:"latencySeconds"`
+	TimeoutSeconds float64 `json:"timeoutSeconds"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// probeWebhooks sends a synthetic admission.k8s.io/v1 AdmissionReview matching the first rule of
+// every webhook to each of its ready endpoints, the way the API server would with the caBundle of
+// the webhook, and adds the outcome to the result. A response must echo the UID of the request in
+// a well-formed AdmissionReview within the timeoutSeconds of the webhook. The review is a dry run,
+// so a webhook with side effects can skip them. A webhook without ready endpoints or not accepting
+// v1 reviews is a warning; every failed probe is returned as a problem.
+func probeWebhooks(ctx context.Context, clientset kubernetes.Interface, result *Result) ([]string, error) {
+	logger := log.MustGetLogger(ctx)
+	webhookConfig, getErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+	if getErr != nil {
+		logger.Errorf(ctx, "get mutating webhook configuration %s failed. error: %s", config.WebhookConfigName(), getErr)
+		metrics.RecordAPIError("get", "mutatingwebhookconfigurations", getErr)
+		return nil, errdefs.NewAPIError("get", "mutatingwebhookconfigurations", config.WebhookConfigName(), getErr)
+	}
+
+	var problems []string
+	for _, webhook := range webhookConfig.Webhooks {
+		if !slices.Contains(webhook.AdmissionReviewVersions, admissionv1.SchemeGroupVersion.Version) {
+			logger.Warningf(ctx, "webhook %s does not accept %s reviews. not probing it.", webhook.Name, admissionv1.SchemeGroupVersion)
+			result.warn("webhook %s does not accept %s reviews and was not probed", webhook.Name, admissionv1.SchemeGroupVersion)
+			continue
+		}
+		if len(webhook.Rules) == 0 {
+			result.warn("webhook %s has no rules to probe", webhook.Name)
+			continue
+		}
+		serverName, addresses, err := webhookEndpoints(ctx, clientset, webhook.ClientConfig)
+		if err != nil {
+			return nil, err
+		}
+		if len(addresses) == 0 {
+			logger.Warningf(ctx, "webhook %s has no ready endpoints to probe.", webhook.Name)
+			result.warn("webhook %s has no ready endpoints to probe", webhook.Name)
+			continue
+		}
+		path, query := webhookPath(webhook.ClientConfig)
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(webhook.ClientConfig.CABundle)
+		for _, address := range addresses {
+			review := probeReview(ctx, clientset, webhook)
+			probe := probeEndpoint(ctx, webhook, review, &url.URL{Scheme: "https", Host: address, Path: path, RawQuery: query}, serverName, roots)
+			metrics.WebhookProbesMetric.WithLabelValues(webhook.Name, string(probe.Status)).Inc()
+			if probe.Status != ProbeUnreachable {
+				metrics.WebhookProbeDurationMetric.WithLabelValues(webhook.Name).Observe(probe.LatencySeconds)
+			}
+			result.Probes = append(result.Probes, probe)
+			if probe.Status != ProbeSucceeded {
+				problems = append(problems, fmt.Sprintf("probe of endpoint %s of webhook %s %s: %s", address, webhook.Name, probe.Status, probe.Error))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// webhookPath returns the path and query the API server sends reviews of the webhook to.
+func webhookPath(clientConfig admissionregistration.WebhookClientConfig) (string, string) {
+	if clientConfig.URL != nil {
+		// An unparsable url has no endpoints, so it is never probed.
+		u, _ := url.Parse(*clientConfig.URL)
+		if u != nil {
+			return u.Path, u.RawQuery
+		}
+	}
+	if clientConfig.Service != nil && clientConfig.Service.Path != nil {
+		return *clientConfig.Service.Path, ""
+	}
+	return "/", ""
+}
+
+// probeReview builds a dry-run AdmissionReview of a synthetic object matching the first rule of
+// webhook. Wildcards select the CREATE operation and the core v1 pods. The object carries the
+// labels the object selector of the webhook matches, and its kind is looked up through discovery.
+func probeReview(ctx context.Context, clientset kubernetes.Interface, webhook admissionregistration.MutatingWebhook) *admissionv1.AdmissionReview {
+	rule := webhook.Rules[0]
+	operation := admissionv1.Create
+	if len(rule.Operations) > 0 && !slices.Contains(rule.Operations, admissionregistration.Create) && !slices.Contains(rule.Operations, admissionregistration.OperationAll) {
+		operation = admissionv1.Operation(rule.Operations[0])
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	if len(rule.APIGroups) > 0 && rule.APIGroups[0] != "*" {
+		gvr.Group = rule.APIGroups[0]
+	}
+	if len(rule.APIVersions) > 0 && rule.APIVersions[0] != "*" {
+		gvr.Version = rule.APIVersions[0]
+	}
+	var subResource string
+	if len(rule.Resources) > 0 {
+		resource, sub, _ := strings.Cut(rule.Resources[0], "/")
+		if resource != "*" {
+			gvr.Resource = resource
+		}
+		if sub != "*" {
+			subResource = sub
+		}
+	}
+	gvk := gvr.GroupVersion().WithKind("")
+	if resources, err := clientset.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String()); err == nil {
+		for _, apiResource := range resources.APIResources {
+			if apiResource.Name == gvr.Resource {
+				gvk.Kind = apiResource.Kind
+			}
+		}
+	} else {
+		log.MustGetLogger(ctx).Infof(ctx, "kind of %s not found. probing without it. error: %s", gvr, err)
+	}
+	namespace := metav1.NamespaceDefault
+	if rule.Scope != nil && *rule.Scope == admissionregistration.ClusterScope {
+		namespace = ""
+	}
+	var labels map[string]string
+	if webhook.ObjectSelector != nil {
+		labels = webhook.ObjectSelector.MatchLabels
+	}
+	object, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": gvk.GroupVersion().String(),
+		"kind":       gvk.Kind,
+		"metadata":   metav1.ObjectMeta{Name: probeObjectName, Namespace: namespace, Labels: labels},
+	})
+
+	dryRun := true
+	request := &admissionv1.AdmissionRequest{
+		UID:             types.UID(uuid.NewString()),
+		Kind:            metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+		Resource:        metav1.GroupVersionResource{Group: gvr.Group, Version: gvr.Version, Resource: gvr.Resource},
+		SubResource:     subResource,
+		Name:            probeObjectName,
+		Namespace:       namespace,
+		Operation:       operation,
+		UserInfo:        authenticationv1.UserInfo{Username: consts.FieldManager},
+		DryRun:          &dryRun,
+		RequestKind:     &metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+		RequestResource: &metav1.GroupVersionResource{Group: gvr.Group, Version: gvr.Version, Resource: gvr.Resource},
+	}
+	if operation != admissionv1.Delete {
+		request.Object = runtime.RawExtension{Raw: object}
+	}
+	if operation == admissionv1.Update || operation == admissionv1.Delete {
+		request.OldObject = runtime.RawExtension{Raw: object}
+	}
+	return &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request:  request,
+	}
+}
+
+// probeEndpoint posts review to target, trusting roots for serverName, and validates the answer.
+func probeEndpoint(ctx context.Context, webhook admissionregistration.MutatingWebhook, review *admissionv1.AdmissionReview, target *url.URL, serverName string, roots *x509.CertPool) WebhookProbe {
+	logger := log.MustGetLogger(ctx)
+	timeout := defaultWebhookTimeout
+	if webhook.TimeoutSeconds != nil {
+		timeout = time.Duration(*webhook.TimeoutSeconds) * time.Second
+	}
+	resource := schema.GroupVersionResource(review.Request.Resource).String()
+	if review.Request.SubResource != "" {
+		resource += "/" + review.Request.SubResource
+	}
+	probe := WebhookProbe{
+		Webhook:        webhook.Name,
+		Address:        target.Host,
+		Resource:       resource,
+		Operation:      string(review.Request.Operation),
+		UID:            string(review.Request.UID),
+		Status:         ProbeUnreachable,
+		TimeoutSeconds: timeout.Seconds(),
+	}
+	body, _ := json.Marshal(review)
+
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: serverName, MinVersion: tls.VersionTLS12}}
+	defer transport.CloseIdleConnections()
+	requestCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(requestCtx, http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	request.Host = serverName
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+
+	start := time.Now()
+	response, err := (&http.Client{Transport: transport}).Do(request)
+	var responseBody []byte
+	if err == nil {
+		responseBody, err = io.ReadAll(response.Body)
+		response.Body.Close()
+	}
+	probe.LatencySeconds = time.Since(start).Seconds()
+	switch {
+	case errors.Is(requestCtx.Err(), context.DeadlineExceeded):
+		probe.Status = ProbeTimedOut
+		probe.Error = fmt.Sprintf("no answer within the timeout of %s", timeout)
+	case err != nil:
+		probe.Error = err.Error()
+	default:
+		probe.Status = ProbeInvalidResponse
+		var answer *admissionv1.AdmissionResponse
+		if answer, err = validateReviewResponse(response.StatusCode, responseBody, review.Request.UID); err != nil {
+			probe.Error = err.Error()
+		} else {
+			probe.Status = ProbeSucceeded
+			probe.Allowed = answer.Allowed
+		}
+	}
+	if probe.Status == ProbeSucceeded {
+		logger.Infof(ctx, "probe of endpoint %s of webhook %s succeeded in %.3fs. allowed: %t", probe.Address, webhook.Name, probe.LatencySeconds, probe.Allowed)
+	} else {
+		logger.Warningf(ctx, "probe of endpoint %s of webhook %s %s. error: %s", probe.Address, webhook.Name, probe.Status, probe.Error)
+	}
+	return probe
+}
+
+// validateReviewResponse checks that an answer is an admission.k8s.io/v1 AdmissionReview the API
+// server would accept for the request with uid.
+func validateReviewResponse(statusCode int, body []byte, uid types.UID) (*admissionv1.AdmissionResponse, error) {
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", statusCode)
+	}
+	answer := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, answer); err != nil {
+		return nil, fmt.Errorf("decode AdmissionReview: %w", err)
+	}
+	if answer.APIVersion != admissionv1.SchemeGroupVersion.String() || answer.Kind != "AdmissionReview" {
+		return nil, fmt.Errorf("expected apiVersion %s and kind AdmissionReview, got %q and %q", admissionv1.SchemeGroupVersion, answer.APIVersion, answer.Kind)
+	}
+	if answer.Response == nil {
+		return nil, errors.New("AdmissionReview has no response")
+	}
+	if answer.Response.UID != uid {
+		return nil, fmt.Errorf("response uid %q does not match the request uid %q", answer.Response.UID, uid)
+	}
+	if len(answer.Response.Patch) > 0 {
+		if answer.Response.PatchType == nil || *answer.Response.PatchType != admissionv1.PatchTypeJSONPatch {
+			return nil, errors.New("response patch is not a JSONPatch")
+		}
+		var ops []map[string]interface{}
+		if err := json.Unmarshal(answer.Response.Patch, &ops); err != nil {
+			return nil, fmt.Errorf("decode response patch: %w", err)
+		}
+	}
+	return answer.Response, nil
+}
+
+// Probe sends a synthetic AdmissionReview to every ready endpoint of the webhooks and checks that
+// each answers with a valid review echoing its UID within the timeout of the webhook. Failed probes
+// are returned as an ObjectError with the reason ErrProbeFailed.
+func Probe(ctx context.Context, clientset kubernetes.Interface) (*Result, error) {
+	ctx, span := log.StartSpan(ctx, "Probe", nil)
+	defer span.End()
+	ctx = log.WithFields(ctx, "component", "reconciler", "phase", "probe")
+	logger := log.MustGetLogger(ctx)
+	result := &Result{Attempts: 1}
+
+	problems, err := probeWebhooks(ctx, clientset, result)
+	if err == nil && len(problems) > 0 {
+		errs := make([]error, 0, len(problems))
+		for _, problem := range problems {
+			logger.Errorf(ctx, "probe failed: %s", problem)
+			errs = append(errs, errors.New(problem))
+		}
+		err = &errdefs.ObjectError{Kind: webhookKind, Name: config.WebhookConfigName(), Reason: errdefs.ErrProbeFailed, Err: errors.Join(errs...)}
+	}
+	span.SetStatus(err)
+	return result, err
+}
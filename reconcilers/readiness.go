@@ -0,0 +1,91 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// readinessPollInterval is the time between two checks of the endpoints of the webhook backends.
+const readinessPollInterval = 2 * time.Second
+
+// waitForBackends waits until the service of every webhook of webhookConfig has ready endpoints,
+// so the webhook is not registered while no backend can answer it. It waits at most
+// config.AppConfig.ReadinessTimeout, and not at all if that is 0. Webhooks called through a url
+// are not waited for. When the timeout expires, it returns an ObjectError with the reason
+// ErrBackendNotReady naming the services still without ready endpoints.
+func waitForBackends(ctx context.Context, clientset kubernetes.Interface, webhookConfig *admissionregistration.MutatingWebhookConfiguration) error {
+	timeout := config.AppConfig.ReadinessTimeout
+	if timeout == 0 {
+		return nil
+	}
+	logger := log.MustGetLogger(ctx)
+	var pending []string
+	err := wait.PollUntilContextTimeout(ctx, readinessPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		pending = nil
+		for _, webhook := range webhookConfig.Webhooks {
+			ref := webhook.ClientConfig.Service
+			if ref == nil {
+				continue
+			}
+			_, addresses, err := webhookEndpoints(ctx, clientset, webhook.ClientConfig)
+			if err != nil {
+				return false, err
+			}
+			if service := ref.Namespace + "/" + ref.Name; len(addresses) == 0 && !slices.Contains(pending, service) {
+				pending = append(pending, service)
+			}
+		}
+		if len(pending) > 0 {
+			logger.Infof(ctx, "waiting for ready endpoints of services %s.", strings.Join(pending, ", "))
+		}
+		return len(pending) == 0, nil
+	})
+	// A cancelled job is reported as cancelled, not as a backend that never became ready.
+	if err != nil && ctx.Err() == nil && wait.Interrupted(err) {
+		logger.Errorf(ctx, "services %s have no ready endpoints after %s.", strings.Join(pending, ", "), timeout)
+		return &errdefs.ObjectError{Kind: webhookKind, Name: webhookConfig.Name, Reason: errdefs.ErrBackendNotReady,
+			Err: fmt.Errorf("services %s have no ready endpoints after %s", strings.Join(pending, ", "), timeout)}
+	}
+	if err != nil {
+		return err
+	}
+	logger.Infof(ctx, "the services of mutating webhook configuration %s have ready endpoints.", webhookConfig.Name)
+	return nil
+}
+
+// waitForUnregisteredBackends waits for the backends of the webhook configuration of the ConfigMap
+// if it is not registered yet. A rotation calls it before writing the secret, so the wait runs
+// on ctx rather than within the shutdown grace period of the webhook update, and a backend not
+// ready in time fails with ErrBackendNotReady before anything is written.
+func waitForUnregisteredBackends(ctx context.Context, clientset kubernetes.Interface, isKubeSystemNamespaceBlocked bool) error {
+	if config.AppConfig.ReadinessTimeout == 0 {
+		return nil
+	}
+	_, getErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+	if getErr == nil {
+		return nil
+	}
+	if !k8serrors.IsNotFound(getErr) {
+		metrics.RecordAPIError("get", "mutatingwebhookconfigurations", getErr)
+		return errdefs.NewAPIError("get", "mutatingwebhookconfigurations", config.WebhookConfigName(), getErr)
+	}
+	declared, err := getMutatingWebhookConfigFromConfigmap(ctx, clientset, nil, isKubeSystemNamespaceBlocked)
+	if err != nil {
+		return err
+	}
+	return waitForBackends(log.WithFields(ctx, "phase", "readiness"), clientset, declared)
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,20 +14,30 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/kubernetes"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/Azure/webhook-tls-manager/config"
 	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
 	"github.com/Azure/webhook-tls-manager/goalresolvers"
 	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
 	"github.com/Azure/webhook-tls-manager/toolkit/log"
+	"github.com/Azure/webhook-tls-manager/toolkit/retrypolicy"
 )
 
 const (
-	retryCount    = 10
-	retryInterval = 5 * time.Second
-	retryTimeout  = 15 * time.Second
+	secretKind  = "Secret"
+	webhookKind = "MutatingWebhookConfiguration"
+
+	// shutdownGracePeriod bounds how long a rotation that already wrote the secret keeps
+	// running after cancellation to update the webhook or roll the secret back. It stays
+	// below the default 30 seconds terminationGracePeriodSeconds of the pod.
+	shutdownGracePeriod = 20 * time.Second
 )
 
 func currentWebhookConfigAndConfigmapDifferent(ctx context.Context, currentWebhookConfig *admissionregistration.MutatingWebhookConfiguration,
@@ -33,33 +45,51 @@ func currentWebhookConfigAndConfigmapDifferent(ctx context.Context, currentWebho
 	// Because the reflect.DeepEqual function is impacted by the order of array elements.
 	webhookConfigFromConfig *admissionregistration.MutatingWebhookConfiguration) bool {
 	logger := log.MustGetLogger(ctx)
-	if !reflect.DeepEqual(currentWebhookConfig.ObjectMeta.Labels, webhookConfigFromConfig.ObjectMeta.Labels) {
+	// Labels and annotations set by others are kept, so only the ones from the configmap are compared.
+	if !containsMetadata(currentWebhookConfig.ObjectMeta.Labels, webhookConfigFromConfig.ObjectMeta.Labels) {
 		logger.Info(ctx, "currentWebhookConfig.ObjectMeta different from webhookConfigFromConfig.ObjectMeta.Labels")
 		logger.Debugf(ctx, "currentWebhookConfig.ObjectMeta.Labels: %v", currentWebhookConfig.ObjectMeta.Labels)
 		logger.Debugf(ctx, "webhookConfigFromConfig.ObjectMeta.Labels: %v", webhookConfigFromConfig.ObjectMeta.Labels)
 		return true
 	}
-	if !reflect.DeepEqual(currentWebhookConfig.Webhooks[0].ClientConfig.Service, webhookConfigFromConfig.Webhooks[0].ClientConfig.Service) ||
-		!reflect.DeepEqual(currentWebhookConfig.Webhooks[0].Name, webhookConfigFromConfig.Webhooks[0].Name) ||
-		!reflect.DeepEqual(currentWebhookConfig.Webhooks[0].NamespaceSelector, webhookConfigFromConfig.Webhooks[0].NamespaceSelector) ||
-		!reflect.DeepEqual(currentWebhookConfig.Webhooks[0].ObjectSelector, webhookConfigFromConfig.Webhooks[0].ObjectSelector) ||
-		!reflect.DeepEqual(currentWebhookConfig.Webhooks[0].Rules, webhookConfigFromConfig.Webhooks[0].Rules) {
-		logger.Info(ctx, "currentWebhookConfig.Webhooks[0] different from webhookConfigFromConfig.Webhooks[0]")
-		logger.Debugf(ctx, "currentWebhookConfig.Webhooks[0]: %v", currentWebhookConfig.Webhooks[0])
-		logger.Debugf(ctx, "webhookConfigFromConfig.Webhooks[0]: %v", webhookConfigFromConfig.Webhooks[0])
+	if !containsMetadata(currentWebhookConfig.ObjectMeta.Annotations, webhookConfigFromConfig.ObjectMeta.Annotations) {
+		logger.Info(ctx, "currentWebhookConfig.ObjectMeta different from webhookConfigFromConfig.ObjectMeta.Annotations")
+		return true
+	}
+	// A webhook removed by an open breaker, or missing from either side, leaves the counts different.
+	if len(currentWebhookConfig.Webhooks) != len(webhookConfigFromConfig.Webhooks) {
+		logger.Infof(ctx, "currentWebhookConfig has %d webhooks, webhookConfigFromConfig has %d", len(currentWebhookConfig.Webhooks), len(webhookConfigFromConfig.Webhooks))
 		return true
 	}
+	for i := range currentWebhookConfig.Webhooks {
+		current, fromConfig := currentWebhookConfig.Webhooks[i], webhookConfigFromConfig.Webhooks[i]
+		if !reflect.DeepEqual(current.ClientConfig.Service, fromConfig.ClientConfig.Service) ||
+			!reflect.DeepEqual(current.Name, fromConfig.Name) ||
+			!reflect.DeepEqual(current.NamespaceSelector, fromConfig.NamespaceSelector) ||
+			!reflect.DeepEqual(current.ObjectSelector, fromConfig.ObjectSelector) ||
+			!reflect.DeepEqual(current.Rules, fromConfig.Rules) {
+			logger.Infof(ctx, "currentWebhookConfig.Webhooks[%d] different from webhookConfigFromConfig.Webhooks[%d]", i, i)
+			logger.Debugf(ctx, "currentWebhookConfig.Webhooks[%d]: %v", i, current)
+			logger.Debugf(ctx, "webhookConfigFromConfig.Webhooks[%d]: %v", i, fromConfig)
+			return true
+		}
+	}
 
 	return false
 }
 
+// shouldUpdateWebhook reports whether webhookConfig differs from the ConfigMap with the action of
+// the open breakers in breakers applied, so a webhook removed by its breaker is not applied again
+// until the breaker closes.
 func shouldUpdateWebhook(ctx context.Context, webhookConfig *admissionregistration.MutatingWebhookConfiguration,
-	isKubeSystemNamespaceBlocked bool, clientset kubernetes.Interface) (bool, *error) {
+	isKubeSystemNamespaceBlocked bool, breakers breakerState, clientset kubernetes.Interface) (bool, error) {
 	logger := log.MustGetLogger(ctx)
 
 	admissionEnforcerDisabled, labelExist := webhookConfig.Labels[consts.AdmissionEnforcerDisabledLabel]
 	//If the value of admissionEnforcerDisabled is false, the kube-system namespace is blocked.
-	if isKubeSystemNamespaceBlocked {
+	if !config.AppConfig.Profile.AdmissionEnforcerLabel {
+		logger.Debugf(ctx, "profile %s does not use the admissions enforcer label", config.AppConfig.Profile.Name)
+	} else if isKubeSystemNamespaceBlocked {
 		logger.Info(ctx, "kube-system should be blocked")
 		if labelExist && admissionEnforcerDisabled == consts.AdmissionEnforcerDisabledValue {
 			return true, nil
@@ -75,21 +105,24 @@ func shouldUpdateWebhook(ctx context.Context, webhookConfig *admissionregistrati
 	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 	if getErr != nil {
 		logger.Errorf(ctx, "get secret error: %s", getErr)
-		return false, &getErr
-	}
-	caCert := secret.Data["caCert.pem"]
-	if len(webhookConfig.Webhooks) == 0 ||
-		!bytes.Equal(webhookConfig.Webhooks[0].ClientConfig.CABundle, caCert) {
-		logger.Info(ctx, "update webhookConfig for CABundle")
-		logger.Debugf(ctx, "webhookConfig.Webhooks[0].ClientConfig.CABundle: %x", webhookConfig.Webhooks[0].ClientConfig.CABundle)
-		logger.Debugf(ctx, "caCert: %x", caCert)
-		return true, nil
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return false, errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	caCert := caBundle(secret)
+	for _, webhook := range webhookConfig.Webhooks {
+		if !bytes.Equal(webhook.ClientConfig.CABundle, caCert) {
+			logger.Info(ctx, "update webhookConfig for CABundle")
+			logger.Debugf(ctx, "webhook %s CABundle: %s", webhook.Name, webhook.ClientConfig.CABundle)
+			logger.Debugf(ctx, "caCert: %s", caCert)
+			return true, nil
+		}
 	}
 	webhookConfigFromConfig, err := getMutatingWebhookConfigFromConfigmap(ctx, clientset, caCert, isKubeSystemNamespaceBlocked)
 	if err != nil {
-		logger.Errorf(ctx, "get webhookConfig from configmap error: %s", *err)
+		logger.Errorf(ctx, "get webhookConfig from configmap error: %s", err)
 		return false, err
 	}
+	applyBreakers(ctx, webhookConfigFromConfig, breakers)
 
 	if currentWebhookConfigAndConfigmapDifferent(ctx, webhookConfig, webhookConfigFromConfig) {
 		logger.Info(ctx, "update webhookConfig for webhookConfigFromConfig")
@@ -99,16 +132,16 @@ func shouldUpdateWebhook(ctx context.Context, webhookConfig *admissionregistrati
 	return false, nil
 }
 
-func createOrUpdateSecret(ctx context.Context, clientset kubernetes.Interface, data goalresolvers.CertificateData) *error {
+func createOrUpdateSecret(ctx context.Context, clientset kubernetes.Interface, result *Result, data goalresolvers.CertificateData) error {
 	logger := log.MustGetLogger(ctx)
 
 	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 
 	if k8serrors.IsNotFound(getErr) {
 		logger.Infof(ctx, "create secret %s", config.SecretName())
-		cerr := createTlsSecret(ctx, clientset, data)
+		cerr := createTlsSecret(ctx, clientset, result, data)
 		if cerr != nil {
-			logger.Errorf(ctx, "fail to create secret %s. error: %s", config.SecretName(), *cerr)
+			logger.Errorf(ctx, "fail to create secret %s. error: %s", config.SecretName(), cerr)
 			return cerr
 		}
 		return nil
@@ -116,24 +149,26 @@ func createOrUpdateSecret(ctx context.Context, clientset kubernetes.Interface, d
 
 	if getErr != nil {
 		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
-		return &getErr
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
 	}
 
 	// Label has been checked in the goal resolver
-	cerr := updateTlsSecret(ctx, clientset, data, secret)
+	cerr := updateTlsSecret(ctx, clientset, result, data, secret)
 	if cerr != nil {
-		logger.Errorf(ctx, "fail to update secret %s. error: %s", config.SecretName(), *cerr)
+		logger.Errorf(ctx, "fail to update secret %s. error: %s", config.SecretName(), cerr)
 		return cerr
 	}
 	return nil
 }
 
-func createOrUpdateWebhook(ctx context.Context, clientset kubernetes.Interface, isKubeSystemNamespaceBlocked bool) *error {
+func createOrUpdateWebhook(ctx context.Context, clientset kubernetes.Interface, result *Result, isKubeSystemNamespaceBlocked bool) error {
 	logger := log.MustGetLogger(ctx)
 	secret, err := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 	if err != nil {
 		logger.Infof(ctx, "fail to get secret %s. error: %s", config.SecretName(), err)
-		return &err
+		metrics.RecordAPIError("get", "secrets", err)
+		return errdefs.NewAPIError("get", "secrets", config.SecretName(), err)
 	}
 
 	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
@@ -141,9 +176,9 @@ func createOrUpdateWebhook(ctx context.Context, clientset kubernetes.Interface,
 
 	if k8serrors.IsNotFound(getErr) {
 		logger.Infof(ctx, "mutating webhook configuration %s doesn't exist", config.WebhookConfigName())
-		cerr := createMutatingWebhookConfig(ctx, clientset, secret.Data["caCert.pem"], isKubeSystemNamespaceBlocked)
+		cerr := createMutatingWebhookConfig(ctx, clientset, result, caBundle(secret), isKubeSystemNamespaceBlocked)
 		if cerr != nil {
-			logger.Errorf(ctx, "Create mutating webhook configuration failed. error: %s", *cerr)
+			logger.Errorf(ctx, "Create mutating webhook configuration failed. error: %s", cerr)
 			return cerr
 		}
 		logger.Info(ctx, "Create mutating webhook configuration succeed.")
@@ -152,64 +187,193 @@ func createOrUpdateWebhook(ctx context.Context, clientset kubernetes.Interface,
 
 	if getErr != nil {
 		logger.Errorf(ctx, "get mutating webhook configuration error: %s", getErr)
-		return &getErr
+		metrics.RecordAPIError("get", "mutatingwebhookconfigurations", getErr)
+		return errdefs.NewAPIError("get", "mutatingwebhookconfigurations", config.WebhookConfigName(), getErr)
 	}
 
-	if v, exist := webhook.ObjectMeta.Labels[consts.ManagedLabelKey]; !exist || v != consts.ManagedLabelValue {
-		logger.Warningf(ctx, "found mutating webhook configuration %s not managed by AKS", config.WebhookConfigName())
+	if !isManaged(webhook.ObjectMeta.Labels) && !config.AppConfig.Adopt {
+		logger.Warningf(ctx, "found mutating webhook configuration %s not managed", config.WebhookConfigName())
+		result.record(webhookKind, "", config.WebhookConfigName(), ActionSkipped, "unmanaged")
+		result.warn("mutating webhook configuration %s is not managed and was not updated", config.WebhookConfigName())
 		return nil
 	}
+	if !isManaged(webhook.ObjectMeta.Labels) {
+		logger.Infof(ctx, "adopting mutating webhook configuration %s not managed", config.WebhookConfigName())
+		var cerr error
+		if webhook, cerr = adoptWebhook(ctx, clientset, result, webhook, isKubeSystemNamespaceBlocked); cerr != nil {
+			return cerr
+		}
+	}
 
-	logger.Infof(ctx, "mutating webhook configuration %s is managed by AKS", config.WebhookConfigName())
-	shouldUpdate, cerr := shouldUpdateWebhook(ctx, webhook, isKubeSystemNamespaceBlocked, clientset)
+	logger.Infof(ctx, "mutating webhook configuration %s is managed", config.WebhookConfigName())
+	disabled, cerr := readDisabledState(webhook)
+	if cerr != nil {
+		return cerr
+	}
+	if disabled != nil {
+		return updateDisabledWebhook(ctx, clientset, result, webhook, disabled, caBundle(secret))
+	}
+	contested, cerr := trackCABundleDrift(ctx, clientset, result, webhook)
 	if cerr != nil {
 		return cerr
 	}
-	if shouldUpdate {
-		cerr = updateMutatingWebhookConfig(ctx, clientset, isKubeSystemNamespaceBlocked, secret.Data["caCert.pem"])
+	if contested {
+		return nil
+	}
+	var breakers breakerState
+	breakerChanged := false
+	if config.AppConfig.BreakerThreshold > 0 {
+		declared, readErr := getMutatingWebhookConfigFromConfigmap(ctx, clientset, caBundle(secret), isKubeSystemNamespaceBlocked)
+		if readErr != nil {
+			return readErr
+		}
+		previous := readBreakerState(ctx, webhook)
+		if breakers, breakerChanged, cerr = updateBreakers(log.WithFields(ctx, "phase", "breaker"), clientset, result, webhook, declared); cerr != nil {
+			return cerr
+		}
+		// Webhooks whose breaker closed are restored to Fail, so they wait for their backends
+		// like a webhook being registered.
+		declared.Webhooks = slices.DeleteFunc(declared.Webhooks, func(w admissionregistration.MutatingWebhook) bool {
+			return !previous[w.Name].Open || breakers[w.Name].Open
+		})
+		if len(declared.Webhooks) > 0 {
+			if cerr = waitForBackends(log.WithFields(ctx, "phase", "readiness"), clientset, declared); cerr != nil {
+				return cerr
+			}
+		}
+	}
+	shouldUpdate, cerr := shouldUpdateWebhook(ctx, webhook, isKubeSystemNamespaceBlocked, breakers, clientset)
+	if cerr != nil {
+		return cerr
+	}
+	if shouldUpdate || breakerChanged {
+		cerr = updateMutatingWebhookConfig(ctx, clientset, result, isKubeSystemNamespaceBlocked, caBundle(secret), breakers)
 		if cerr != nil {
-			logger.Errorf(ctx, "Update mutating webhook configuration failed. error: %s", *cerr)
+			logger.Errorf(ctx, "Update mutating webhook configuration failed. error: %s", cerr)
 			return cerr
 		}
 		logger.Info(ctx, "Update mutating webhook configuration succeed.")
+		return nil
 	}
+	result.record(webhookKind, "", config.WebhookConfigName(), ActionUnchanged, "")
 	return nil
 }
 
-func cleanupSecretAndWebhook(ctx context.Context, clientset kubernetes.Interface) *error {
+// isManaged reports whether labels mark an object as managed under the profile.
+func isManaged(labels map[string]string) bool {
+	return config.IsManaged(labels)
+}
+
+// cleanupSecretAndWebhook unregisters the webhook before deleting the secret holding its serving
+// certificate, and deletes the webhook ConfigMap if config.AppConfig.CleanupConfigMap is set.
+// Objects that are already gone count as cleaned up. Objects not managed are only deleted
+// if config.AppConfig.CleanupForce is set, and are checked before anything is deleted, so a
+// refused cleanup leaves every object in place.
+func cleanupSecretAndWebhook(ctx context.Context, clientset kubernetes.Interface, result *Result) error {
 	logger := log.MustGetLogger(ctx)
 
-	deleteErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Delete(ctx, config.SecretName(), metav1.DeleteOptions{})
-	if deleteErr != nil {
-		logger.Errorf(ctx, "failed to cleanup secret %s. error: %s", config.SecretName(), deleteErr)
-		return &deleteErr
+	webhookClient := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	webhook, getErr := webhookClient.Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+	if getErr != nil && !k8serrors.IsNotFound(getErr) {
+		logger.Errorf(ctx, "get mutating webhook configuration %s failed. error: %s", config.WebhookConfigName(), getErr)
+		metrics.RecordAPIError("get", "mutatingwebhookconfigurations", getErr)
+		return errdefs.NewAPIError("get", "mutatingwebhookconfigurations", config.WebhookConfigName(), getErr)
+	}
+	if getErr != nil {
+		webhook = nil
+	}
+	secretClient := clientset.CoreV1().Secrets(config.AppConfig.Namespace)
+	secret, getErr := secretClient.Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if getErr != nil && !k8serrors.IsNotFound(getErr) {
+		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	if getErr != nil {
+		secret = nil
 	}
-	logger.Infof(ctx, "cleanup secret %s succeed.", config.SecretName())
 
-	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
-	deleteErr = client.Delete(ctx, config.WebhookConfigName(), metav1.DeleteOptions{})
-	if deleteErr != nil {
-		logger.Errorf(ctx, "failed to cleanup mutating webhook configuration %s. error: %s", config.WebhookConfigName(), deleteErr)
-		return &deleteErr
+	if webhook != nil && !isManaged(webhook.Labels) {
+		if err := checkCleanupUnmanaged(ctx, result, webhookKind, "", config.WebhookConfigName()); err != nil {
+			return err
+		}
+	}
+	if secret != nil && !isManaged(secret.Labels) {
+		if err := checkCleanupUnmanaged(ctx, result, secretKind, config.AppConfig.Namespace, config.SecretName()); err != nil {
+			return err
+		}
 	}
-	logger.Infof(ctx, "cleanup webhook %s succeed.", config.WebhookConfigName())
 
+	if webhook == nil {
+		logger.Infof(ctx, "mutating webhook configuration %s not found.", config.WebhookConfigName())
+		result.record(webhookKind, "", config.WebhookConfigName(), ActionUnchanged, "not found")
+	} else if err := deleteObject(ctx, result, webhookKind, "mutatingwebhookconfigurations", "", config.WebhookConfigName(), webhook.UID, "", webhookClient.Delete); err != nil {
+		return err
+	}
+
+	if secret == nil {
+		logger.Infof(ctx, "secret %s not found.", config.SecretName())
+		result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionUnchanged, "not found")
+	} else if err := deleteObject(ctx, result, secretKind, "secrets", config.AppConfig.Namespace, config.SecretName(), secret.UID, "", secretClient.Delete); err != nil {
+		return err
+	}
+
+	if config.AppConfig.CleanupConfigMap {
+		configMapClient := clientset.CoreV1().ConfigMaps(config.AppConfig.Namespace)
+		if err := deleteObject(ctx, result, "ConfigMap", "configmaps", config.AppConfig.Namespace, config.ConfigMapName(), "", "", configMapClient.Delete); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkCleanupUnmanaged refuses to clean up an object not managed unless cleanup is forced.
+func checkCleanupUnmanaged(ctx context.Context, result *Result, kind, namespace, name string) error {
+	logger := log.MustGetLogger(ctx)
+	if !config.AppConfig.CleanupForce {
+		err := &errdefs.ObjectError{Kind: kind, Namespace: namespace, Name: name, Reason: errdefs.ErrUnmanagedObject}
+		logger.Errorf(ctx, "refusing to clean up %s %s not managed. error: %s", kind, name, err)
+		return err
+	}
+	logger.Warningf(ctx, "cleaning up %s %s not managed, as cleanup is forced.", kind, name)
+	result.warn("%s %s is not managed and was deleted by a forced cleanup", kind, name)
 	return nil
 }
 
-func createTlsSecret(ctx context.Context, clientset kubernetes.Interface, data goalresolvers.CertificateData) *error {
+// deleteObject deletes the object with the given UID, if set, so an object recreated since it
+// was read is left alone. An object that is already gone counts as deleted.
+func deleteObject(ctx context.Context, result *Result, kind, resource, namespace, name string, uid types.UID, reason string,
+	deleteFunc func(ctx context.Context, name string, opts metav1.DeleteOptions) error) error {
 	logger := log.MustGetLogger(ctx)
+	options := metav1.DeleteOptions{}
+	if uid != "" {
+		options.Preconditions = metav1.NewUIDPreconditions(string(uid))
+	}
+	deleteErr := deleteFunc(ctx, name, options)
+	if k8serrors.IsNotFound(deleteErr) {
+		logger.Infof(ctx, "%s %s already deleted.", kind, name)
+		result.record(kind, namespace, name, ActionUnchanged, "not found")
+		return nil
+	}
+	if deleteErr != nil {
+		logger.Errorf(ctx, "failed to cleanup %s %s. error: %s", kind, name, deleteErr)
+		metrics.RecordAPIError("delete", resource, deleteErr)
+		return errdefs.NewAPIError("delete", resource, name, deleteErr)
+	}
+	logger.Infof(ctx, "cleanup %s %s succeed.", kind, name)
+	result.record(kind, namespace, name, ActionDeleted, reason)
+	return nil
+}
+
+// desiredSecret returns the secret holding the certificates of data, with only the fields the job owns.
+func desiredSecret(data goalresolvers.CertificateData) *corev1.Secret {
 	secret := &corev1.Secret{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Secret",
-			APIVersion: "v1",
-		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      config.SecretName(),
-			Namespace: config.AppConfig.Namespace,
-			Labels: map[string]string{
-				consts.ManagedLabelKey: consts.ManagedLabelValue,
-			},
+			Name:        config.SecretName(),
+			Namespace:   config.AppConfig.Namespace,
+			Labels:      secretLabels(),
+			Annotations: mergeMetadata(nil, config.AppConfig.ExtraAnnotations),
 		},
 		Data: map[string][]byte{
 			"caCert.pem":     data.CaCertPem,
@@ -217,41 +381,65 @@ func createTlsSecret(ctx context.Context, clientset kubernetes.Interface, data g
 			"serverCert.pem": data.ServerCertPem,
 			"serverKey.pem":  data.ServerKeyPem,
 		},
-		Type: "Opaque",
 	}
+	setRotationAnnotations(secret, RotationPhaseSecretWritten, data)
+	return secret
+}
+
+func createTlsSecret(ctx context.Context, clientset kubernetes.Interface, result *Result, data goalresolvers.CertificateData) error {
+	logger := log.MustGetLogger(ctx)
+	secret := desiredSecret(data)
+	secret.TypeMeta = metav1.TypeMeta{
+		Kind:       "Secret",
+		APIVersion: "v1",
+	}
+	secret.Type = "Opaque"
 
-	_, createErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	_, createErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Create(ctx, secret, metav1.CreateOptions{FieldManager: consts.FieldManager})
 	if createErr != nil {
 		logger.Errorf(ctx, "create secret %s failed. error: %s", config.SecretName(), createErr)
-		return &createErr
+		metrics.RecordAPIError("create", "secrets", createErr)
+		return errdefs.NewAPIError("create", "secrets", config.SecretName(), createErr)
 	}
 	logger.Infof(ctx, "secret %s created.", config.SecretName())
+	result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionCreated, "")
 	return nil
 }
 
-func updateTlsSecret(ctx context.Context, clientset kubernetes.Interface, data goalresolvers.CertificateData, secret *corev1.Secret) *error {
+// updateTlsSecret applies the certificates of data to secret, keeping the certificates they
+// replace in the previous-* keys.
+func updateTlsSecret(ctx context.Context, clientset kubernetes.Interface, result *Result, data goalresolvers.CertificateData, secret *corev1.Secret) error {
 	logger := log.MustGetLogger(ctx)
-	secret.Data["caCert.pem"] = data.CaCertPem
-	secret.Data["caKey.pem"] = data.CaKeyPem
-	secret.Data["serverCert.pem"] = data.ServerCertPem
-	secret.Data["serverKey.pem"] = data.ServerKeyPem
+	current := secret.DeepCopy()
+	keepPreviousCertificates(current, data)
+	desired := desiredSecret(data)
+	for _, key := range certificateKeys {
+		if value, ok := current.Data[previousKeyPrefix+key]; ok {
+			desired.Data[previousKeyPrefix+key] = value
+		}
+	}
 
-	_, updateErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
-	if updateErr != nil {
-		logger.Errorf(ctx, "update secret %s failed. error: %s", config.SecretName(), updateErr)
-		return &updateErr
+	if applyErr := applySecret(ctx, clientset, desired, data.RevokePrevious); applyErr != nil {
+		logger.Errorf(ctx, "update secret %s failed. error: %s", config.SecretName(), applyErr)
+		return applyErr
 	}
 	logger.Infof(ctx, "secret %s updated.", config.SecretName())
+	result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionUpdated, "")
 	return nil
 }
 
-func getMutatingWebhookConfigFromConfigmap(ctx context.Context, clientset kubernetes.Interface, caCert []byte, isKubeSystemNamespaceBlocked bool) (*admissionregistration.MutatingWebhookConfiguration, *error) {
+func getMutatingWebhookConfigFromConfigmap(ctx context.Context, clientset kubernetes.Interface, caCert []byte, isKubeSystemNamespaceBlocked bool) (*admissionregistration.MutatingWebhookConfiguration, error) {
 	logger := log.MustGetLogger(ctx)
-	name := config.AppConfig.ObjectName + "-webhook-config"
+	name := config.ConfigMapName()
 	cm, err := clientset.CoreV1().ConfigMaps(config.AppConfig.Namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		logger.Errorf(ctx, "get webhook-config configmap failed. error: %s", err)
-		return nil, &err
+		metrics.RecordAPIError("get", "configmaps", err)
+		err = errdefs.NewAPIError("get", "configmaps", name, err)
+		if k8serrors.IsNotFound(err) {
+			return nil, &errdefs.ObjectError{Kind: "ConfigMap", Namespace: config.AppConfig.Namespace, Name: name, Reason: errdefs.ErrConfigMapMissing, Err: err}
+		}
+		return nil, err
 	}
 	logger.Infof(ctx, "get webhook-config configmap succeed.")
 	logger.Debugf(ctx, "configmap: %v", cm)
@@ -259,159 +447,387 @@ func getMutatingWebhookConfigFromConfigmap(ctx context.Context, clientset kubern
 	mutatingWebhookConfigJson := cm.Data["mutatingWebhookConfig"]
 	if mutatingWebhookConfigJson == "" {
 		logger.Errorf(ctx, "mutatingWebhookConfig is empty")
-		err = errors.New("mutatingWebhookConfig is empty")
-		return nil, &err
+		return nil, &errdefs.ObjectError{Kind: "ConfigMap", Namespace: config.AppConfig.Namespace, Name: name, Reason: errdefs.ErrConfigMapInvalid, Err: errors.New("mutatingWebhookConfig is empty")}
 	}
-	logger.Infof(ctx, "get mutatingWebhookConfig succeed. mutatingWebhookConfig: %s", mutatingWebhookConfigJson)
+	logger.Infof(ctx, "get mutatingWebhookConfig succeed. size: %d bytes", len(mutatingWebhookConfigJson))
 	logger.Debugf(ctx, "mutatingWebhookConfig: %s", mutatingWebhookConfigJson)
 	var mutatingWebhookConfig admissionregistration.MutatingWebhookConfiguration
 	err = yaml.NewYAMLOrJSONDecoder(strings.NewReader(mutatingWebhookConfigJson), 1024).Decode(&mutatingWebhookConfig)
 	if err != nil {
 		logger.Errorf(ctx, "unmarshal mutatingWebhookConfig failed. error: %s", err)
-		return nil, &err
+		return nil, &errdefs.ObjectError{Kind: "ConfigMap", Namespace: config.AppConfig.Namespace, Name: name, Reason: errdefs.ErrConfigMapInvalid, Err: err}
 	}
 	logger.Infof(ctx, "unmarshal mutatingWebhookConfig succeed.")
 	logger.Debugf(ctx, "mutatingWebhookConfig: %v", mutatingWebhookConfig)
 
+	if mutatingWebhookConfig.Name == "" {
+		mutatingWebhookConfig.Name = config.WebhookConfigName()
+	}
 	for i := range mutatingWebhookConfig.Webhooks {
 		mutatingWebhookConfig.Webhooks[i].ClientConfig.CABundle = caCert
 	}
-	var labels map[string]string
-	if !isKubeSystemNamespaceBlocked {
+	injectExclusions(&mutatingWebhookConfig, isKubeSystemNamespaceBlocked)
+	// The labels and annotations of the webhook YAML are kept, the extra ones are added, and the
+	// labels of the tool override both.
+	labels := mergeMetadata(mergeMetadata(mutatingWebhookConfig.Labels, config.AppConfig.ExtraLabels), config.ManagedLabels())
+	if !config.AppConfig.Profile.AdmissionEnforcerLabel {
+		logger.Infof(ctx, "profile %s does not use the admissions enforcer label.", config.AppConfig.Profile.Name)
+	} else if !isKubeSystemNamespaceBlocked {
 		logger.Info(ctx, "kube-system is unblocked.")
-		labels = map[string]string{
-			consts.ManagedLabelKey:                consts.ManagedLabelValue,
-			consts.AdmissionEnforcerDisabledLabel: consts.AdmissionEnforcerDisabledValue,
-		}
+		labels[consts.AdmissionEnforcerDisabledLabel] = consts.AdmissionEnforcerDisabledValue
 	} else {
 		logger.Info(ctx, "kube-system is blocked.")
-		labels = map[string]string{
-			consts.ManagedLabelKey: consts.ManagedLabelValue,
-		}
+		delete(labels, consts.AdmissionEnforcerDisabledLabel)
 	}
-	mutatingWebhookConfig.Labels = labels
+	mutatingWebhookConfig.Labels = withInstanceLabels(labels)
+	mutatingWebhookConfig.Annotations = mergeMetadata(mutatingWebhookConfig.Annotations, config.AppConfig.ExtraAnnotations)
+	mutatingWebhookConfig.Annotations[consts.CABundleFingerprintAnnotation] = bundleFingerprint(caCert)
 	logger.Debugf(ctx, "mutatingWebhookConfig from configmap: %v", mutatingWebhookConfig)
 
 	return &mutatingWebhookConfig, nil
 }
 
-func createMutatingWebhookConfig(ctx context.Context, clientset kubernetes.Interface, caCert []byte, isKubeSystemNamespaceBlocked bool) *error {
+func createMutatingWebhookConfig(ctx context.Context, clientset kubernetes.Interface, result *Result, caCert []byte, isKubeSystemNamespaceBlocked bool) error {
 	logger := log.MustGetLogger(ctx)
 	mutatingWebhookConfig, err := getMutatingWebhookConfigFromConfigmap(ctx, clientset, caCert, isKubeSystemNamespaceBlocked)
 	if err != nil {
-		logger.Errorf(ctx, "get mutating webhook config failed. error: %s", *err)
+		logger.Errorf(ctx, "get mutating webhook config failed. error: %s", err)
+		return err
+	}
+
+	if err := checkWebhookConfig(ctx, clientset, result, mutatingWebhookConfig, false); err != nil {
+		return err
+	}
+	if err := waitForBackends(log.WithFields(ctx, "phase", "readiness"), clientset, mutatingWebhookConfig); err != nil {
 		return err
 	}
 
 	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
 
-	_, createErr := client.Create(ctx, mutatingWebhookConfig, metav1.CreateOptions{})
+	_, createErr := client.Create(ctx, mutatingWebhookConfig, metav1.CreateOptions{FieldManager: consts.FieldManager})
 	if createErr != nil {
 		logger.Errorf(ctx, "create mutating webhook configuration %s failed. error: %s", config.WebhookConfigName(), createErr)
-		return &createErr
+		metrics.RecordAPIError("create", "mutatingwebhookconfigurations", createErr)
+		return errdefs.NewAPIError("create", "mutatingwebhookconfigurations", config.WebhookConfigName(), createErr)
 
 	}
 	logger.Infof(ctx, "mutating webhook configuration %s created.", config.WebhookConfigName())
+	result.record(webhookKind, "", config.WebhookConfigName(), ActionCreated, "")
 	return nil
 
 }
 
-func updateMutatingWebhookConfig(ctx context.Context, clientset kubernetes.Interface, isKubeSystemNamespaceBlocked bool, data []byte) *error {
+// updateMutatingWebhookConfig applies the webhook configuration of the ConfigMap, claiming only
+// its webhooks, labels and annotations, so the fields set by others are kept. The webhooks whose
+// breaker is open in breakers are switched to Ignore or left out.
+func updateMutatingWebhookConfig(ctx context.Context, clientset kubernetes.Interface, result *Result, isKubeSystemNamespaceBlocked bool, data []byte, breakers breakerState) error {
 	logger := log.MustGetLogger(ctx)
-	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
-	webhook, getErr := client.Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
-	if getErr != nil {
-		logger.Infof(ctx, "fail to get mutating webhook config %s. error: %s", config.WebhookConfigName(), getErr)
-		return &getErr
-	}
 	webhookFromCm, readErr := getMutatingWebhookConfigFromConfigmap(ctx, clientset, data, isKubeSystemNamespaceBlocked)
 	if readErr != nil {
-		logger.Infof(ctx, "fail to get mutating webhook config from configmap. error: %s", *readErr)
+		logger.Infof(ctx, "fail to get mutating webhook config from configmap. error: %s", readErr)
 		return readErr
 	}
-	webhook.ObjectMeta.Labels = webhookFromCm.ObjectMeta.Labels
-	webhook.Webhooks = webhookFromCm.Webhooks
-	logger.Debugf(ctx, "webhook before update: %v", webhook)
-	_, updateErr := client.Update(ctx, webhook, metav1.UpdateOptions{})
-	if updateErr != nil {
-		logger.Infof(ctx, "fail to update mutating webhook config %s. error: %s", config.WebhookConfigName(), updateErr)
-		return &updateErr
+	if err := checkWebhookConfig(ctx, clientset, result, webhookFromCm, true); err != nil {
+		return err
+	}
+	applyBreakers(ctx, webhookFromCm, breakers)
+	logger.Debugf(ctx, "webhook to apply: %v", webhookFromCm)
+	if applyErr := applyWebhookConfig(ctx, clientset, webhookFromCm); applyErr != nil {
+		logger.Infof(ctx, "fail to update mutating webhook config %s. error: %s", config.WebhookConfigName(), applyErr)
+		return applyErr
 	}
+	result.record(webhookKind, "", config.WebhookConfigName(), ActionUpdated, "")
 	return nil
 }
 
+// recordCertificateInventory exports NotBefore/NotAfter of the certificates currently stored
+// in the secret and adds them to the result. It only reports, so failures are logged and
+// never fail the reconcile.
+func recordCertificateInventory(ctx context.Context, clientset kubernetes.Interface, result *Result) {
+	logger := log.MustGetLogger(ctx)
+	secret, err := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if err != nil {
+		logger.Warningf(ctx, "get secret %s for certificate metrics failed. error: %s", config.SecretName(), err)
+		metrics.RecordAPIError("get", "secrets", err)
+		return
+	}
+	for certificate, key := range map[string]string{
+		metrics.CACertificateLabelValue:     "caCert.pem",
+		metrics.ServerCertificateLabelValue: "serverCert.pem",
+	} {
+		cert, err := certificates.ParsePEMCertificate(secret.Data[key])
+		if err != nil {
+			logger.Warningf(ctx, "parse %s of secret %s for certificate metrics failed. error: %s", key, config.SecretName(), err)
+			continue
+		}
+		metrics.SetCertificateInventory(certificate, cert)
+		if certificate == metrics.CACertificateLabelValue {
+			result.CACertificate = newCertificateInfo(cert)
+		} else {
+			result.ServerCertificate = newCertificateInfo(cert)
+		}
+	}
+}
+
 type webhookTlsManagerReconciler struct {
 	webhookTlsManagerGoalResolver goalresolvers.WebhookTlsManagerGoalResolverInterface
 	kubeClient                    kubernetes.Interface
+	retryPolicy                   retrypolicy.Policy
 }
 
 func NewWebhookTlsManagerReconciler(webhookTlsManagerGoalResolver goalresolvers.WebhookTlsManagerGoalResolverInterface, kubeClient kubernetes.Interface) Reconciler {
+	retryPolicy := retrypolicy.DefaultPolicy()
+	retryPolicy.MaxAttempts = config.AppConfig.RetryMaxAttempts
+	retryPolicy.Deadline = config.AppConfig.RetryDeadline
 	return &webhookTlsManagerReconciler{
 		webhookTlsManagerGoalResolver: webhookTlsManagerGoalResolver,
 		kubeClient:                    kubeClient,
+		retryPolicy:                   retryPolicy,
 	}
 }
 
-func (r *webhookTlsManagerReconciler) reconcileOnce(ctx context.Context) *error {
+func (r *webhookTlsManagerReconciler) reconcileOnce(ctx context.Context, result *Result) error {
 	logger := log.MustGetLogger(ctx)
 
-	goal, cerr := r.webhookTlsManagerGoalResolver.Resolve(ctx)
+	goal, cerr := r.webhookTlsManagerGoalResolver.Resolve(log.WithFields(ctx, "phase", "resolve"))
 	if cerr != nil {
-		logger.Errorf(ctx, "Resolve webhook goal failed. error: %s", *cerr)
+		logger.Errorf(ctx, "Resolve webhook goal failed. error: %s", cerr)
 		return cerr
 	}
 
 	if !goal.IsWebhookTlsManagerEnabled {
-		cerr = cleanupSecretAndWebhook(ctx, r.kubeClient)
+		ctx = log.WithFields(ctx, "phase", "cleanup")
+		cerr = cleanupSecretAndWebhook(ctx, r.kubeClient, result)
 		if cerr != nil {
-			logger.Errorf(ctx, "cleanupSecretAndWebhook error: %s", *cerr)
+			logger.Errorf(ctx, "cleanupSecretAndWebhook error: %s", cerr)
 			return cerr
 		}
 		logger.Info(ctx, "WebhookTlsManager is disabled. cleanup succeed.")
 		return nil
 	}
 
+	if cerr = resumeRotation(ctx, r.kubeClient, result, goal); cerr != nil {
+		logger.Errorf(ctx, "resume rotation failed. error: %s", cerr)
+		return cerr
+	}
+
+	if goal.AdoptSecret {
+		if cerr = adoptSecret(log.WithFields(ctx, "phase", "adopt"), r.kubeClient, result); cerr != nil {
+			logger.Errorf(ctx, "adopt secret failed. error: %s", cerr)
+			return cerr
+		}
+	}
+
+	if goal.SecretUnmanaged {
+		result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionSkipped, "unmanaged")
+		result.warn("secret %s is not managed and its certificates are not rotated", config.SecretName())
+	}
+
 	// Rotate certificates.
 	if goal.CertData != nil {
-		metrics.RotateCertificateMetric.Set(1)
-		cerr = createOrUpdateSecret(ctx, r.kubeClient, *goal.CertData)
-		if cerr != nil {
-			logger.Errorf(ctx, "createOrUpdateSecret failed. error: %s", *cerr)
+		if cerr = rotateSecretAndWebhook(ctx, r.kubeClient, result, goal); cerr != nil {
 			return cerr
 		}
 	} else {
-		metrics.RotateCertificateMetric.Set(0)
+		if !goal.SecretUnmanaged {
+			if cerr = labelSecret(log.WithFields(ctx, "phase", "rotate"), r.kubeClient, result); cerr != nil {
+				logger.Errorf(ctx, "label secret failed. error: %s", cerr)
+				return cerr
+			}
+		}
+		cerr = createOrUpdateWebhook(log.WithFields(ctx, "phase", "webhook"), r.kubeClient, result, goal.IsKubeSystemNamespaceBlocked)
+		if cerr != nil {
+			logger.Errorf(ctx, "createOrUpdateWebhook failed. error: %s", cerr)
+			return cerr
+		}
+	}
+
+	if cerr = sweepOrphans(log.WithFields(ctx, "phase", "orphans"), r.kubeClient, result); cerr != nil {
+		logger.Errorf(ctx, "sweep orphaned objects failed. error: %s", cerr)
+		return cerr
 	}
 
-	cerr = createOrUpdateWebhook(ctx, r.kubeClient, goal.IsKubeSystemNamespaceBlocked)
+	if config.AppConfig.VerifyEndpoints {
+		// Backends reload the secret on their own schedule, so verification only warns.
+		problems, verifyErr := verifyEndpoints(log.WithFields(ctx, "phase", "verify"), r.kubeClient, result)
+		if verifyErr != nil {
+			logger.Warningf(ctx, "verify webhook endpoints failed. error: %s", verifyErr)
+			result.warn("webhook endpoints could not be verified: %s", verifyErr)
+		}
+		for _, problem := range problems {
+			result.warn("%s", problem)
+		}
+	}
+	return nil
+}
+
+// rotateSecretAndWebhook writes the new certificates and injects the new CA into the webhook.
+// Once the secret write starts, both steps run detached from cancellation so a SIGTERM cannot
+// leave the secret and the webhook out of step. If the webhook update still fails while the
+// process is shutting down, the secret is rolled back before returning.
+func rotateSecretAndWebhook(ctx context.Context, clientset kubernetes.Interface, result *Result, goal *goalresolvers.WebhookTlsManagerGoal) error {
+	logger := log.MustGetLogger(ctx)
+	previous, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(getErr) {
+		previous = nil
+	} else if getErr != nil {
+		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+
+	if cerr := waitForUnregisteredBackends(ctx, clientset, goal.IsKubeSystemNamespaceBlocked); cerr != nil {
+		logger.Errorf(ctx, "wait for the backends of mutating webhook configuration %s failed. error: %s", config.WebhookConfigName(), cerr)
+		return cerr
+	}
+	if previous != nil {
+		if cerr := markRotationPending(ctx, clientset, goal); cerr != nil {
+			logger.Errorf(ctx, "mark rotation pending on secret %s failed. error: %s", config.SecretName(), cerr)
+			return cerr
+		}
+	}
+
+	criticalCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownGracePeriod)
+	defer cancel()
+
+	cerr := createOrUpdateSecret(log.WithFields(criticalCtx, "phase", "rotate"), clientset, result, *goal.CertData)
+	if cerr != nil {
+		logger.Errorf(ctx, "createOrUpdateSecret failed. error: %s", cerr)
+		return cerr
+	}
+	metrics.CertificateRotationsMetric.WithLabelValues(goal.RotationReason).Inc()
+	result.Rotated = true
+	result.RotationReason = goal.RotationReason
+
+	cerr = createOrUpdateWebhook(log.WithFields(criticalCtx, "phase", "webhook"), clientset, result, goal.IsKubeSystemNamespaceBlocked)
 	if cerr != nil {
-		logger.Errorf(ctx, "createOrUpdateWebhook failed. error: %s", *cerr)
+		logger.Errorf(ctx, "createOrUpdateWebhook failed. error: %s", cerr)
+		if ctx.Err() != nil {
+			logger.Warningf(ctx, "shutting down with the webhook not updated. rolling back secret %s.", config.SecretName())
+			if rerr := rollbackSecret(log.WithFields(criticalCtx, "phase", "rollback"), clientset, result, previous); rerr != nil {
+				logger.Errorf(ctx, "rollback secret %s failed. error: %s", config.SecretName(), rerr)
+			}
+		}
+		return cerr
+	}
+	if cerr := completeRotation(log.WithFields(criticalCtx, "phase", "webhook"), clientset, result); cerr != nil {
 		return cerr
 	}
+	if forced := goal.ForcedRotation; forced != nil {
+		recordForcedRotationCompleted(criticalCtx, clientset, forced)
+	}
+	return nil
+}
+
+// rollbackSecret restores the certificates and the rotation annotations of previous, or deletes
+// the secret if it did not exist before the rotation.
+func rollbackSecret(ctx context.Context, clientset kubernetes.Interface, result *Result, previous *corev1.Secret) error {
+	logger := log.MustGetLogger(ctx)
+	client := clientset.CoreV1().Secrets(config.AppConfig.Namespace)
+	if previous == nil {
+		deleteErr := client.Delete(ctx, config.SecretName(), metav1.DeleteOptions{})
+		if deleteErr != nil && !k8serrors.IsNotFound(deleteErr) {
+			metrics.RecordAPIError("delete", "secrets", deleteErr)
+			return errdefs.NewAPIError("delete", "secrets", config.SecretName(), deleteErr)
+		}
+		logger.Infof(ctx, "secret %s deleted.", config.SecretName())
+		result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionDeleted, "rollback")
+		result.Rotated = false
+		return nil
+	}
 
+	// Only the keys the rotation wrote are restored, so those added by others since are kept. A
+	// key previous did not have is removed.
+	data := map[string]interface{}{}
+	for _, key := range certificateKeys {
+		for _, k := range []string{key, previousKeyPrefix + key} {
+			data[k] = nil
+			if value, ok := previous.Data[k]; ok {
+				data[k] = value
+			}
+		}
+	}
+	annotations := map[string]interface{}{}
+	for _, key := range rotationAnnotationKeys {
+		annotations[key] = nil
+		if value, ok := previous.Annotations[key]; ok {
+			annotations[key] = value
+		}
+	}
+	fields := map[string]interface{}{"data": data, "metadata": map[string]interface{}{"annotations": annotations}}
+	if _, err := patchSecret(ctx, clientset, fields); err != nil {
+		return err
+	}
+	logger.Infof(ctx, "secret %s rolled back.", config.SecretName())
+	result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionRolledBack, "webhook not updated before shutdown")
+	result.Rotated = false
 	return nil
 }
 
-func (r *webhookTlsManagerReconciler) Reconcile(ctx context.Context) *error {
+// Reconcile resolves the goal and applies it, retrying according to the retry policy. The
+// result is never nil and lists what was done, also when an error is returned.
+func (r *webhookTlsManagerReconciler) Reconcile(ctx context.Context) (*Result, error) {
+	ctx, span := log.StartSpan(ctx, "Reconcile", nil)
+	defer span.End()
+	ctx = log.WithFields(ctx, "component", "reconciler")
+	timer := prometheus.NewTimer(metrics.ReconcileDurationMetric)
+	defer timer.ObserveDuration()
+
+	result := &Result{}
+	cerr := r.reconcileWithRetries(ctx, result)
+	if result.Rotated {
+		metrics.RotateCertificateMetric.Set(1)
+	} else {
+		metrics.RotateCertificateMetric.Set(0)
+	}
+	span.SetAttributes(map[string]interface{}{"rotated": result.Rotated, "attempts": result.Attempts})
+	return result, cerr
+}
+
+func (r *webhookTlsManagerReconciler) reconcileWithRetries(ctx context.Context, result *Result) error {
 	logger := log.MustGetLogger(ctx)
 	logger.Info(ctx, "Start reconciling webhook.")
-	currentTime := time.Now()
-	var cerr *error
+	start := time.Now()
+	var cerr error
 
-	for i := 0; i < retryCount; i++ {
-		if time.Since(currentTime) > retryTimeout {
-			err := errors.New("reconcileOnce timeout")
-			logger.Errorf(ctx, "reconcileOnce timeout.")
-			return &err
+	for attempt := 1; attempt <= r.retryPolicy.MaxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			logger.Errorf(ctx, "reconcile cancelled. error: %s", err)
+			return err
 		}
-		cerr = r.reconcileOnce(ctx)
+		result.Attempts = attempt
+		attemptCtx, attemptSpan := log.StartSpan(ctx, "reconcileOnce", map[string]interface{}{"attempt": attempt})
+		cerr = r.reconcileOnce(attemptCtx, result)
 		if cerr == nil {
+			attemptSpan.SetStatus(nil)
+			attemptSpan.End()
 			logger.Info(ctx, "Reconcile webhook succeed.")
+			recordCertificateInventory(ctx, r.kubeClient, result)
 			return nil
 		}
-		logger.Warningf(ctx, "reconcileOnce failed. error: %s", *cerr)
-		time.Sleep(retryInterval)
+		classification := retrypolicy.Classify(cerr)
+		attemptSpan.SetAttributes(map[string]interface{}{"error.class": string(classification.Class)})
+		attemptSpan.SetStatus(cerr)
+		attemptSpan.End()
+		if !classification.Retriable {
+			logger.Errorf(ctx, "reconcileOnce failed with a %s error, not retrying. error: %s", classification.Class, cerr)
+			return cerr
+		}
+		if attempt == r.retryPolicy.MaxAttempts {
+			break
+		}
+		delay := r.retryPolicy.Delay(attempt, classification)
+		if time.Since(start)+delay > r.retryPolicy.Deadline {
+			err := fmt.Errorf("reconcile deadline of %s exceeded: %w", r.retryPolicy.Deadline, cerr)
+			logger.Errorf(ctx, "reconcileOnce failed and the next attempt would miss the deadline. error: %s", cerr)
+			return err
+		}
+		logger.Warningf(ctx, "reconcileOnce failed with a %s error, retrying in %s. error: %s", classification.Class, delay, cerr)
+		if err := retrypolicy.Wait(ctx, delay); err != nil {
+			logger.Errorf(ctx, "reconcile cancelled while waiting to retry. error: %s", err)
+			return errors.Join(cerr, err)
+		}
 	}
-	logger.Error(ctx, "Reconcile webhook succeed.")
+	logger.Errorf(ctx, "Reconcile webhook failed after %d attempts.", r.retryPolicy.MaxAttempts)
 	return cerr
 }
@@ -1,28 +1,52 @@
 package reconcilers
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
 	admissionregistration "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/legacy-cloud-providers/azure/retry"
 
 	"github.com/Azure/webhook-tls-manager/config"
 	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
 	"github.com/Azure/webhook-tls-manager/goalresolvers"
 	"github.com/Azure/webhook-tls-manager/goalresolvers/mock_goal_resolvers"
 	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
 	"github.com/Azure/webhook-tls-manager/toolkit/log"
+	"github.com/Azure/webhook-tls-manager/toolkit/retrypolicy"
 )
 
 const (
@@ -147,7 +171,7 @@ var _ = Describe("shouldUpdateWebhook", func() {
 	It("kube system is blocked and need to update webhook label", func() {
 		webhook = mutatingWebhookConfiguration(false)
 		webhook.Webhooks[0].ClientConfig.CABundle = s.Data[caBundleKey]
-		res, err := shouldUpdateWebhook(ctx, webhook, true, client)
+		res, err := shouldUpdateWebhook(ctx, webhook, true, nil, client)
 		Expect(err).To(BeNil())
 		Expect(res).To(BeTrue())
 	})
@@ -155,7 +179,7 @@ var _ = Describe("shouldUpdateWebhook", func() {
 	It("kube system is unblocked and need to update webhook label", func() {
 		webhook = mutatingWebhookConfiguration(true)
 		webhook.Webhooks[0].ClientConfig.CABundle = s.Data[caBundleKey]
-		res, err := shouldUpdateWebhook(ctx, webhook, false, client)
+		res, err := shouldUpdateWebhook(ctx, webhook, false, nil, client)
 		Expect(err).To(BeNil())
 		Expect(res).To(BeTrue())
 	})
@@ -163,7 +187,15 @@ var _ = Describe("shouldUpdateWebhook", func() {
 	It("need to update caBundle", func() {
 		webhook = mutatingWebhookConfiguration(false)
 		webhook.Webhooks[0].ClientConfig.CABundle = []byte(caBundleValue)
-		res, err := shouldUpdateWebhook(ctx, webhook, false, client)
+		res, err := shouldUpdateWebhook(ctx, webhook, false, nil, client)
+		Expect(err).To(BeNil())
+		Expect(res).To(BeTrue())
+	})
+
+	It("need to update a webhook config without webhooks", func() {
+		webhook = mutatingWebhookConfiguration(false)
+		webhook.Webhooks = nil
+		res, err := shouldUpdateWebhook(ctx, webhook, false, nil, client)
 		Expect(err).To(BeNil())
 		Expect(res).To(BeTrue())
 	})
@@ -193,12 +225,12 @@ var _ = Describe("createOrUpdateSecret", func() {
 			return true, nil, fmt.Errorf("get secrets error")
 		})
 
-		cerr := createOrUpdateSecret(ctx, fakeClientset, data)
+		cerr := createOrUpdateSecret(ctx, fakeClientset, &Result{}, data)
 		Expect(cerr).NotTo(BeNil())
 	})
 
 	It("secret not exists and create secret succeed", func() {
-		cerr := createOrUpdateSecret(ctx, fakeClientset, data)
+		cerr := createOrUpdateSecret(ctx, fakeClientset, &Result{}, data)
 		Expect(cerr).To(BeNil())
 		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
@@ -211,23 +243,23 @@ var _ = Describe("createOrUpdateSecret", func() {
 			return true, nil, fmt.Errorf("get secrets error")
 		})
 
-		cerr := createOrUpdateSecret(ctx, fakeClientset, data)
+		cerr := createOrUpdateSecret(ctx, fakeClientset, &Result{}, data)
 		Expect(cerr).NotTo(BeNil())
 	})
 
 	It("update secret error", func() {
 		fakeClientset = fake.NewSimpleClientset(s, prepareCM(config.AppConfig.Namespace))
-		fakeClientset.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		fakeClientset.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
 			return true, nil, fmt.Errorf("update secrets error")
 		})
 
-		cerr := createOrUpdateSecret(ctx, fakeClientset, data)
+		cerr := createOrUpdateSecret(ctx, fakeClientset, &Result{}, data)
 		Expect(cerr).NotTo(BeNil())
 	})
 
 	It("update secret succeed", func() {
 		fakeClientset = fake.NewSimpleClientset(s, prepareCM(config.AppConfig.Namespace))
-		cerr := createOrUpdateSecret(ctx, fakeClientset, data)
+		cerr := createOrUpdateSecret(ctx, fakeClientset, &Result{}, data)
 		Expect(cerr).To(BeNil())
 		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
@@ -253,7 +285,7 @@ var _ = Describe("createOrUpdateWebhook", func() {
 		client.PrependReactor("get", "secrets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
 			return true, nil, fmt.Errorf("error")
 		})
-		cerr := createOrUpdateWebhook(ctx, client, false)
+		cerr := createOrUpdateWebhook(ctx, client, &Result{}, false)
 		Expect(cerr).NotTo(BeNil())
 	})
 
@@ -261,12 +293,12 @@ var _ = Describe("createOrUpdateWebhook", func() {
 		client.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
 			return true, nil, fmt.Errorf("error")
 		})
-		cerr := createOrUpdateWebhook(ctx, client, false)
+		cerr := createOrUpdateWebhook(ctx, client, &Result{}, false)
 		Expect(cerr).NotTo(BeNil())
 	})
 
 	It("create webhook succeed", func() {
-		cerr := createOrUpdateWebhook(ctx, client, false)
+		cerr := createOrUpdateWebhook(ctx, client, &Result{}, false)
 		Expect(cerr).To(BeNil())
 		webhook, res := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
 		Expect(res).To(BeNil())
@@ -275,16 +307,16 @@ var _ = Describe("createOrUpdateWebhook", func() {
 
 	It("update webhook error", func() {
 		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
-		client.PrependReactor("update", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		client.PrependReactor("patch", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
 			return true, nil, fmt.Errorf("error")
 		})
-		cerr := createOrUpdateWebhook(ctx, client, false)
+		cerr := createOrUpdateWebhook(ctx, client, &Result{}, false)
 		Expect(cerr).NotTo(BeNil())
 	})
 
 	It("update webhook succeed", func() {
 		client = fake.NewSimpleClientset(mutatingWebhookConfiguration(true), secret(config.AppConfig.Namespace), prepareCM(config.AppConfig.Namespace))
-		cerr := createOrUpdateWebhook(ctx, client, false)
+		cerr := createOrUpdateWebhook(ctx, client, &Result{}, false)
 		Expect(cerr).To(BeNil())
 		webhook, res := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
 		Expect(res).To(BeNil())
@@ -302,7 +334,7 @@ var _ = Describe("createOrUpdateWebhook", func() {
 			},
 		}
 		client = fake.NewSimpleClientset(webhookConfig, secret(config.AppConfig.Namespace), prepareCM(config.AppConfig.Namespace))
-		cerr := createOrUpdateWebhook(ctx, client, false)
+		cerr := createOrUpdateWebhook(ctx, client, &Result{}, false)
 		Expect(cerr).To(BeNil())
 		webhook, res := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
 		Expect(res).To(BeNil())
@@ -321,415 +353,2549 @@ var _ = Describe("cleanupSecretAndWebhook", func() {
 	BeforeEach(func() {
 		config.NewConfig()
 		ctx = log.NewLogger(3).WithLogger(context.TODO())
-		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		fakeClientset = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
 	})
 
 	It("delete secret error", func() {
-		fakeClientset = fake.NewSimpleClientset(mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
-		cerr := cleanupSecretAndWebhook(ctx, fakeClientset)
-		Expect(cerr).Error()
+		fakeClientset.PrependReactor("delete", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("delete secrets error")
+		})
+		cerr := cleanupSecretAndWebhook(ctx, fakeClientset, &Result{})
+		Expect(cerr).NotTo(BeNil())
 	})
 
-	It("delete webhook error", func() {
-		fakeClientset = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), prepareCM(config.AppConfig.Namespace))
-		cerr := cleanupSecretAndWebhook(ctx, fakeClientset)
+	It("delete webhook error keeps the secret", func() {
+		fakeClientset.PrependReactor("delete", "mutatingwebhookconfigurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("delete webhook error")
+		})
+		cerr := cleanupSecretAndWebhook(ctx, fakeClientset, &Result{})
+		Expect(cerr).NotTo(BeNil())
 		_, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
-		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
-		Expect(cerr).Error()
+		Expect(err).To(BeNil())
+	})
+
+	It("deletes the webhook before the secret", func() {
+		var deleted []string
+		fakeClientset.PrependReactor("delete", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			deleted = append(deleted, action.GetResource().Resource)
+			return false, nil, nil
+		})
+		result := &Result{}
+		cerr := cleanupSecretAndWebhook(ctx, fakeClientset, result)
+		Expect(cerr).To(BeNil())
+		Expect(deleted).To(Equal([]string{"mutatingwebhookconfigurations", "secrets"}))
+		Expect(result.Actions).To(Equal([]ObjectAction{
+			{Kind: webhookKind, Name: config.WebhookConfigName(), Action: ActionDeleted},
+			{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionDeleted},
+		}))
+		_, err := fakeClientset.CoreV1().ConfigMaps(config.AppConfig.Namespace).Get(ctx, config.ConfigMapName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+	})
+
+	It("succeeds if the secret and the webhook are already gone", func() {
+		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		result := &Result{}
+		cerr := cleanupSecretAndWebhook(ctx, fakeClientset, result)
+		Expect(cerr).To(BeNil())
+		Expect(result.Changed()).To(BeFalse())
+	})
+
+	It("refuses to delete an unmanaged secret", func() {
+		fakeClientset = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
+		cerr := cleanupSecretAndWebhook(ctx, fakeClientset, &Result{})
+		Expect(errors.Is(cerr, errdefs.ErrUnmanagedObject)).To(BeTrue())
+		_, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+	})
+
+	It("refuses to delete an unmanaged webhook", func() {
+		unmanaged := mutatingWebhookConfiguration(false)
+		unmanaged.Labels = nil
+		fakeClientset = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), unmanaged, prepareCM(config.AppConfig.Namespace))
+		cerr := cleanupSecretAndWebhook(ctx, fakeClientset, &Result{})
+		Expect(errors.Is(cerr, errdefs.ErrUnmanagedObject)).To(BeTrue())
+		_, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
 	})
 
-	It("succeed", func() {
+	It("forced cleanup deletes unmanaged objects", func() {
+		config.UpdateCleanupConfig(true, false)
 		fakeClientset = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
-		cerr := cleanupSecretAndWebhook(ctx, fakeClientset)
+		result := &Result{}
+		cerr := cleanupSecretAndWebhook(ctx, fakeClientset, result)
+		Expect(cerr).To(BeNil())
+		Expect(result.Warnings).To(HaveLen(1))
+		_, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("deletes the configmap if configured", func() {
+		config.UpdateCleanupConfig(false, true)
+		result := &Result{}
+		cerr := cleanupSecretAndWebhook(ctx, fakeClientset, result)
 		Expect(cerr).To(BeNil())
+		Expect(result.Actions).To(ContainElement(ObjectAction{Kind: "ConfigMap", Namespace: config.AppConfig.Namespace, Name: config.ConfigMapName(), Action: ActionDeleted}))
+		_, err := fakeClientset.CoreV1().ConfigMaps(config.AppConfig.Namespace).Get(ctx, config.ConfigMapName(), metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
 	})
 })
 
-var _ = Describe("createTlsSecret", func() {
+var _ = Describe("sweepOrphans", func() {
 	var (
+		ctx           context.Context
 		fakeClientset *fake.Clientset
-		data          = goalresolvers.CertificateData{
-			CaCertPem:     []byte("caCert"),
-			CaKeyPem:      []byte("caKeyPem"),
-			ServerCertPem: []byte("serverCertPem"),
-			ServerKeyPem:  []byte("serverKeyPem"),
-		}
-		ctx = log.NewLogger(3).WithLogger(context.TODO())
 	)
 
+	// orphan returns the webhook and secret of instance, labelled as if instance created them.
+	orphan := func(instance, namespace string) (*admissionregistration.MutatingWebhookConfiguration, *corev1.Secret) {
+		labels := map[string]string{
+			consts.ManagedLabelKey:        consts.ManagedLabelValue,
+			consts.InstanceLabelKey:       instance,
+			consts.OwnerNamespaceLabelKey: namespace,
+		}
+		webhook := mutatingWebhookConfiguration(false)
+		webhook.Name = instance + "-webhook-config"
+		webhook.Labels = labels
+		s := secret(namespace)
+		s.Name = instance + "-tls-certs"
+		s.Labels = labels
+		return webhook, s
+	}
+
 	BeforeEach(func() {
 		config.NewConfig()
-		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		oldWebhook, oldSecret := orphan("old", config.AppConfig.Namespace)
+		otherNamespaceWebhook, _ := orphan("elsewhere", "other")
+		configuredWebhook, configuredSecret := orphan("configured", config.AppConfig.Namespace)
+		configuredCM := prepareCM(config.AppConfig.Namespace)
+		configuredCM.Name = "configured-webhook-config"
+		fakeClientset = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace),
+			oldWebhook, oldSecret, otherNamespaceWebhook, configuredWebhook, configuredSecret, configuredCM)
 	})
 
-	It("no secret exists", func() {
-		cerr := createTlsSecret(ctx, fakeClientset, data)
-		Expect(cerr).To(BeNil())
-		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	It("ignores orphans by default", func() {
+		result := &Result{}
+		Expect(sweepOrphans(ctx, fakeClientset, result)).To(Succeed())
+		Expect(result.Actions).To(BeEmpty())
+	})
+
+	It("reports the objects of instances without a configmap", func() {
+		config.UpdateOrphanConfig(config.OrphanPolicyReport)
+		result := &Result{}
+		Expect(sweepOrphans(ctx, fakeClientset, result)).To(Succeed())
+		Expect(result.Actions).To(ConsistOf(
+			ObjectAction{Kind: webhookKind, Name: "old-webhook-config", Action: ActionSkipped, Reason: "orphaned"},
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: "old-tls-certs", Action: ActionSkipped, Reason: "orphaned"},
+		))
+		Expect(result.Warnings).To(HaveLen(2))
+		_, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, "old-tls-certs", metav1.GetOptions{})
 		Expect(err).To(BeNil())
-		Expect(secret).NotTo(BeNil())
 	})
 
-	It("create error", func() {
-		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
-		fakeClientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
-			return true, nil, fmt.Errorf("create secrets error")
+	It("deletes the objects of instances without a configmap", func() {
+		config.UpdateOrphanConfig(config.OrphanPolicyDelete)
+		result := &Result{}
+		Expect(sweepOrphans(ctx, fakeClientset, result)).To(Succeed())
+		Expect(result.Actions).To(Equal([]ObjectAction{
+			{Kind: webhookKind, Name: "old-webhook-config", Action: ActionDeleted, Reason: "orphaned"},
+			{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: "old-tls-certs", Action: ActionDeleted, Reason: "orphaned"},
+		}))
+		_, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, "old-tls-certs", metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		for _, name := range []string{config.SecretName(), "configured-tls-certs"} {
+			_, err = fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+		}
+		_, err = fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+	})
+
+	It("finds orphans labelled with an accepted managed value", func() {
+		config.UpdateOrphanConfig(config.OrphanPolicyReport)
+		config.AppConfig.Profile.AcceptedManagedValues = []string{"legacy"}
+		legacyWebhook, legacySecret := orphan("legacy", config.AppConfig.Namespace)
+		legacyWebhook.Labels[consts.ManagedLabelKey] = "legacy"
+		unmanagedWebhook, _ := orphan("unmanaged", config.AppConfig.Namespace)
+		unmanagedWebhook.Labels[consts.ManagedLabelKey] = "someone-else"
+		Expect(fakeClientset.Tracker().Add(legacyWebhook)).To(Succeed())
+		Expect(fakeClientset.Tracker().Add(legacySecret)).To(Succeed())
+		Expect(fakeClientset.Tracker().Add(unmanagedWebhook)).To(Succeed())
+		result := &Result{}
+
+		Expect(sweepOrphans(ctx, fakeClientset, result)).To(Succeed())
+
+		Expect(result.Actions).To(ConsistOf(
+			ObjectAction{Kind: webhookKind, Name: "old-webhook-config", Action: ActionSkipped, Reason: "orphaned"},
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: "old-tls-certs", Action: ActionSkipped, Reason: "orphaned"},
+			ObjectAction{Kind: webhookKind, Name: "legacy-webhook-config", Action: ActionSkipped, Reason: "orphaned"},
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: "legacy-tls-certs", Action: ActionSkipped, Reason: "orphaned"},
+		))
+	})
+
+	It("reports the unlabelled objects named after instances without a configmap", func() {
+		unlabelledWebhook, unlabelledSecret := orphan("unlabelled", config.AppConfig.Namespace)
+		delete(unlabelledWebhook.Labels, consts.InstanceLabelKey)
+		delete(unlabelledWebhook.Labels, consts.OwnerNamespaceLabelKey)
+		delete(unlabelledSecret.Labels, consts.InstanceLabelKey)
+		delete(unlabelledSecret.Labels, consts.OwnerNamespaceLabelKey)
+		elsewhereWebhook := unlabelledWebhook.DeepCopy()
+		elsewhereWebhook.Name = "away-webhook-config"
+		elsewhereWebhook.Webhooks[0].ClientConfig.Service.Namespace = "other"
+		unrelatedSecret := unlabelledSecret.DeepCopy()
+		unrelatedSecret.Name = "unrelated"
+		for _, object := range []runtime.Object{unlabelledWebhook, unlabelledSecret, elsewhereWebhook, unrelatedSecret} {
+			Expect(fakeClientset.Tracker().Add(object)).To(Succeed())
+		}
+
+		for _, policy := range []config.OrphanPolicy{config.OrphanPolicyReport, config.OrphanPolicyDelete} {
+			config.UpdateOrphanConfig(policy)
+			result := &Result{}
+			Expect(sweepOrphans(ctx, fakeClientset, result)).To(Succeed())
+			Expect(result.Actions).To(ContainElements(
+				ObjectAction{Kind: webhookKind, Name: "unlabelled-webhook-config", Action: ActionSkipped, Reason: "orphaned"},
+				ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: "unlabelled-tls-certs", Action: ActionSkipped, Reason: "orphaned"},
+			))
+			for _, action := range result.Actions {
+				Expect(action.Name).NotTo(BeElementOf("away-webhook-config", "unrelated", config.WebhookConfigName(), config.SecretName()))
+			}
+		}
+		_, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, "unlabelled-tls-certs", metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		_, err = fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "unlabelled-webhook-config", metav1.GetOptions{})
+		Expect(err).To(BeNil())
+	})
+
+	It("list error", func() {
+		config.UpdateOrphanConfig(config.OrphanPolicyDelete)
+		fakeClientset.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("list secrets error")
 		})
-		cerr := createTlsSecret(ctx, fakeClientset, data)
-		Expect(cerr).NotTo(BeNil())
+		Expect(sweepOrphans(ctx, fakeClientset, &Result{})).NotTo(Succeed())
 	})
 })
 
-var _ = Describe("updateTlsSecret", func() {
+var _ = Describe("labelSecret", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		config.NewConfig()
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+	})
+
+	It("adds the instance labels to a managed secret", func() {
+		s := secret(config.AppConfig.Namespace)
+		s.Labels = map[string]string{consts.ManagedLabelKey: consts.ManagedLabelValue}
+		fakeClientset := fake.NewSimpleClientset(s)
+		result := &Result{}
+		Expect(labelSecret(ctx, fakeClientset, result)).To(Succeed())
+		Expect(result.Actions).To(Equal([]ObjectAction{{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionUpdated, Reason: "labelled"}}))
+		labelled, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(labelled.Labels).To(Equal(managedSecret(config.AppConfig.Namespace).Labels))
+	})
+
+	It("adds the extra labels and annotations to a labelled secret", func() {
+		Expect(config.UpdateMetadataConfig(map[string]string{"team": "autoscaling"}, map[string]string{"backup.example.com/exclude": "true"})).To(Succeed())
+		fakeClientset := fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace))
+		Expect(labelSecret(ctx, fakeClientset, &Result{})).To(Succeed())
+		labelled, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(labelled.Labels).To(HaveKeyWithValue("team", "autoscaling"))
+		Expect(labelled.Annotations).To(Equal(map[string]string{"backup.example.com/exclude": "true"}))
+	})
+
+	It("relabels a secret managed under an accepted value with the value of the profile", func() {
+		Expect(config.UpdateProfileConfig(config.ProfileGeneric, "", "", []string{consts.ManagedLabelValue}, false)).To(Succeed())
+		fakeClientset := fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace))
+		Expect(labelSecret(ctx, fakeClientset, &Result{})).To(Succeed())
+		labelled, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(labelled.Labels).To(HaveKeyWithValue(consts.ManagedLabelKey, config.GenericManagedLabelValue))
+	})
+
+	It("leaves labelled and unmanaged secrets alone", func() {
+		for _, s := range []*corev1.Secret{managedSecret(config.AppConfig.Namespace), secret(config.AppConfig.Namespace)} {
+			result := &Result{}
+			Expect(labelSecret(ctx, fake.NewSimpleClientset(s), result)).To(Succeed())
+			Expect(result.Actions).To(BeEmpty())
+		}
+	})
+})
+
+var _ = Describe("injectExclusions", func() {
+	BeforeEach(func() {
+		config.NewConfig()
+	})
+
+	It("excludes kube-system if blocked and the namespace of the webhook service", func() {
+		webhook := mutatingWebhookConfiguration(true)
+		webhook.Webhooks[0].ClientConfig.Service.Namespace = "vpa"
+		injectExclusions(webhook, true)
+		Expect(webhook.Webhooks[0].NamespaceSelector).To(Equal(&metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: corev1.LabelMetadataName, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"kube-system", "vpa"}},
+			},
+		}))
+		Expect(webhook.Webhooks[0].ObjectSelector).To(BeNil())
+	})
+
+	It("excludes kube-system hosting the webhook service also if it is not blocked", func() {
+		webhook := mutatingWebhookConfiguration(false)
+		injectExclusions(webhook, false)
+		Expect(webhook.Webhooks[0].NamespaceSelector).To(Equal(&metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: corev1.LabelMetadataName, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"kube-system"}},
+			},
+		}))
+	})
+
+	It("includes the namespace of the webhook service if asked to", func() {
+		Expect(config.UpdateExclusionConfig(nil, nil, true)).To(Succeed())
+		webhook := mutatingWebhookConfiguration(false)
+		injectExclusions(webhook, false)
+		Expect(webhook.Webhooks[0].NamespaceSelector).To(BeNil())
+	})
+
+	It("merges the configured exclusions into the selectors of every webhook", func() {
+		Expect(config.UpdateExclusionConfig([]string{"monitoring", "vpa"}, map[string]string{"example.com/skip": "true"}, true)).To(Succeed())
+		webhook := mutatingWebhookConfiguration(true)
+		webhook.Webhooks = append(webhook.Webhooks, *webhook.Webhooks[0].DeepCopy())
+		webhook.Webhooks[1].Name = "second.k8s.io"
+		webhook.Webhooks[1].NamespaceSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{"team": "autoscaling"},
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: corev1.LabelMetadataName, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"vpa", "default"}},
+			},
+		}
+		injectExclusions(webhook, false)
+		// Injecting again changes nothing.
+		injectExclusions(webhook, false)
+
+		objectSelector := &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "example.com/skip", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"true"}},
+			},
+		}
+		Expect(webhook.Webhooks[0].NamespaceSelector).To(Equal(&metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: corev1.LabelMetadataName, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"monitoring", "vpa"}},
+			},
+		}))
+		Expect(webhook.Webhooks[0].ObjectSelector).To(Equal(objectSelector))
+		Expect(webhook.Webhooks[1].NamespaceSelector).To(Equal(&metav1.LabelSelector{
+			MatchLabels: map[string]string{"team": "autoscaling"},
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: corev1.LabelMetadataName, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"default", "monitoring", "vpa"}},
+			},
+		}))
+		Expect(webhook.Webhooks[1].ObjectSelector).To(Equal(objectSelector))
+	})
+
+	It("keeps the selector of the webhook from the configmap", func() {
+		fakeClientset := fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		webhook, err := getMutatingWebhookConfigFromConfigmap(log.NewLogger(3).WithLogger(context.TODO()), fakeClientset, nil, false)
+		Expect(err).To(BeNil())
+		Expect(webhook.Webhooks[0].NamespaceSelector.MatchExpressions).To(Equal([]metav1.LabelSelectorRequirement{
+			{Key: "overlay-ccp-id", Operator: metav1.LabelSelectorOpExists},
+			{Key: corev1.LabelMetadataName, Operator: metav1.LabelSelectorOpNotIn, Values: []string{"vpa-recommender"}},
+		}))
+		Expect(webhook.Webhooks[0].ObjectSelector.MatchLabels).To(Equal(map[string]string{"auto-vpa": "enabled"}))
+	})
+})
+
+var _ = Describe("checkWebhookConfig", func() {
 	var (
+		ctx           context.Context
 		fakeClientset *fake.Clientset
-		data          = goalresolvers.CertificateData{
-			CaCertPem:     []byte("caCert"),
-			CaKeyPem:      []byte("caKeyPem"),
-			ServerCertPem: []byte("serverCertPem"),
-			ServerKeyPem:  []byte("serverKeyPem"),
-		}
-		ctx = log.NewLogger(3).WithLogger(context.TODO())
-		s   *corev1.Secret
+		webhook       *admissionregistration.MutatingWebhookConfiguration
+		service       *corev1.Service
 	)
 
 	BeforeEach(func() {
 		config.NewConfig()
-		s = secret(config.AppConfig.Namespace)
-		fakeClientset = fake.NewSimpleClientset(s, prepareCM(config.AppConfig.Namespace))
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		webhook = mutatingWebhookConfiguration(false)
+		service = webhookService()
+		fakeClientset = fake.NewSimpleClientset(service)
 	})
 
-	It("update secret error", func() {
-		fakeClientset.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
-			return true, nil, fmt.Errorf("update secrets error")
-		})
+	It("valid", func() {
+		result := &Result{}
+		Expect(checkWebhookConfig(ctx, fakeClientset, result, webhook, false)).To(Succeed())
+		Expect(result.Warnings).To(BeEmpty())
+	})
 
-		cerr := updateTlsSecret(ctx, fakeClientset, data, s)
-		Expect(cerr).NotTo(BeNil())
+	It("warns about a missing service", func() {
+		result := &Result{}
+		Expect(checkWebhookConfig(ctx, fake.NewSimpleClientset(), result, webhook, false)).To(Succeed())
+		Expect(result.Warnings).To(ConsistOf(ContainSubstring("webhooks[0].clientConfig.service: service kube-system/webhook-tls-manager-webhook-config could not be checked")))
 	})
 
-	It("update secret succeed", func() {
-		cerr := updateTlsSecret(ctx, fakeClientset, data, s)
-		Expect(cerr).To(BeNil())
+	It("reports every problem", func() {
+		webhook.Name = "vpa-webhook-config"
+		webhook.Webhooks[0].Name = "vpa"
+		webhook.Webhooks[0].AdmissionReviewVersions = []string{"v2"}
+		webhook.Webhooks[0].SideEffects = nil
+		webhook.Webhooks[0].Rules[0].Resources = nil
+		port := int32(8443)
+		webhook.Webhooks[0].ClientConfig.Service.Port = &port
+		dryRuns := 0
+		dryRunWebhookFunc = func(context.Context, kubernetes.Interface, *admissionregistration.MutatingWebhookConfiguration, bool) error {
+			dryRuns++
+			return nil
+		}
 
-		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		err := checkWebhookConfig(ctx, fakeClientset, &Result{}, webhook, false)
+
+		Expect(errors.Is(err, errdefs.ErrConfigMapInvalid)).To(BeTrue())
+		for _, problem := range []string{
+			`metadata.name: "vpa-webhook-config" differs from the managed name "webhook-tls-manager-webhook-config"`,
+			`webhooks[0].name: "vpa" must be fully qualified`,
+			`webhooks[0].admissionReviewVersions: "v2" is not supported`,
+			`webhooks[0].sideEffects: required`,
+			`webhooks[0].rules[0].resources: required`,
+			`webhooks[0].clientConfig.service.port: service kube-system/webhook-tls-manager-webhook-config has no port 8443`,
+		} {
+			Expect(err.Error()).To(ContainSubstring(problem))
+		}
+		Expect(dryRuns).To(Equal(0))
+	})
+
+	It("reports a configuration rejected by the dry-run", func() {
+		dryRunWebhookFunc = func(_ context.Context, _ kubernetes.Interface, applied *admissionregistration.MutatingWebhookConfiguration, exists bool) error {
+			Expect(exists).To(BeTrue())
+			return k8serrors.NewInvalid(schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}, applied.Name, nil)
+		}
+		err := checkWebhookConfig(ctx, fakeClientset, &Result{}, webhook, true)
+		Expect(errors.Is(err, errdefs.ErrConfigMapInvalid)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("rejected by the API server"))
+	})
+
+	It("dry-run maps invalid and failed requests", func() {
+		fakeClientset.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, k8serrors.NewInvalid(schema.GroupKind{Kind: "MutatingWebhookConfiguration"}, webhook.Name, nil)
+		})
+		fakeClientset.PrependReactor("patch", "mutatingwebhookconfigurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("connection refused")
+		})
+		Expect(k8serrors.IsInvalid(dryRunWebhook(ctx, fakeClientset, webhook, false))).To(BeTrue())
+		var apiErr *errdefs.APIError
+		Expect(errors.As(dryRunWebhook(ctx, fakeClientset, webhook, true), &apiErr)).To(BeTrue())
+	})
+
+	It("refuses to create a webhook whose name differs from the managed name", func() {
+		cm := prepareCM(config.AppConfig.Namespace)
+		cm.Data["mutatingWebhookConfig"] = strings.Replace(cm.Data["mutatingWebhookConfig"], "name: webhook-tls-manager-webhook-config", "name: vpa-webhook-config", 1)
+		fakeClientset = fake.NewSimpleClientset(cm)
+		err := createMutatingWebhookConfig(ctx, fakeClientset, &Result{}, []byte("caCert"), false)
+		Expect(errors.Is(err, errdefs.ErrConfigMapInvalid)).To(BeTrue())
+		webhooks, listErr := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+		Expect(listErr).To(BeNil())
+		Expect(webhooks.Items).To(BeEmpty())
+	})
+
+	It("Validate changes nothing", func() {
+		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace), managedSecret(config.AppConfig.Namespace))
+		var dryRun *admissionregistration.MutatingWebhookConfiguration
+		dryRunWebhookFunc = func(_ context.Context, _ kubernetes.Interface, applied *admissionregistration.MutatingWebhookConfiguration, exists bool) error {
+			Expect(exists).To(BeFalse())
+			dryRun = applied
+			return nil
+		}
+		result, err := Validate(ctx, fakeClientset, false)
 		Expect(err).To(BeNil())
-		Expect(secret.Data["caCert.pem"]).To(BeEquivalentTo("caCert"))
+		Expect(result.Actions).To(BeEmpty())
+		Expect(result.Warnings).To(HaveLen(1))
+		Expect(dryRun.Webhooks[0].ClientConfig.CABundle).To(Equal([]byte("testCaCert")))
+		webhooks, listErr := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+		Expect(listErr).To(BeNil())
+		Expect(webhooks.Items).To(BeEmpty())
 	})
 })
 
-var _ = Describe("getMutatingWebhookConfigFromConfigmap", func() {
+var _ = Describe("trackCABundleDrift", func() {
 	var (
+		ctx           context.Context
 		fakeClientset *fake.Clientset
-		caCertPem     = []byte("caCert")
-		ctx           = log.NewLogger(3).WithLogger(context.TODO())
+		webhook       *admissionregistration.MutatingWebhookConfiguration
+		bundle        = []byte("caCert")
 	)
 
+	caBundleOwnedBy := func(manager string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{
+			Manager:    manager,
+			Operation:  metav1.ManagedFieldsOperationUpdate,
+			APIVersion: "admissionregistration.k8s.io/v1",
+			FieldsType: "FieldsV1",
+			FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:webhooks":{"k:{\"name\":\"vpa.k8s.io\"}":{".":{},"f:clientConfig":{"f:caBundle":{}}}}}`)},
+		}
+	}
+
 	BeforeEach(func() {
 		config.NewConfig()
-		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		metrics.SetCABundleContested("")
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		webhook = mutatingWebhookConfiguration(false)
+		webhook.Webhooks[0].ClientConfig.CABundle = []byte("cainjectorCaCert")
+		webhook.ManagedFields = []metav1.ManagedFieldsEntry{caBundleOwnedBy(consts.FieldManager), caBundleOwnedBy("cainjector")}
+		webhook.Annotations = map[string]string{consts.CABundleFingerprintAnnotation: bundleFingerprint(bundle)}
 	})
 
-	It("success", func() {
-		webhook, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, caCertPem, true)
+	It("ignores a caBundle only this job owns", func() {
+		webhook.ManagedFields = webhook.ManagedFields[:1]
+		fakeClientset = fake.NewSimpleClientset(webhook)
+		contested, err := trackCABundleDrift(ctx, fakeClientset, &Result{}, webhook)
 		Expect(err).To(BeNil())
-		Expect(webhook.Webhooks[0].Name).To(Equal("vpa.k8s.io"))
+		Expect(contested).To(BeFalse())
+		Expect(fakeClientset.Actions()).To(BeEmpty())
 	})
 
-	It("get configmap error", func() {
-		fakeClientset = fake.NewSimpleClientset()
-		webhook, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, caCertPem, true)
-		Expect(err).NotTo(BeNil())
-		Expect(webhook).To(BeNil())
+	It("records a caBundle changed by another field manager", func() {
+		fakeClientset = fake.NewSimpleClientset(webhook)
+		flips := testutil.ToFloat64(metrics.CABundleFlipsMetric.WithLabelValues("cainjector"))
+		result := &Result{}
+
+		contested, err := trackCABundleDrift(ctx, fakeClientset, result, webhook)
+
+		Expect(err).To(BeNil())
+		Expect(contested).To(BeFalse())
+		Expect(result.Warnings).To(ConsistOf(ContainSubstring("was changed by cainjector")))
+		Expect(testutil.ToFloat64(metrics.CABundleFlipsMetric.WithLabelValues("cainjector"))).To(Equal(flips + 1))
+		tracked, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, webhook.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(tracked.Annotations).To(HaveKeyWithValue(consts.CABundleFlipsAnnotation, "1"))
+		Expect(tracked.Annotations).To(HaveKeyWithValue(consts.CABundleFlipManagerAnnotation, "cainjector"))
+		Expect(tracked.Annotations).To(HaveKey(consts.CABundleLastFlipAnnotation))
 	})
 
-	It("get data error", func() {
-		fakeClientset = fake.NewSimpleClientset(&corev1.ConfigMap{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "webhook-tls-manager-webhook-config",
-			},
-		})
-		webhook, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, caCertPem, true)
-		Expect(err).NotTo(BeNil())
-		Expect(webhook).To(BeNil())
+	It("backs off once the threshold is reached", func() {
+		webhook.Annotations[consts.CABundleFlipsAnnotation] = "2"
+		fakeClientset = fake.NewSimpleClientset(webhook)
+		result := &Result{}
+
+		contested, err := trackCABundleDrift(ctx, fakeClientset, result, webhook)
+
+		Expect(err).To(BeNil())
+		Expect(contested).To(BeTrue())
+		Expect(result.Actions).To(ContainElement(ObjectAction{Kind: webhookKind, Name: webhook.Name, Action: ActionSkipped, Reason: contestedReason}))
+		Expect(testutil.ToFloat64(metrics.CABundleContestedMetric.WithLabelValues("cainjector"))).To(Equal(float64(1)))
+		events, err := fakeClientset.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+		Expect(err).To(BeNil())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].Reason).To(Equal("CABundleContested"))
+		Expect(events.Items[0].Message).To(ContainSubstring("changed by cainjector in 3 consecutive runs"))
+	})
+
+	It("stays backed off without counting further flips", func() {
+		webhook.Annotations[consts.CABundleFlipsAnnotation] = "3"
+		fakeClientset = fake.NewSimpleClientset(webhook)
+
+		contested, err := trackCABundleDrift(ctx, fakeClientset, &Result{}, webhook)
+
+		Expect(err).To(BeNil())
+		Expect(contested).To(BeTrue())
+		Expect(fakeClientset.Actions()).To(BeEmpty())
+	})
+
+	It("never backs off with a threshold of 0", func() {
+		Expect(config.UpdateDriftConfig(0)).To(Succeed())
+		webhook.Annotations[consts.CABundleFlipsAnnotation] = "10"
+		fakeClientset = fake.NewSimpleClientset(webhook)
+
+		contested, err := trackCABundleDrift(ctx, fakeClientset, &Result{}, webhook)
+
+		Expect(err).To(BeNil())
+		Expect(contested).To(BeFalse())
+	})
+
+	It("clears the record once the caBundle is no longer changed", func() {
+		webhook.Annotations[consts.CABundleFlipsAnnotation] = "2"
+		webhook.Annotations[consts.CABundleFlipManagerAnnotation] = "cainjector"
+		webhook.Annotations["team"] = "autoscaling"
+		webhook.Webhooks[0].ClientConfig.CABundle = bundle
+		fakeClientset = fake.NewSimpleClientset(webhook)
+
+		contested, err := trackCABundleDrift(ctx, fakeClientset, &Result{}, webhook)
+
+		Expect(err).To(BeNil())
+		Expect(contested).To(BeFalse())
+		cleared, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, webhook.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(cleared.Annotations).To(Equal(map[string]string{consts.CABundleFingerprintAnnotation: bundleFingerprint(bundle), "team": "autoscaling"}))
+	})
+
+	It("ignores a webhook without the fingerprint of the last written caBundle", func() {
+		delete(webhook.Annotations, consts.CABundleFingerprintAnnotation)
+		fakeClientset = fake.NewSimpleClientset(webhook)
+
+		contested, err := trackCABundleDrift(ctx, fakeClientset, &Result{}, webhook)
+
+		Expect(err).To(BeNil())
+		Expect(contested).To(BeFalse())
+		Expect(fakeClientset.Actions()).To(BeEmpty())
+	})
+
+	It("does not count a rotation by this job as a flip", func() {
+		// The previous owner, e.g. of an adopted webhook, still co-owns the caBundle this job wrote.
+		webhook.Webhooks[0].ClientConfig.CABundle = bundle
+		fakeClientset = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), webhook, prepareCM(config.AppConfig.Namespace))
+		rotated := caBundle(managedSecret(config.AppConfig.Namespace))
+		Expect(rotated).NotTo(Equal(bundle))
+		flips := testutil.ToFloat64(metrics.CABundleFlipsMetric.WithLabelValues("cainjector"))
+		result := &Result{}
+
+		Expect(createOrUpdateWebhook(ctx, fakeClientset, result, false)).To(Succeed())
+
+		Expect(result.Warnings).NotTo(ContainElement(ContainSubstring("was changed by")))
+		Expect(testutil.ToFloat64(metrics.CABundleFlipsMetric.WithLabelValues("cainjector"))).To(Equal(flips))
+		current, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, webhook.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(current.Webhooks[0].ClientConfig.CABundle).To(Equal(rotated))
+		Expect(current.Annotations).To(HaveKeyWithValue(consts.CABundleFingerprintAnnotation, bundleFingerprint(rotated)))
+		Expect(current.Annotations).NotTo(HaveKey(consts.CABundleFlipsAnnotation))
+
+		// The co-owner changing the rotated caBundle is still a flip.
+		current.Webhooks[0].ClientConfig.CABundle = []byte("cainjectorCaCert")
+		current.ManagedFields = webhook.ManagedFields
+		contested, err := trackCABundleDrift(ctx, fakeClientset, result, current)
+		Expect(err).To(BeNil())
+		Expect(contested).To(BeFalse())
+		Expect(result.Warnings).To(ContainElement(ContainSubstring("was changed by cainjector")))
+	})
+
+	It("does not update a contested webhook", func() {
+		webhook.Annotations[consts.CABundleFlipsAnnotation] = "3"
+		fakeClientset = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), webhook, prepareCM(config.AppConfig.Namespace))
+
+		Expect(createOrUpdateWebhook(ctx, fakeClientset, &Result{}, false)).To(Succeed())
+
+		current, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, webhook.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(current.Webhooks[0].ClientConfig.CABundle).To(Equal([]byte("cainjectorCaCert")))
 	})
 })
 
-var _ = Describe("createMutatingWebhookConfig test", func() {
+var _ = Describe("Verify", func() {
+	const serverName = "webhook-tls-manager-webhook-config.kube-system.svc"
 	var (
-		fakeClientset *fake.Clientset
-		caCertPem     = []byte("caCert")
-		ctx           = log.NewLogger(3).WithLogger(context.TODO())
+		ctx            context.Context
+		caCert         *x509.Certificate
+		caKey          *rsa.PrivateKey
+		currentCert    *x509.Certificate
+		currentKey     *rsa.PrivateKey
+		secret         *corev1.Secret
+		webhook        *admissionregistration.MutatingWebhookConfiguration
+		service        *corev1.Service
+		servers        []*httptest.Server
+		endpointSlices []runtime.Object
 	)
 
-	BeforeEach(func() {
-		config.NewConfig()
-		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+	// serve serves cert on a local TLS server and adds it as a ready endpoint of the webhook service.
+	serve := func(cert *x509.Certificate, key *rsa.PrivateKey) *httptest.Server {
+		server := startTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), cert, key)
+		servers = append(servers, server)
+		endpointSlices = append(endpointSlices, serverEndpointSlice(service, server, len(endpointSlices)))
+		return server
+	}
+
+	verify := func() (*Result, error) {
+		objects := append([]runtime.Object{secret, webhook, service}, endpointSlices...)
+		return Verify(ctx, fake.NewSimpleClientset(objects...))
+	}
+
+	BeforeEach(func() {
+		config.NewConfig()
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		servers, endpointSlices = nil, nil
+		caCert, caKey = testCertificate(nil, nil, "")
+		currentCert, currentKey = testCertificate(caCert, caKey, serverName)
+		secret = managedSecret(config.AppConfig.Namespace)
+		secret.Data = map[string][]byte{"caCert.pem": pemCertificate(caCert), "serverCert.pem": pemCertificate(currentCert)}
+		webhook = mutatingWebhookConfiguration(true)
+		webhook.Webhooks[0].ClientConfig.CABundle = pemCertificate(caCert)
+		service = webhookService()
+	})
+
+	AfterEach(func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	})
+
+	It("reports an endpoint serving the current certificate", func() {
+		serve(currentCert, currentKey)
+
+		result, err := verify()
+
+		Expect(err).To(BeNil())
+		Expect(result.Warnings).To(BeEmpty())
+		Expect(result.Endpoints).To(HaveLen(1))
+		Expect(result.Endpoints[0].Webhook).To(Equal("vpa.k8s.io"))
+		Expect(result.Endpoints[0].ServerName).To(Equal(serverName))
+		Expect(result.Endpoints[0].Serving).To(Equal(ServingCurrent))
+		Expect(result.Endpoints[0].Trusted).To(BeTrue())
+	})
+
+	It("warns about an endpoint still serving the previous certificate", func() {
+		previousCert, previousKey := testCertificate(caCert, caKey, serverName)
+		secret.Data[previousKeyPrefix+"serverCert.pem"] = pemCertificate(previousCert)
+		serve(currentCert, currentKey)
+		serve(previousCert, previousKey)
+
+		result, err := verify()
+
+		Expect(err).To(BeNil())
+		Expect(result.Endpoints).To(HaveLen(2))
+		Expect(result.Endpoints[1].Serving).To(Equal(ServingPrevious))
+		Expect(result.Endpoints[1].Trusted).To(BeTrue())
+		Expect(result.Warnings).To(ConsistOf(ContainSubstring("serves the previous certificate")))
+	})
+
+	It("fails on an endpoint serving a certificate the caBundle does not trust", func() {
+		otherCA, otherCAKey := testCertificate(nil, nil, "")
+		serve(testCertificate(otherCA, otherCAKey, serverName))
+
+		result, err := verify()
+
+		Expect(errors.Is(err, errdefs.ErrEndpointUntrusted)).To(BeTrue())
+		Expect(errdefs.Reason(err)).To(Equal(errdefs.ReasonEndpointUntrusted))
+		Expect(result.Endpoints).To(HaveLen(1))
+		Expect(result.Endpoints[0].Serving).To(Equal(ServingUnknown))
+		Expect(result.Endpoints[0].Trusted).To(BeFalse())
+		Expect(result.Endpoints[0].Error).To(ContainSubstring("unknown authority"))
+	})
+
+	It("fails on an endpoint serving a certificate for another server name", func() {
+		serve(testCertificate(caCert, caKey, "other.kube-system.svc"))
+
+		result, err := verify()
+
+		Expect(errors.Is(err, errdefs.ErrEndpointUntrusted)).To(BeTrue())
+		Expect(result.Endpoints[0].Trusted).To(BeFalse())
+		Expect(result.Endpoints[0].Error).To(ContainSubstring(serverName))
+	})
+
+	It("fails on an unreachable endpoint", func() {
+		serve(currentCert, currentKey).Close()
+
+		result, err := verify()
+
+		Expect(errors.Is(err, errdefs.ErrEndpointUntrusted)).To(BeTrue())
+		Expect(result.Endpoints).To(HaveLen(1))
+		Expect(result.Endpoints[0].Serving).To(Equal(ServingUnreachable))
+		Expect(result.Endpoints[0].Error).NotTo(BeEmpty())
+	})
+
+	It("warns about a webhook without ready endpoints", func() {
+		result, err := verify()
+
+		Expect(err).To(BeNil())
+		Expect(result.Endpoints).To(BeEmpty())
+		Expect(result.Warnings).To(ConsistOf(ContainSubstring("has no ready endpoints")))
+	})
+})
+
+var _ = Describe("Probe", func() {
+	const serverName = "webhook-tls-manager-webhook-config.kube-system.svc"
+	var (
+		ctx      context.Context
+		cert     *x509.Certificate
+		key      *rsa.PrivateKey
+		webhook  *admissionregistration.MutatingWebhookConfiguration
+		service  *corev1.Service
+		server   *httptest.Server
+		requests []*admissionv1.AdmissionReview
+		answer   func(review *admissionv1.AdmissionReview) interface{}
+	)
+
+	probe := func() (*Result, error) {
+		server = startTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			review := &admissionv1.AdmissionReview{}
+			Expect(json.NewDecoder(r.Body).Decode(review)).To(Succeed())
+			requests = append(requests, review)
+			Expect(json.NewEncoder(w).Encode(answer(review))).To(Succeed())
+		}), cert, key)
+		return Probe(ctx, fake.NewSimpleClientset(webhook, service, serverEndpointSlice(service, server, 0)))
+	}
+
+	BeforeEach(func() {
+		config.NewConfig()
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		requests = nil
+		caCert, caKey := testCertificate(nil, nil, "")
+		cert, key = testCertificate(caCert, caKey, serverName)
+		webhook = mutatingWebhookConfiguration(true)
+		webhook.Webhooks[0].ClientConfig.CABundle = pemCertificate(caCert)
+		webhook.Webhooks[0].ObjectSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"auto-vpa": "enabled"}}
+		service = webhookService()
+		answer = func(review *admissionv1.AdmissionReview) interface{} {
+			return &admissionv1.AdmissionReview{
+				TypeMeta: review.TypeMeta,
+				Response: &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true},
+			}
+		}
+	})
+
+	AfterEach(func() {
+		if server != nil {
+			server.Close()
+		}
+	})
+
+	It("sends a review matching the first rule and accepts an answer echoing its uid", func() {
+		probes := testutil.ToFloat64(metrics.WebhookProbesMetric.WithLabelValues("vpa.k8s.io", string(ProbeSucceeded)))
+
+		result, err := probe()
+
+		Expect(err).To(BeNil())
+		Expect(requests).To(HaveLen(1))
+		request := requests[0].Request
+		Expect(request.Resource).To(Equal(metav1.GroupVersionResource{Group: "autoscaling.k8s.io", Version: "v1", Resource: "verticalpodautoscalers"}))
+		Expect(request.Operation).To(Equal(admissionv1.Create))
+		Expect(*request.DryRun).To(BeTrue())
+		object := &metav1.PartialObjectMetadata{}
+		Expect(json.Unmarshal(request.Object.Raw, object)).To(Succeed())
+		Expect(object.Labels).To(Equal(map[string]string{"auto-vpa": "enabled"}))
+		Expect(result.Probes).To(HaveLen(1))
+		Expect(result.Probes[0].Status).To(Equal(ProbeSucceeded))
+		Expect(result.Probes[0].UID).To(Equal(string(request.UID)))
+		Expect(result.Probes[0].Allowed).To(BeTrue())
+		Expect(result.Probes[0].TimeoutSeconds).To(Equal(float64(3)))
+		Expect(testutil.ToFloat64(metrics.WebhookProbesMetric.WithLabelValues("vpa.k8s.io", string(ProbeSucceeded)))).To(Equal(probes + 1))
+	})
+
+	It("accepts a denial with a JSON patch", func() {
+		answer = func(review *admissionv1.AdmissionReview) interface{} {
+			patchType := admissionv1.PatchTypeJSONPatch
+			return &admissionv1.AdmissionReview{
+				TypeMeta: review.TypeMeta,
+				Response: &admissionv1.AdmissionResponse{UID: review.Request.UID, Patch: []byte(`[]`), PatchType: &patchType},
+			}
+		}
+
+		result, err := probe()
+
+		Expect(err).To(BeNil())
+		Expect(result.Probes[0].Allowed).To(BeFalse())
+	})
+
+	It("fails on an answer with another uid", func() {
+		answer = func(review *admissionv1.AdmissionReview) interface{} {
+			return &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: &admissionv1.AdmissionResponse{UID: "other", Allowed: true}}
+		}
+
+		result, err := probe()
+
+		Expect(errors.Is(err, errdefs.ErrProbeFailed)).To(BeTrue())
+		Expect(errdefs.Reason(err)).To(Equal(errdefs.ReasonProbeFailed))
+		Expect(result.Probes[0].Status).To(Equal(ProbeInvalidResponse))
+		Expect(result.Probes[0].Error).To(ContainSubstring("does not match the request uid"))
+	})
+
+	It("fails on an answer that is not an AdmissionReview", func() {
+		answer = func(*admissionv1.AdmissionReview) interface{} {
+			return map[string]bool{"allowed": true}
+		}
+
+		result, err := probe()
+
+		Expect(errors.Is(err, errdefs.ErrProbeFailed)).To(BeTrue())
+		Expect(result.Probes[0].Status).To(Equal(ProbeInvalidResponse))
+		Expect(result.Probes[0].Error).To(ContainSubstring("expected apiVersion admission.k8s.io/v1"))
+	})
+
+	It("fails on an answer slower than timeoutSeconds", func() {
+		timeout := int32(1)
+		webhook.Webhooks[0].TimeoutSeconds = &timeout
+		answer = func(review *admissionv1.AdmissionReview) interface{} {
+			time.Sleep(1500 * time.Millisecond)
+			return &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}}
+		}
+
+		result, err := probe()
+
+		Expect(errors.Is(err, errdefs.ErrProbeFailed)).To(BeTrue())
+		Expect(result.Probes[0].Status).To(Equal(ProbeTimedOut))
+	})
+
+	It("fails on an endpoint whose certificate the caBundle does not trust", func() {
+		otherCA, otherCAKey := testCertificate(nil, nil, "")
+		cert, key = testCertificate(otherCA, otherCAKey, serverName)
+
+		result, err := probe()
+
+		Expect(errors.Is(err, errdefs.ErrProbeFailed)).To(BeTrue())
+		Expect(requests).To(BeEmpty())
+		Expect(result.Probes[0].Status).To(Equal(ProbeUnreachable))
+		Expect(result.Probes[0].Error).To(ContainSubstring("unknown authority"))
+	})
+
+	It("does not probe a webhook not accepting v1 reviews", func() {
+		webhook.Webhooks[0].AdmissionReviewVersions = []string{"v1beta1"}
+
+		result, err := probe()
+
+		Expect(err).To(BeNil())
+		Expect(requests).To(BeEmpty())
+		Expect(result.Warnings).To(ConsistOf(ContainSubstring("does not accept admission.k8s.io/v1 reviews")))
+	})
+})
+
+var _ = Describe("updateBreakers", func() {
+	const serverName = "webhook-tls-manager-webhook-config.kube-system.svc"
+	var (
+		ctx      context.Context
+		caCert   *x509.Certificate
+		caKey    *rsa.PrivateKey
+		current  *admissionregistration.MutatingWebhookConfiguration
+		declared *admissionregistration.MutatingWebhookConfiguration
+		service  *corev1.Service
+		objects  []runtime.Object
+		server   *httptest.Server
+	)
+
+	// breakerAnnotation returns the breaker annotation of a webhook unhealthy since the given time.
+	breakerAnnotation := func(since time.Time, open bool) map[string]string {
+		encoded, err := json.Marshal(breakerState{"vpa.k8s.io": {UnhealthySince: since.UTC().Truncate(time.Second), Reason: "no ready endpoints", Open: open}})
+		Expect(err).To(BeNil())
+		return map[string]string{consts.BreakerAnnotation: string(encoded)}
+	}
+
+	serve := func(cert *x509.Certificate, key *rsa.PrivateKey) {
+		server = startTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), cert, key)
+		objects = append(objects, serverEndpointSlice(service, server, 0))
+	}
+
+	update := func() (*fake.Clientset, breakerState, bool, error) {
+		fakeClientset := fake.NewSimpleClientset(append([]runtime.Object{current, service}, objects...)...)
+		state, changed, err := updateBreakers(ctx, fakeClientset, &Result{}, current, declared)
+		return fakeClientset, state, changed, err
+	}
+
+	BeforeEach(func() {
+		config.NewConfig()
+		Expect(config.UpdateBreakerConfig(time.Minute, string(config.BreakerActionIgnore))).To(Succeed())
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		objects, server = nil, nil
+		caCert, caKey = testCertificate(nil, nil, "")
+		current = mutatingWebhookConfiguration(true)
+		declared = mutatingWebhookConfiguration(true)
+		declared.Webhooks[0].ClientConfig.CABundle = pemCertificate(caCert)
+		service = webhookService()
+	})
+
+	AfterEach(func() {
+		if server != nil {
+			server.Close()
+		}
+	})
+
+	It("records an unhealthy backend without opening the breaker before the threshold", func() {
+		fakeClientset, state, changed, err := update()
+
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeFalse())
+		Expect(state).To(HaveKey("vpa.k8s.io"))
+		Expect(state["vpa.k8s.io"].Open).To(BeFalse())
+		Expect(state["vpa.k8s.io"].Reason).To(Equal("no ready endpoints"))
+		recorded, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, current.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(recorded.Annotations).To(HaveKey(consts.BreakerAnnotation))
+	})
+
+	It("opens the breaker once the backend stayed unhealthy for the threshold", func() {
+		current.Annotations = breakerAnnotation(time.Now().Add(-2*time.Minute), false)
+
+		fakeClientset, state, changed, err := update()
+
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeTrue())
+		Expect(state.open()).To(Equal([]string{"vpa.k8s.io"}))
+		Expect(testutil.ToFloat64(metrics.WebhookBreakerOpenMetric.WithLabelValues("vpa.k8s.io"))).To(Equal(float64(1)))
+		events, err := fakeClientset.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+		Expect(err).To(BeNil())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].Reason).To(Equal("WebhookBreakerOpened"))
+		Expect(events.Items[0].Type).To(Equal(corev1.EventTypeWarning))
+	})
+
+	It("opens the breaker on an endpoint serving an untrusted certificate", func() {
+		current.Annotations = breakerAnnotation(time.Now().Add(-2*time.Minute), false)
+		otherCA, otherCAKey := testCertificate(nil, nil, "")
+		serve(testCertificate(otherCA, otherCAKey, serverName))
+
+		_, state, changed, err := update()
+
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeTrue())
+		Expect(state["vpa.k8s.io"].Open).To(BeTrue())
+		Expect(state["vpa.k8s.io"].Reason).To(ContainSubstring("untrusted certificate"))
+	})
+
+	It("closes the breaker once the backend is healthy", func() {
+		current.Annotations = breakerAnnotation(time.Now().Add(-time.Hour), true)
+		serve(testCertificate(caCert, caKey, serverName))
+
+		fakeClientset, state, changed, err := update()
+
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeTrue())
+		Expect(state).To(BeEmpty())
+		Expect(testutil.CollectAndCount(metrics.WebhookBreakerOpenMetric)).To(Equal(0))
+		closed, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, current.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(closed.Annotations).NotTo(HaveKey(consts.BreakerAnnotation))
+		events, err := fakeClientset.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+		Expect(err).To(BeNil())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].Reason).To(Equal("WebhookBreakerClosed"))
+	})
+
+	It("leaves webhooks whose failurePolicy is Ignore alone", func() {
+		ignore := admissionregistration.Ignore
+		declared.Webhooks[0].FailurePolicy = &ignore
+
+		fakeClientset, state, changed, err := update()
+
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeFalse())
+		Expect(state).To(BeEmpty())
+		Expect(fakeClientset.Actions()).To(BeEmpty())
+	})
+
+	It("switches the webhooks with an open breaker to Ignore", func() {
+		applyBreakers(ctx, declared, breakerState{"vpa.k8s.io": {Open: true}})
+
+		Expect(*declared.Webhooks[0].FailurePolicy).To(Equal(admissionregistration.Ignore))
+	})
+
+	It("removes the webhooks with an open breaker", func() {
+		Expect(config.UpdateBreakerConfig(time.Minute, string(config.BreakerActionRemove))).To(Succeed())
+
+		applyBreakers(ctx, declared, breakerState{"vpa.k8s.io": {Open: true}})
+
+		Expect(declared.Webhooks).To(BeEmpty())
+	})
+
+	It("applies an opened breaker to the webhook", func() {
+		current.Annotations = breakerAnnotation(time.Now().Add(-2*time.Minute), false)
+		cm := prepareCM(config.AppConfig.Namespace)
+		cm.Data["mutatingWebhookConfig"] = strings.Replace(cm.Data["mutatingWebhookConfig"], "failurePolicy: Ignore", "failurePolicy: Fail", 1)
+		fakeClientset := fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), current, cm)
+
+		Expect(createOrUpdateWebhook(ctx, fakeClientset, &Result{}, true)).To(Succeed())
+
+		updated, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, current.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(*updated.Webhooks[0].FailurePolicy).To(Equal(admissionregistration.Ignore))
+		Expect(updated.Annotations).To(HaveKey(consts.BreakerAnnotation))
+	})
+
+	It("reconciles a webhook removed by its breaker and restores it once the breaker closes", func() {
+		Expect(config.UpdateBreakerConfig(time.Minute, string(config.BreakerActionRemove))).To(Succeed())
+		current.Annotations = breakerAnnotation(time.Now().Add(-2*time.Minute), false)
+		cm := prepareCM(config.AppConfig.Namespace)
+		cm.Data["mutatingWebhookConfig"] = strings.NewReplacer(
+			"failurePolicy: Ignore", "failurePolicy: Fail",
+			"name: vpa-webhook", "name: "+service.Name,
+			"namespace: vpa-recommender", "namespace: "+service.Namespace,
+		).Replace(cm.Data["mutatingWebhookConfig"])
+		s := managedSecret(config.AppConfig.Namespace)
+		s.Data[caBundleKey] = pemCertificate(caCert)
+		fakeClientset := fake.NewSimpleClientset(s, current, cm, service)
+		get := func() *admissionregistration.MutatingWebhookConfiguration {
+			webhook, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, current.Name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			return webhook
+		}
+
+		Expect(createOrUpdateWebhook(ctx, fakeClientset, &Result{}, true)).To(Succeed())
+		Expect(get().Webhooks).To(BeEmpty())
+
+		// A run finding the webhook still removed neither trips over the empty webhooks nor applies
+		// them again while the breaker stays open.
+		fakeClientset.ClearActions()
+		result := &Result{}
+		Expect(createOrUpdateWebhook(ctx, fakeClientset, result, true)).To(Succeed())
+		Expect(get().Webhooks).To(BeEmpty())
+		for _, action := range fakeClientset.Actions() {
+			if action.GetResource().Resource == "mutatingwebhookconfigurations" {
+				Expect(action.GetVerb()).To(BeElementOf("get", "list", "watch"))
+			}
+		}
+		Expect(result.Actions).To(ConsistOf(ObjectAction{Kind: webhookKind, Name: current.Name, Action: ActionUnchanged}))
+
+		serve(testCertificate(caCert, caKey, serverName))
+		Expect(fakeClientset.Tracker().Add(objects[0])).To(Succeed())
+		Expect(createOrUpdateWebhook(ctx, fakeClientset, &Result{}, true)).To(Succeed())
+
+		restored := get()
+		Expect(restored.Webhooks).To(HaveLen(1))
+		Expect(*restored.Webhooks[0].FailurePolicy).To(Equal(admissionregistration.Fail))
+		Expect(restored.Annotations).NotTo(HaveKey(consts.BreakerAnnotation))
+	})
+})
+
+var _ = Describe("waitForBackends", func() {
+	var (
+		ctx     context.Context
+		webhook *admissionregistration.MutatingWebhookConfiguration
+		service *corev1.Service
+		server  *httptest.Server
+	)
+
+	BeforeEach(func() {
+		config.NewConfig()
+		Expect(config.UpdateReadinessConfig(100 * time.Millisecond)).To(BeNil())
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		webhook = mutatingWebhookConfiguration(true)
+		service = webhookService()
+		server = httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("returns once the service has ready endpoints", func() {
+		clientset := fake.NewSimpleClientset(service, serverEndpointSlice(service, server, 0))
+		Expect(waitForBackends(ctx, clientset, webhook)).To(BeNil())
+	})
+
+	It("returns ErrBackendNotReady when the service has no ready endpoints in time", func() {
+		err := waitForBackends(ctx, fake.NewSimpleClientset(service), webhook)
+		Expect(errors.Is(err, errdefs.ErrBackendNotReady)).To(BeTrue())
+		Expect(errdefs.Reason(err)).To(Equal(errdefs.ReasonBackendNotReady))
+		Expect(err.Error()).To(ContainSubstring("kube-system/webhook-tls-manager-webhook-config"))
+	})
+
+	It("does not wait if the readiness timeout is 0", func() {
+		Expect(config.UpdateReadinessConfig(0)).To(BeNil())
+		Expect(waitForBackends(ctx, fake.NewSimpleClientset(), webhook)).To(BeNil())
+	})
+
+	It("reports a cancelled job as cancelled", func() {
+		Expect(config.UpdateReadinessConfig(time.Minute)).To(BeNil())
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		err := waitForBackends(cancelled, fake.NewSimpleClientset(service), webhook)
+		Expect(err).NotTo(BeNil())
+		Expect(errors.Is(err, errdefs.ErrBackendNotReady)).To(BeFalse())
+	})
+
+	It("does not create the webhook configuration without ready endpoints", func() {
+		clientset := fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace), service)
+		cerr := createMutatingWebhookConfig(ctx, clientset, &Result{}, []byte("caCert"), true)
+		Expect(errors.Is(cerr, errdefs.ErrBackendNotReady)).To(BeTrue())
+		_, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("fails a reconcile registering the webhook configuration with ErrBackendNotReady", func() {
+		cm := prepareCM(config.AppConfig.Namespace)
+		cm.Data["mutatingWebhookConfig"] = strings.NewReplacer("name: vpa-webhook", "name: "+service.Name, "namespace: vpa-recommender", "namespace: "+service.Namespace).Replace(cm.Data["mutatingWebhookConfig"])
+		clientset := fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), cm, service)
+
+		cerr := createOrUpdateWebhook(ctx, clientset, &Result{}, true)
+
+		Expect(errdefs.Reason(cerr)).To(Equal(errdefs.ReasonBackendNotReady))
+		_, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("waits for the backends before a rotation writes the secret", func() {
+		clientset := fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		goal := &goalresolvers.WebhookTlsManagerGoal{
+			CertData:                   &goalresolvers.CertificateData{CaCertPem: []byte("CaCertPem"), CaKeyPem: []byte("CaKeyPem"), ServerCertPem: []byte("ServerCertPem"), ServerKeyPem: []byte("ServerKeyPem")},
+			IsWebhookTlsManagerEnabled: true,
+		}
+
+		cerr := rotateSecretAndWebhook(ctx, clientset, &Result{}, goal)
+
+		Expect(errdefs.Reason(cerr)).To(Equal(errdefs.ReasonBackendNotReady))
+		_, err := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Disable and Enable", func() {
+	var (
+		ctx           context.Context
+		fakeClientset *fake.Clientset
+		webhook       *admissionregistration.MutatingWebhookConfiguration
+	)
+
+	get := func(name string) *admissionregistration.MutatingWebhookConfiguration {
+		current, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		return current
+	}
+
+	BeforeEach(func() {
+		config.NewConfig()
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		webhook = mutatingWebhookConfiguration(true)
+		fakeClientset = fake.NewSimpleClientset(webhook)
+	})
+
+	It("switches the managed webhooks to Ignore and restores them", func() {
+		result, err := Disable(ctx, fakeClientset)
+
+		Expect(err).To(BeNil())
+		Expect(result.Actions).To(ConsistOf(ObjectAction{Kind: webhookKind, Name: webhook.Name, Action: ActionUpdated, Reason: "disabled"}))
+		disabled := get(webhook.Name)
+		Expect(*disabled.Webhooks[0].FailurePolicy).To(Equal(admissionregistration.Ignore))
+		Expect(disabled.Annotations).To(HaveKey(consts.DisabledAnnotation))
+		events, err := fakeClientset.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+		Expect(err).To(BeNil())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].Reason).To(Equal("WebhookDisabled"))
+
+		result, err = Enable(ctx, fakeClientset)
+
+		Expect(err).To(BeNil())
+		Expect(result.Actions).To(ConsistOf(ObjectAction{Kind: webhookKind, Name: webhook.Name, Action: ActionUpdated, Reason: "enabled"}))
+		enabled := get(webhook.Name)
+		Expect(enabled.Webhooks).To(Equal(webhook.Webhooks))
+		Expect(enabled.Annotations).NotTo(HaveKey(consts.DisabledAnnotation))
+	})
+
+	It("detaches the managed webhooks and restores them", func() {
+		Expect(config.UpdateDisableConfig("detach")).To(Succeed())
+
+		_, err := Disable(ctx, fakeClientset)
+
+		Expect(err).To(BeNil())
+		Expect(get(webhook.Name).Webhooks).To(BeEmpty())
+
+		_, err = Enable(ctx, fakeClientset)
+
+		Expect(err).To(BeNil())
+		Expect(get(webhook.Name).Webhooks).To(Equal(webhook.Webhooks))
+	})
+
+	It("keeps the recorded webhooks when disabled twice", func() {
+		_, err := Disable(ctx, fakeClientset)
+		Expect(err).To(BeNil())
+
+		result, err := Disable(ctx, fakeClientset)
+
+		Expect(err).To(BeNil())
+		Expect(result.Actions).To(ConsistOf(ObjectAction{Kind: webhookKind, Name: webhook.Name, Action: ActionUnchanged, Reason: "disabled"}))
+		_, err = Enable(ctx, fakeClientset)
+		Expect(err).To(BeNil())
+		Expect(*get(webhook.Name).Webhooks[0].FailurePolicy).To(Equal(admissionregistration.Fail))
+	})
+
+	It("leaves webhook configurations not managed alone", func() {
+		unmanaged := mutatingWebhookConfiguration(true)
+		unmanaged.Name = "other-webhook-config"
+		unmanaged.Labels = nil
+		fakeClientset = fake.NewSimpleClientset(webhook, unmanaged)
+
+		result, err := Disable(ctx, fakeClientset)
+
+		Expect(err).To(BeNil())
+		Expect(result.Actions).To(HaveLen(1))
+		Expect(get(unmanaged.Name)).To(Equal(unmanaged))
+	})
+
+	It("fails on a disabled annotation it cannot parse", func() {
+		webhook.Annotations = map[string]string{consts.DisabledAnnotation: "{"}
+		fakeClientset = fake.NewSimpleClientset(webhook)
+
+		_, err := Enable(ctx, fakeClientset)
+
+		Expect(errors.Is(err, errdefs.ErrDisabledStateInvalid)).To(BeTrue())
+		Expect(errdefs.Reason(err)).To(Equal(errdefs.ReasonDisabledStateInvalid))
+	})
+
+	It("does not enable a webhook whose backend is not ready", func() {
+		_, err := Disable(ctx, fakeClientset)
+		Expect(err).To(BeNil())
+		Expect(config.UpdateReadinessConfig(100 * time.Millisecond)).To(Succeed())
+
+		_, err = Enable(ctx, fakeClientset)
+
+		Expect(errors.Is(err, errdefs.ErrBackendNotReady)).To(BeTrue())
+		Expect(get(webhook.Name).Annotations).To(HaveKey(consts.DisabledAnnotation))
+	})
+
+	It("keeps a disabled webhook out of the request path on reconcile", func() {
+		fakeClientset = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), webhook, prepareCM(config.AppConfig.Namespace))
+		_, err := Disable(ctx, fakeClientset)
+		Expect(err).To(BeNil())
+		disabled := get(webhook.Name)
+		result := &Result{}
+
+		Expect(createOrUpdateWebhook(ctx, fakeClientset, result, true)).To(Succeed())
+
+		Expect(result.Warnings).To(ContainElement(ContainSubstring("is disabled since")))
+		reconciled := get(webhook.Name)
+		Expect(reconciled.Webhooks).To(Equal(disabled.Webhooks))
+		state, err := readDisabledState(reconciled)
+		Expect(err).To(BeNil())
+		bundle := caBundle(managedSecret(config.AppConfig.Namespace))
+		Expect(state.Webhooks[0].ClientConfig.CABundle).To(Equal(bundle))
+		Expect(state.Webhooks[0].ClientConfig.Service).To(Equal(webhook.Webhooks[0].ClientConfig.Service))
+		Expect(reconciled.Annotations).To(HaveKeyWithValue(consts.CABundleFingerprintAnnotation, bundleFingerprint(bundle)))
+
+		_, err = Enable(ctx, fakeClientset)
+		Expect(err).To(BeNil())
+		restored := webhook.Webhooks[0].DeepCopy()
+		restored.ClientConfig.CABundle = bundle
+		Expect(get(webhook.Name).Webhooks).To(Equal([]admissionregistration.MutatingWebhook{*restored}))
+	})
+
+	It("leaves the webhook configurations of other instances alone", func() {
+		other := mutatingWebhookConfiguration(true)
+		other.Name = "other-webhook-config"
+		other.Labels[consts.InstanceLabelKey] = "other"
+		fakeClientset = fake.NewSimpleClientset(webhook, other)
+
+		result, err := Disable(ctx, fakeClientset)
+
+		Expect(err).To(BeNil())
+		Expect(result.Actions).To(ConsistOf(ObjectAction{Kind: webhookKind, Name: webhook.Name, Action: ActionUpdated, Reason: "disabled"}))
+		Expect(get(other.Name)).To(Equal(other))
+	})
+})
+
+var _ = Describe("createTlsSecret", func() {
+	var (
+		fakeClientset *fake.Clientset
+		data          = goalresolvers.CertificateData{
+			CaCertPem:     []byte("caCert"),
+			CaKeyPem:      []byte("caKeyPem"),
+			ServerCertPem: []byte("serverCertPem"),
+			ServerKeyPem:  []byte("serverKeyPem"),
+		}
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+	)
+
+	BeforeEach(func() {
+		config.NewConfig()
+		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+	})
+
+	It("no secret exists", func() {
+		cerr := createTlsSecret(ctx, fakeClientset, &Result{}, data)
+		Expect(cerr).To(BeNil())
+		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(secret).NotTo(BeNil())
+		Expect(secret.Labels).To(Equal(map[string]string{
+			consts.ManagedLabelKey:        consts.ManagedLabelValue,
+			consts.InstanceLabelKey:       config.AppConfig.ObjectName,
+			consts.OwnerNamespaceLabelKey: config.AppConfig.Namespace,
+		}))
+	})
+
+	It("adds the extra labels and annotations", func() {
+		Expect(config.UpdateMetadataConfig(map[string]string{"team": "autoscaling", consts.InstanceLabelKey + "x": "y"}, nil)).NotTo(Succeed())
+		Expect(config.UpdateMetadataConfig(map[string]string{"team": "autoscaling"}, map[string]string{"backup.example.com/exclude": "true"})).To(Succeed())
+		cerr := createTlsSecret(ctx, fakeClientset, &Result{}, data)
+		Expect(cerr).To(BeNil())
+		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(secret.Labels).To(HaveKeyWithValue("team", "autoscaling"))
+		Expect(secret.Labels).To(HaveKeyWithValue(consts.ManagedLabelKey, consts.ManagedLabelValue))
+		Expect(secret.Annotations).To(HaveKeyWithValue("backup.example.com/exclude", "true"))
+		Expect(secret.Annotations).To(HaveKey(consts.RotationPhaseAnnotation))
+	})
+
+	It("create error", func() {
+		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		fakeClientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("create secrets error")
+		})
+		cerr := createTlsSecret(ctx, fakeClientset, &Result{}, data)
+		Expect(cerr).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("updateTlsSecret", func() {
+	var (
+		fakeClientset *fake.Clientset
+		data          = goalresolvers.CertificateData{
+			CaCertPem:     []byte("caCert"),
+			CaKeyPem:      []byte("caKeyPem"),
+			ServerCertPem: []byte("serverCertPem"),
+			ServerKeyPem:  []byte("serverKeyPem"),
+		}
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		s   *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		config.NewConfig()
+		s = secret(config.AppConfig.Namespace)
+		fakeClientset = fake.NewSimpleClientset(s, prepareCM(config.AppConfig.Namespace))
+	})
+
+	It("update secret error", func() {
+		fakeClientset.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("update secrets error")
+		})
+
+		cerr := updateTlsSecret(ctx, fakeClientset, &Result{}, data, s)
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("update secret succeed", func() {
+		cerr := updateTlsSecret(ctx, fakeClientset, &Result{}, data, s)
+		Expect(cerr).To(BeNil())
+
+		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(secret.Data["caCert.pem"]).To(BeEquivalentTo("caCert"))
+	})
+
+	It("applies only the fields it owns", func() {
+		s.Labels = map[string]string{"team": "autoscaling"}
+		s.Annotations = map[string]string{"backup.example.com/exclude": "true"}
+		fakeClientset = fake.NewSimpleClientset(s, prepareCM(config.AppConfig.Namespace))
+
+		Expect(updateTlsSecret(ctx, fakeClientset, &Result{}, data, s)).To(Succeed())
+
+		var patchTypes []types.PatchType
+		for _, action := range fakeClientset.Actions() {
+			Expect(action.GetVerb()).NotTo(Equal("update"))
+			if patch, ok := action.(k8stesting.PatchAction); ok {
+				patchTypes = append(patchTypes, patch.GetPatchType())
+				applied := &corev1.Secret{}
+				Expect(json.Unmarshal(patch.GetPatch(), applied)).To(Succeed())
+				Expect(applied.Labels).NotTo(HaveKey("team"))
+				Expect(applied.Data).To(HaveKey("previous-caCert.pem"))
+			}
+		}
+		Expect(patchTypes).To(Equal([]types.PatchType{types.ApplyPatchType}))
+		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(secret.Labels).To(HaveKeyWithValue("team", "autoscaling"))
+		Expect(secret.Annotations).To(HaveKeyWithValue("backup.example.com/exclude", "true"))
+		Expect(isManaged(secret.Labels)).To(BeTrue())
+	})
+
+	It("reports a conflict with another field manager", func() {
+		applies := 0
+		fakeClientset.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			applies++
+			return true, nil, k8serrors.NewApplyConflict([]metav1.StatusCause{{
+				Type:    metav1.CauseTypeFieldManagerConflict,
+				Message: `conflict with "kubectl-edit" using v1`,
+				Field:   ".data.caCert.pem",
+			}}, `Apply failed with 1 conflict: conflict with "kubectl-edit" using v1: .data.caCert.pem`)
+		})
+
+		cerr := updateTlsSecret(ctx, fakeClientset, &Result{}, data, s)
+
+		Expect(errors.Is(cerr, errdefs.ErrFieldConflict)).To(BeTrue())
+		Expect(cerr.Error()).To(ContainSubstring(`.data.caCert.pem: conflict with "kubectl-edit"`))
+		Expect(applies).To(Equal(1))
+	})
+
+	It("takes over fields it last wrote through an update", func() {
+		applies := 0
+		fakeClientset.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			applies++
+			if applies > 1 {
+				return false, nil, nil
+			}
+			return true, nil, k8serrors.NewApplyConflict([]metav1.StatusCause{{
+				Type:    metav1.CauseTypeFieldManagerConflict,
+				Message: `conflict with "webhook-tls-manager" using v1 at 2024-01-01T00:00:00Z`,
+				Field:   `.metadata.annotations.webhook-tls-manager.azure.com/rotation-phase`,
+			}}, "Apply failed with 1 conflict")
+		})
+
+		Expect(updateTlsSecret(ctx, fakeClientset, &Result{}, data, s)).To(Succeed())
+		Expect(applies).To(Equal(2))
+	})
+
+	It("removes the previous certificates when they are revoked", func() {
+		Expect(updateTlsSecret(ctx, fakeClientset, &Result{}, data, s)).To(Succeed())
+		written, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		revoked := data
+		revoked.CaCertPem = []byte("revokedCaCert")
+		revoked.RevokePrevious = true
+
+		Expect(updateTlsSecret(ctx, fakeClientset, &Result{}, revoked, written)).To(Succeed())
+
+		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(secret.Data).To(HaveKeyWithValue("caCert.pem", []byte("revokedCaCert")))
+		for _, key := range certificateKeys {
+			Expect(secret.Data).NotTo(HaveKey(previousKeyPrefix + key))
+		}
+	})
+
+	It("keeps the previous certificates", func() {
+		cerr := updateTlsSecret(ctx, fakeClientset, &Result{}, data, s)
+		Expect(cerr).To(BeNil())
+
+		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(secret.Data["previous-caCert.pem"]).To(BeEquivalentTo("testCaCert"))
+		Expect(secret.Data["previous-caKey.pem"]).To(BeEquivalentTo("testCaKey"))
+		Expect(secret.Data["previous-serverCert.pem"]).To(BeEquivalentTo("testServerCert"))
+		Expect(secret.Data["previous-serverKey.pem"]).To(BeEquivalentTo("testServerKey"))
+	})
+
+	It("keeps the previous certificates when the same certificates are written again", func() {
+		Expect(updateTlsSecret(ctx, fakeClientset, &Result{}, data, s)).To(BeNil())
+		written, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(updateTlsSecret(ctx, fakeClientset, &Result{}, data, written)).To(BeNil())
+
+		secret, err := fakeClientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(secret.Data["previous-caCert.pem"]).To(BeEquivalentTo("testCaCert"))
+	})
+})
+
+var _ = Describe("bundleContainsCA", func() {
+	It("finds the CA in a re-encoded bundle by fingerprint", func() {
+		ca, _ := testCertificate(nil, nil, "")
+		other, _ := testCertificate(nil, nil, "")
+		caPem := pemCertificate(ca)
+		bundle := bytes.ReplaceAll(append(pemCertificate(other), caPem...), []byte("\n"), []byte("\r\n"))
+
+		Expect(bundleContainsCA(bundle, caPem)).To(BeTrue())
+		Expect(bundleContainsCA(pemCertificate(other), caPem)).To(BeFalse())
+		Expect(bundleContainsCA(nil, caPem)).To(BeFalse())
+	})
+})
+
+var _ = Describe("rollbackSecret", func() {
+	It("restores only the certificates and the rotation annotations", func() {
+		config.NewConfig()
+		ctx := log.NewLogger(3).WithLogger(context.TODO())
+		previous := managedSecret(config.AppConfig.Namespace)
+		setRotationAnnotations(previous, RotationPhaseComplete, goalresolvers.CertificateData{CaCertPem: previous.Data["caCert.pem"], ServerCertPem: previous.Data["serverCert.pem"]})
+		current := previous.DeepCopy()
+		current.ResourceVersion = "2"
+		for _, key := range certificateKeys {
+			current.Data[previousKeyPrefix+key] = current.Data[key]
+			current.Data[key] = []byte("new" + key)
+		}
+		setRotationAnnotations(current, RotationPhaseSecretWritten, goalresolvers.CertificateData{CaCertPem: current.Data["caCert.pem"], ServerCertPem: current.Data["serverCert.pem"]})
+		current.Annotations[consts.ForcedRotationReasonAnnotation] = "INC-1234"
+		// Added by others after the rotation read the secret.
+		current.Annotations["backup.example.com/exclude"] = "true"
+		current.Data["extra.pem"] = []byte("extra")
+		client := fake.NewSimpleClientset(current)
+
+		Expect(rollbackSecret(ctx, client, &Result{}, previous)).To(Succeed())
+
+		restored, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(restored.Data).To(Equal(mergeSecretData(previous.Data, map[string][]byte{"extra.pem": []byte("extra")})))
+		Expect(restored.Annotations).To(Equal(mergeMetadata(previous.Annotations, map[string]string{"backup.example.com/exclude": "true"})))
+		expectNoUpdates(client)
+	})
+})
+
+var _ = Describe("Rollback", func() {
+	var (
+		ctx    context.Context
+		client *fake.Clientset
+		s      *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		config.NewConfig()
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		s = managedSecret(config.AppConfig.Namespace)
+		s.Data["previous-caCert.pem"] = []byte("previousCaCert")
+		s.Data["previous-caKey.pem"] = []byte("previousCaKey")
+		s.Data["previous-serverCert.pem"] = []byte("previousServerCert")
+		s.Data["previous-serverKey.pem"] = []byte("previousServerKey")
+		client = fake.NewSimpleClientset(s, mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
+	})
+
+	It("restores the previous certificates to the secret and the webhook", func() {
+		result, cerr := Rollback(ctx, client, false)
+		Expect(cerr).To(BeNil())
+		Expect(result.Rotated).To(BeTrue())
+		Expect(result.Actions).To(ContainElement(ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionRolledBack, Reason: "rollback"}))
+
+		restored, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(restored.Data["caCert.pem"]).To(BeEquivalentTo("previousCaCert"))
+		Expect(restored.Data["serverKey.pem"]).To(BeEquivalentTo("previousServerKey"))
+		Expect(restored.Data["previous-caCert.pem"]).To(BeEquivalentTo("testCaCert"))
+		Expect(restored.Annotations[consts.RotationPhaseAnnotation]).To(Equal(string(RotationPhaseComplete)))
+		webhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(webhook.Webhooks[0].ClientConfig.CABundle).To(BeEquivalentTo("previousCaCert\ntestCaCert"))
+	})
+
+	It("fails without previous certificates", func() {
+		current := secret(config.AppConfig.Namespace)
+		current.Labels = s.Labels
+		client = fake.NewSimpleClientset(current, prepareCM(config.AppConfig.Namespace))
+
+		_, cerr := Rollback(ctx, client, false)
+		Expect(errors.Is(cerr, errdefs.ErrNoPreviousCertificates)).To(BeTrue())
+	})
+
+	It("refuses an unmanaged secret", func() {
+		s.Labels = nil
+		client = fake.NewSimpleClientset(s, prepareCM(config.AppConfig.Namespace))
+
+		_, cerr := Rollback(ctx, client, false)
+		Expect(errors.Is(cerr, errdefs.ErrUnmanagedObject)).To(BeTrue())
+	})
+
+	It("patch secret error", func() {
+		client.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("patch secrets error")
+		})
+
+		result, cerr := Rollback(ctx, client, false)
+		Expect(cerr).NotTo(BeNil())
+		Expect(result.Rotated).To(BeFalse())
+	})
+})
+
+var _ = Describe("getMutatingWebhookConfigFromConfigmap", func() {
+	var (
+		fakeClientset *fake.Clientset
+		caCertPem     = []byte("caCert")
+		ctx           = log.NewLogger(3).WithLogger(context.TODO())
+	)
+
+	BeforeEach(func() {
+		config.NewConfig()
+		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+	})
+
+	It("success", func() {
+		webhook, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, caCertPem, true)
+		Expect(err).To(BeNil())
+		Expect(webhook.Webhooks[0].Name).To(Equal("vpa.k8s.io"))
+	})
+
+	It("merges the metadata of the configmap, the extra metadata and the managed labels", func() {
+		cm := prepareCM(config.AppConfig.Namespace)
+		cm.Data["mutatingWebhookConfig"] = strings.Replace(cm.Data["mutatingWebhookConfig"], "  labels:\n",
+			"  annotations:\n    backup.example.com/exclude: \"true\"\n  labels:\n    team: from-yaml\n    admissions.enforcer/disabled: \"true\"\n", 1)
+		fakeClientset = fake.NewSimpleClientset(cm)
+		Expect(config.UpdateMetadataConfig(map[string]string{"team": "autoscaling", "app.kubernetes.io/part-of": "vpa"}, map[string]string{"owner.example.com/contact": "team@example.com"})).To(Succeed())
+
+		webhook, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, caCertPem, true)
+		Expect(err).To(BeNil())
+		Expect(webhook.Labels).To(Equal(map[string]string{
+			consts.ManagedLabelKey:        consts.ManagedLabelValue,
+			consts.InstanceLabelKey:       config.AppConfig.ObjectName,
+			consts.OwnerNamespaceLabelKey: config.AppConfig.Namespace,
+			"team":                        "autoscaling",
+			"app.kubernetes.io/part-of":   "vpa",
+		}))
+		Expect(webhook.Annotations).To(Equal(map[string]string{
+			"backup.example.com/exclude":         "true",
+			"owner.example.com/contact":          "team@example.com",
+			consts.CABundleFingerprintAnnotation: bundleFingerprint(caCertPem),
+		}))
+	})
+
+	It("generic profile sets its managed label and no admissions enforcer label", func() {
+		Expect(config.UpdateProfileConfig(config.ProfileGeneric, "", "", nil, false)).To(Succeed())
+		webhook, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, caCertPem, false)
+		Expect(err).To(BeNil())
+		Expect(webhook.Labels).To(HaveKeyWithValue(consts.ManagedLabelKey, config.GenericManagedLabelValue))
+		Expect(webhook.Labels).NotTo(HaveKey(consts.AdmissionEnforcerDisabledLabel))
+	})
+
+	It("get configmap error", func() {
+		fakeClientset = fake.NewSimpleClientset()
+		webhook, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, caCertPem, true)
+		Expect(err).NotTo(BeNil())
+		Expect(webhook).To(BeNil())
+	})
+
+	It("get data error", func() {
+		fakeClientset = fake.NewSimpleClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "webhook-tls-manager-webhook-config",
+			},
+		})
+		webhook, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, caCertPem, true)
+		Expect(err).NotTo(BeNil())
+		Expect(webhook).To(BeNil())
+	})
+})
+
+var _ = Describe("createMutatingWebhookConfig test", func() {
+	var (
+		fakeClientset *fake.Clientset
+		caCertPem     = []byte("caCert")
+		ctx           = log.NewLogger(3).WithLogger(context.TODO())
+	)
+
+	BeforeEach(func() {
+		config.NewConfig()
+		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+	})
+
+	It("success", func() {
+		name := "webhook-tls-manager-webhook-config"
+		cerr := createMutatingWebhookConfig(ctx, fakeClientset, &Result{}, caCertPem, true)
+		Expect(cerr).To(BeNil())
+		webhook, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(webhook.Webhooks[0].Name).To(Equal("vpa.k8s.io"))
+
+		_, keyExist := webhook.ObjectMeta.Labels[consts.AdmissionEnforcerDisabledLabel]
+		Expect(keyExist).To(BeFalse())
+		val, keyExist := webhook.ObjectMeta.Labels[consts.ManagedLabelKey]
+		Expect(keyExist).To(BeTrue())
+		Expect(val).To(BeEquivalentTo(consts.ManagedLabelValue))
+	})
+
+	It("mutatingWebhookConfig is empty", func() {
+		cm := prepareCM(config.AppConfig.Namespace)
+		cm.Data["mutatingWebhookConfig"] = ""
+		fakeClientset = fake.NewSimpleClientset(cm)
+		cerr := createMutatingWebhookConfig(ctx, fakeClientset, &Result{}, caCertPem, true)
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("getMutatingWebhookConfigFromConfigmap error", func() {
+		fakeClientset = fake.NewSimpleClientset()
+		cerr := createMutatingWebhookConfig(ctx, fakeClientset, &Result{}, caCertPem, true)
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("create error", func() {
+		fakeClientset.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("create webhook error")
+		})
+		cerr := createMutatingWebhookConfig(ctx, fakeClientset, &Result{}, caCertPem, true)
+		Expect(cerr).NotTo(BeNil())
+		webhook, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).NotTo(BeNil())
+		Expect(webhook).To(BeNil())
+	})
+
+	It("unblock kube-system namespace", func() {
+		cerr := createMutatingWebhookConfig(ctx, fakeClientset, &Result{}, caCertPem, false)
+		Expect(cerr).To(BeNil())
+		webhook, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+
+		_, keyExist := webhook.ObjectMeta.Labels[consts.AdmissionEnforcerDisabledLabel]
+		Expect(keyExist).To(BeTrue())
+	})
+})
+
+var _ = Describe("updateMutatingWebhookConfig test", func() {
+	var (
+		fakeClientset *fake.Clientset
+		ctx           = log.NewLogger(3).WithLogger(context.TODO())
+		webhook       *admissionregistration.MutatingWebhookConfiguration
+	)
+
+	BeforeEach(func() {
+		config.NewConfig()
+		webhook = mutatingWebhookConfiguration(true)
+		fakeClientset = fake.NewSimpleClientset(webhook, prepareCM(config.AppConfig.Namespace))
+	})
+
+	It("get webhook error", func() {
+		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, &Result{}, false, []byte{}, nil)
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("update webhook error", func() {
+		fakeClientset.PrependReactor("patch", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, nil, fmt.Errorf("update webhook error")
+		})
+		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, &Result{}, false, []byte{}, nil)
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("update webhook when kube-system is blocked", func() {
+		webhook.Labels[consts.AdmissionEnforcerDisabledLabel] = "true"
+		fakeClientset = fake.NewSimpleClientset(webhook, prepareCM(config.AppConfig.Namespace))
+		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, &Result{}, true, []byte{}, nil)
+		Expect(cerr).To(BeNil())
+		res, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		_, keyExist := res.Labels[consts.AdmissionEnforcerDisabledLabel]
+		Expect(keyExist).To(BeFalse())
+		Expect(res.Webhooks[0].ClientConfig.CABundle).To(BeEmpty())
+	})
+
+	It("removes the webhooks no longer in the configmap", func() {
+		stale := webhook.Webhooks[0]
+		stale.Name = "stale.k8s.io"
+		webhook.Webhooks = append(webhook.Webhooks, stale)
+		fakeClientset = fake.NewSimpleClientset(webhook, prepareCM(config.AppConfig.Namespace))
+
+		Expect(updateMutatingWebhookConfig(ctx, fakeClientset, &Result{}, true, []byte("caCert"), nil)).To(Succeed())
+
+		res, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(webhookNames(res)).To(Equal([]string{"vpa.k8s.io"}))
+		Expect(res.Webhooks[0].ClientConfig.CABundle).To(Equal([]byte("caCert")))
+	})
+
+	It("reports a conflict with another field manager", func() {
+		fakeClientset.PrependReactor("patch", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, nil, k8serrors.NewApplyConflict([]metav1.StatusCause{{
+				Type:    metav1.CauseTypeFieldManagerConflict,
+				Message: `conflict with "kubectl-client-side-apply" using admissionregistration.k8s.io/v1`,
+				Field:   `.webhooks[name="vpa.k8s.io"].clientConfig.caBundle`,
+			}}, "Apply failed with 1 conflict")
+		})
+
+		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, &Result{}, false, []byte("caCert"), nil)
+
+		Expect(errors.Is(cerr, errdefs.ErrFieldConflict)).To(BeTrue())
+		Expect(errdefs.Reason(cerr)).To(Equal(errdefs.ReasonFieldConflict))
+		Expect(cerr.Error()).To(ContainSubstring("kubectl-client-side-apply"))
+	})
+
+	It("keeps the labels and annotations set by others", func() {
+		webhook.Labels["team"] = "autoscaling"
+		webhook.Annotations = map[string]string{"backup.example.com/exclude": "true"}
+		fakeClientset = fake.NewSimpleClientset(webhook, prepareCM(config.AppConfig.Namespace))
+		Expect(config.UpdateMetadataConfig(map[string]string{"app.kubernetes.io/part-of": "vpa"}, map[string]string{"owner.example.com/contact": "team@example.com"})).To(Succeed())
+		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, &Result{}, true, []byte("test"), nil)
+		Expect(cerr).To(BeNil())
+		res, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(res.Labels).To(HaveKeyWithValue("team", "autoscaling"))
+		Expect(res.Labels).To(HaveKeyWithValue("app.kubernetes.io/part-of", "vpa"))
+		Expect(res.Annotations).To(Equal(map[string]string{
+			"backup.example.com/exclude":         "true",
+			"owner.example.com/contact":          "team@example.com",
+			consts.CABundleFingerprintAnnotation: bundleFingerprint([]byte("test")),
+		}))
+		fromConfigmap, err := getMutatingWebhookConfigFromConfigmap(ctx, fakeClientset, []byte("test"), true)
+		Expect(err).To(BeNil())
+		Expect(currentWebhookConfigAndConfigmapDifferent(ctx, res, fromConfigmap)).To(BeFalse())
+	})
+
+	It("update webhook when kube-system is unblocked", func() {
+		caCert := []byte("test")
+		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, &Result{}, false, caCert, nil)
+		Expect(cerr).To(BeNil())
+		res, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(res.Labels[consts.AdmissionEnforcerDisabledLabel]).To(BeEquivalentTo("true"))
+		Expect(res.Webhooks[0].ClientConfig.CABundle).To(BeEquivalentTo(caCert))
+	})
+})
+
+var _ = Describe("webhook tls manager reconciler reconcile", func() {
+	var (
+		ctx          context.Context
+		client       *fake.Clientset
+		mockctl      *gomock.Controller
+		goalresolver *mock_goal_resolvers.MockWebhookTlsManagerGoalResolverInterface
+		certData     goalresolvers.CertificateData
+	)
+
+	BeforeEach(func() {
+		config.NewConfig()
+		ctx = log.NewLogger(3).WithLogger(context.TODO())
+		mockctl = gomock.NewController(GinkgoT())
+		client = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
+		goalresolver = mock_goal_resolvers.NewMockWebhookTlsManagerGoalResolverInterface(mockctl)
+		certData = goalresolvers.CertificateData{
+			CaCertPem:     []byte("CaCertPem"),
+			CaKeyPem:      []byte("CaKeyPem"),
+			ServerCertPem: []byte("ServerCertPem"),
+			ServerKeyPem:  []byte("ServerKeyPem"),
+		}
+	})
+
+	It("goalresolver resolve fail", func() {
+		rerr := errors.New("GenerateCertificates error")
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(nil, rerr).AnyTimes()
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, err := reconciler.Reconcile(ctx)
+
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("reconcile fail: WebhookTlsManager disabled and cleanup error", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   false,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil).AnyTimes()
+		client = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), prepareCM(config.AppConfig.Namespace))
+		client.PrependReactor("delete", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("delete secrets error")
+		})
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("reconcile succeed: WebhookTlsManager disabled and cleanup succeed", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   false,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil).AnyTimes()
+
+		client = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), mutatingWebhookConfiguration(goal.IsKubeSystemNamespaceBlocked), prepareCM(config.AppConfig.Namespace))
+		reconciler := newTestReconciler(goalresolver, client)
+		result, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).To(BeNil())
+		Expect(result.Actions).To(ConsistOf(
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionDeleted},
+			ObjectAction{Kind: webhookKind, Name: config.WebhookConfigName(), Action: ActionDeleted},
+		))
+		Expect(result.Changed()).To(BeTrue())
+		Expect(testutil.ToFloat64(metrics.RotateCertificateMetric)).To(BeEquivalentTo(0))
+	})
+
+	It("reconcile succeed: update webhook", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+
+		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(goal.IsKubeSystemNamespaceBlocked), prepareCM(config.AppConfig.Namespace))
+		reconciler := newTestReconciler(goalresolver, client)
+		result, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).To(BeNil())
+		Expect(result.Rotated).To(BeTrue())
+		Expect(result.Actions).To(ConsistOf(
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionUpdated},
+			ObjectAction{Kind: webhookKind, Name: config.WebhookConfigName(), Action: ActionUpdated},
+		))
+		Expect(testutil.ToFloat64(metrics.RotateCertificateMetric)).To(BeEquivalentTo(1))
+
+		webhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(webhook).NotTo(BeNil())
+		Expect(webhook.Webhooks[0].ClientConfig.CABundle).To(BeEquivalentTo("CaCertPem\ntestCaCert"))
+		Expect(err).To(BeNil())
+		secret, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(secret).NotTo(BeNil())
+		Expect(err).To(BeNil())
+	})
+
+	It("reconcile succeed", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+
+		reconciler := newTestReconciler(goalresolver, client)
+		result, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).To(BeNil())
+		Expect(result.Rotated).To(BeTrue())
+		Expect(result.Attempts).To(Equal(1))
+		Expect(result.Actions).To(ConsistOf(
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionCreated},
+			ObjectAction{Kind: webhookKind, Name: config.WebhookConfigName(), Action: ActionCreated},
+		))
+
+		webhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(webhook).NotTo(BeNil())
+		Expect(err).To(BeNil())
+		secret, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(secret).NotTo(BeNil())
+		Expect(err).To(BeNil())
+	})
+
+	It("reconcile succeed: record certificate metrics", func() {
+		caCert, _ := certificates.GetPEMCertificateString(time.Now().AddDate(30, 0, 0))
+		serverCert, _ := certificates.GetPEMCertificateString(time.Now().AddDate(2, 0, 0))
+		certData.CaCertPem = []byte(caCert)
+		certData.ServerCertPem = []byte(serverCert)
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			RotationReason:               goalresolvers.RotationReasonCertExpiring,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		rotations := testutil.ToFloat64(metrics.CertificateRotationsMetric.WithLabelValues(goalresolvers.RotationReasonCertExpiring))
+
+		reconciler := newTestReconciler(goalresolver, client)
+		result, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).To(BeNil())
+		Expect(result.RotationReason).To(Equal(goalresolvers.RotationReasonCertExpiring))
+		Expect(result.CACertificate).NotTo(BeNil())
+		Expect(result.CACertificate.Fingerprint).To(HaveLen(64))
+		Expect(result.ServerCertificate.NotAfter.Year()).To(Equal(time.Now().AddDate(2, 0, 0).Year()))
+		Expect(testutil.ToFloat64(metrics.CertificateRotationsMetric.WithLabelValues(goalresolvers.RotationReasonCertExpiring))).To(BeEquivalentTo(rotations + 1))
+		Expect(testutil.CollectAndCount(metrics.CertificateNotAfterMetric)).To(Equal(2))
+		Expect(testutil.CollectAndCount(metrics.ReconcileDurationMetric)).To(Equal(1))
+	})
+
+	It("rotate cert and create secret fail", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil).AnyTimes()
+		client.PrependReactor("create", "secrets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, nil, fmt.Errorf("error")
+		})
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("rotate cert and create webhook fail", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil).AnyTimes()
+		client.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, nil, fmt.Errorf("error")
+		})
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("don't rotate cert and shouldCreateOrUpdateWebhook failed", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     nil,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil).AnyTimes()
+		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), prepareCM(config.AppConfig.Namespace))
+		client.PrependReactor("get", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, nil, fmt.Errorf("error")
+		})
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).NotTo(BeNil())
+	})
+
+	It("reports unmanaged objects as skipped", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			SecretUnmanaged:              true,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		webhook := mutatingWebhookConfiguration(false)
+		webhook.Labels = nil
+		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), webhook, prepareCM(config.AppConfig.Namespace))
+
+		reconciler := newTestReconciler(goalresolver, client)
+		result, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).To(BeNil())
+		Expect(result.Rotated).To(BeFalse())
+		Expect(result.Changed()).To(BeFalse())
+		Expect(result.Actions).To(ConsistOf(
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionSkipped, Reason: "unmanaged"},
+			ObjectAction{Kind: webhookKind, Name: config.WebhookConfigName(), Action: ActionSkipped, Reason: "unmanaged"},
+		))
+		Expect(result.Warnings).To(HaveLen(2))
+		Expect(testutil.ToFloat64(metrics.RotateCertificateMetric)).To(BeEquivalentTo(0))
+	})
+
+	It("cancelled before reconcile", func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(cancelled)
+
+		Expect(cerr).NotTo(BeNil())
+		Expect(errors.Is(cerr, context.Canceled)).To(BeTrue())
+	})
+
+	It("cancelled while waiting to retry", func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		rerr := errors.New("resolve error")
+		goalresolver.EXPECT().Resolve(gomock.Any()).DoAndReturn(func(context.Context) (*goalresolvers.WebhookTlsManagerGoal, error) {
+			cancel()
+			return nil, rerr
+		})
+
+		start := time.Now()
+		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(cancelled)
+
+		Expect(cerr).NotTo(BeNil())
+		Expect(errors.Is(cerr, rerr)).To(BeTrue())
+		Expect(errors.Is(cerr, context.Canceled)).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically("<", retrypolicy.DefaultInitialInterval/2))
+	})
+
+	It("retries transient errors up to the max attempts", func() {
+		rerr := errors.New("connection refused")
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(nil, rerr).Times(3)
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).NotTo(BeNil())
+		Expect(cerr).To(Equal(rerr))
+	})
+
+	It("stops at the deadline", func() {
+		rerr := errors.New("connection refused")
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(nil, rerr).Times(1)
+
+		reconciler := newTestReconciler(goalresolver, client).(*webhookTlsManagerReconciler)
+		reconciler.retryPolicy.Deadline = time.Millisecond
+		_, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).NotTo(BeNil())
+		Expect(errors.Is(cerr, rerr)).To(BeTrue())
 	})
 
-	It("success", func() {
-		name := "webhook-tls-manager-webhook-config"
-		cerr := createMutatingWebhookConfig(ctx, fakeClientset, caCertPem, true)
-		Expect(cerr).To(BeNil())
-		webhook, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
-		Expect(err).To(BeNil())
-		Expect(webhook.Webhooks[0].Name).To(Equal("vpa.k8s.io"))
+	It("does not retry permanent errors", func() {
+		rerr := errdefs.NewAPIError("get", "secrets", config.SecretName(), k8serrors.NewForbidden(corev1.Resource("secrets"), config.SecretName(), errors.New("forbidden")))
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(nil, rerr).Times(1)
 
-		_, keyExist := webhook.ObjectMeta.Labels[consts.AdmissionEnforcerDisabledLabel]
-		Expect(keyExist).To(BeFalse())
-		val, keyExist := webhook.ObjectMeta.Labels[consts.ManagedLabelKey]
-		Expect(keyExist).To(BeTrue())
-		Expect(val).To(BeEquivalentTo(consts.ManagedLabelValue))
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(ctx)
+
+		Expect(cerr).NotTo(BeNil())
+		Expect(k8serrors.IsForbidden(cerr)).To(BeTrue())
+		Expect(errors.Is(cerr, errdefs.ErrPermission)).To(BeTrue())
+		Expect(errdefs.Reason(cerr)).To(Equal(errdefs.ReasonPermission))
 	})
 
-	It("mutatingWebhookConfig is empty", func() {
+	It("does not retry an invalid configmap", func() {
 		cm := prepareCM(config.AppConfig.Namespace)
 		cm.Data["mutatingWebhookConfig"] = ""
-		fakeClientset = fake.NewSimpleClientset(cm)
-		cerr := createMutatingWebhookConfig(ctx, fakeClientset, caCertPem, true)
+		client = fake.NewSimpleClientset(cm)
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil).Times(1)
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(ctx)
+
 		Expect(cerr).NotTo(BeNil())
+		Expect(retrypolicy.Classify(cerr).Class).To(Equal(retrypolicy.Permanent))
+		Expect(errors.Is(cerr, errdefs.ErrConfigMapInvalid)).To(BeTrue())
 	})
 
-	It("getMutatingWebhookConfigFromConfigmap error", func() {
-		fakeClientset = fake.NewSimpleClientset()
-		cerr := createMutatingWebhookConfig(ctx, fakeClientset, caCertPem, true)
-		Expect(cerr).NotTo(BeNil())
+	It("does not retry a missing configmap", func() {
+		client = fake.NewSimpleClientset()
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil).Times(1)
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(ctx)
+
+		Expect(errors.Is(cerr, errdefs.ErrConfigMapMissing)).To(BeTrue())
+		Expect(k8serrors.IsNotFound(cerr)).To(BeTrue())
+		var objectErr *errdefs.ObjectError
+		Expect(errors.As(cerr, &objectErr)).To(BeTrue())
+		Expect(objectErr.Name).To(Equal(config.WebhookConfigName()))
 	})
 
-	It("create error", func() {
-		fakeClientset.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
-			return true, nil, fmt.Errorf("create webhook error")
-		})
-		cerr := createMutatingWebhookConfig(ctx, fakeClientset, caCertPem, true)
+	It("retries crypto errors only if the toolkit marked them retriable", func() {
+		retriable := retrypolicy.NewCryptoError(retry.NewError(true, errors.New("entropy")))
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(nil, retriable).Times(3)
+		_, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
+		Expect(cerr).NotTo(BeNil())
+
+		notRetriable := retrypolicy.NewCryptoError(retry.NewError(false, errors.New("invalid csr")))
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(nil, notRetriable).Times(1)
+		_, cerr = newTestReconciler(goalresolver, client).Reconcile(ctx)
 		Expect(cerr).NotTo(BeNil())
-		webhook, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
-		Expect(err).NotTo(BeNil())
-		Expect(webhook).To(BeNil())
 	})
 
-	It("unblock kube-system namespace", func() {
-		cerr := createMutatingWebhookConfig(ctx, fakeClientset, caCertPem, false)
+	It("cancelled during rotation: secret write is followed by the webhook update", func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		client.PrependReactor("create", "secrets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			cancel()
+			return false, nil, nil
+		})
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(cancelled)
+
 		Expect(cerr).To(BeNil())
-		webhook, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		webhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
-
-		_, keyExist := webhook.ObjectMeta.Labels[consts.AdmissionEnforcerDisabledLabel]
-		Expect(keyExist).To(BeTrue())
+		Expect(webhook.Webhooks[0].ClientConfig.CABundle).To(BeEquivalentTo(certData.CaCertPem))
 	})
-})
 
-var _ = Describe("updateMutatingWebhookConfig test", func() {
-	var (
-		fakeClientset *fake.Clientset
-		ctx           = log.NewLogger(3).WithLogger(context.TODO())
-		webhook       *admissionregistration.MutatingWebhookConfiguration
-	)
+	It("cancelled during rotation: created secret is deleted when the webhook update fails", func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		client.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			cancel()
+			return true, nil, fmt.Errorf("error")
+		})
 
-	BeforeEach(func() {
-		config.NewConfig()
-		webhook = mutatingWebhookConfiguration(true)
-		fakeClientset = fake.NewSimpleClientset(webhook, prepareCM(config.AppConfig.Namespace))
-	})
+		reconciler := newTestReconciler(goalresolver, client)
+		result, cerr := reconciler.Reconcile(cancelled)
 
-	It("get webhook error", func() {
-		fakeClientset = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
-		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, false, []byte{})
 		Expect(cerr).NotTo(BeNil())
+		Expect(result.Rotated).To(BeFalse())
+		Expect(result.Actions).To(ContainElement(ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionDeleted, Reason: "rollback"}))
+		_, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
 	})
 
-	It("update webhook error", func() {
-		fakeClientset.PrependReactor("update", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-			return true, nil, fmt.Errorf("update webhook error")
+	It("cancelled during rotation: updated secret is restored when the webhook update fails", func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
+		client.PrependReactor("patch", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			cancel()
+			return true, nil, fmt.Errorf("error")
 		})
-		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, false, []byte{})
+
+		reconciler := newTestReconciler(goalresolver, client)
+		_, cerr := reconciler.Reconcile(cancelled)
+
 		Expect(cerr).NotTo(BeNil())
+		restored, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(restored.Data).To(Equal(secret(config.AppConfig.Namespace).Data))
 	})
 
-	It("update webhook when kube-system is blocked", func() {
-		webhook.Labels[consts.AdmissionEnforcerDisabledLabel] = "true"
-		fakeClientset = fake.NewSimpleClientset(webhook, prepareCM(config.AppConfig.Namespace))
-		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, true, []byte{})
+	It("rotation records its phase on the secret until complete", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			CertData:                     &certData,
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
+		var phases []string
+		client.PrependReactor("*", "secrets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			updated := &corev1.Secret{}
+			patch, ok := action.(k8stesting.PatchAction)
+			if !ok {
+				return false, nil, nil
+			}
+			Expect(json.Unmarshal(patch.GetPatch(), updated)).To(Succeed())
+			phases = append(phases, updated.Annotations[consts.RotationPhaseAnnotation])
+			return false, nil, nil
+		})
+
+		_, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
+
 		Expect(cerr).To(BeNil())
-		res, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(phases).To(Equal([]string{"pending", "secret-written", "bundle-injected", "complete"}))
+		expectNoUpdates(client)
+		rotated, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
-		_, keyExist := res.Labels[consts.AdmissionEnforcerDisabledLabel]
-		Expect(keyExist).To(BeFalse())
-		Expect(res.Webhooks[0].ClientConfig.CABundle).To(BeEmpty())
+		Expect(rotated.Annotations[consts.RotationCAFingerprintAnnotation]).To(Equal(pemFingerprint(certData.CaCertPem)))
+		Expect(rotated.Annotations[consts.RotationServerCertFingerprintAnnotation]).To(Equal(pemFingerprint(certData.ServerCertPem)))
 	})
 
-	It("update webhook when kube-system is unblocked", func() {
-		caCert := []byte("test")
-		cerr := updateMutatingWebhookConfig(ctx, fakeClientset, false, caCert)
+	It("resumes a rotation interrupted after the secret was written", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
+		}
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		written := secret(config.AppConfig.Namespace)
+		setRotationAnnotations(written, RotationPhaseSecretWritten, goalresolvers.CertificateData{
+			CaCertPem:     written.Data["caCert.pem"],
+			ServerCertPem: written.Data["serverCert.pem"],
+		})
+		client = fake.NewSimpleClientset(written, mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
+
+		result, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
+
 		Expect(cerr).To(BeNil())
-		res, err := fakeClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(result.Warnings).To(ContainElement(ContainSubstring("resumed an interrupted rotation")))
+		webhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
-		Expect(res.Labels[consts.AdmissionEnforcerDisabledLabel]).To(BeEquivalentTo("true"))
-		Expect(res.Webhooks[0].ClientConfig.CABundle).To(BeEquivalentTo(caCert))
+		Expect(webhook.Webhooks[0].ClientConfig.CABundle).To(BeEquivalentTo(written.Data["caCert.pem"]))
+		resumed, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(resumed.Annotations[consts.RotationPhaseAnnotation]).To(Equal(string(RotationPhaseComplete)))
 	})
-})
-
-var _ = Describe("webhook tls manager reconciler reconcile", func() {
-	var (
-		ctx          context.Context
-		client       *fake.Clientset
-		mockctl      *gomock.Controller
-		goalresolver *mock_goal_resolvers.MockWebhookTlsManagerGoalResolverInterface
-		certData     goalresolvers.CertificateData
-	)
 
-	BeforeEach(func() {
-		config.NewConfig()
-		ctx = log.NewLogger(3).WithLogger(context.TODO())
-		mockctl = gomock.NewController(GinkgoT())
-		client = fake.NewSimpleClientset(prepareCM(config.AppConfig.Namespace))
-		goalresolver = mock_goal_resolvers.NewMockWebhookTlsManagerGoalResolverInterface(mockctl)
-		certData = goalresolvers.CertificateData{
-			CaCertPem:     []byte("CaCertPem"),
-			CaKeyPem:      []byte("CaKeyPem"),
-			ServerCertPem: []byte("ServerCertPem"),
-			ServerKeyPem:  []byte("ServerKeyPem"),
+	It("abandons a rotation interrupted before the secret was written", func() {
+		goal := goalresolvers.WebhookTlsManagerGoal{
+			IsKubeSystemNamespaceBlocked: false,
+			IsWebhookTlsManagerEnabled:   true,
 		}
-	})
-
-	It("goalresolver resolve fail", func() {
-		rerr := errors.New("GenerateCertificates error")
-		goalresolver.EXPECT().Resolve(ctx).Return(nil, &rerr).AnyTimes()
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		pending := secret(config.AppConfig.Namespace)
+		setRotationAnnotations(pending, RotationPhasePending, certData)
+		client = fake.NewSimpleClientset(pending, mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
 
-		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
-		err := reconciler.Reconcile(ctx)
+		result, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
 
-		Expect(err).NotTo(BeNil())
+		Expect(cerr).To(BeNil())
+		Expect(result.Actions).To(ContainElement(ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionRolledBack, Reason: "rotation interrupted before the secret was written"}))
+		abandoned, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(abandoned.Data).To(Equal(pending.Data))
+		Expect(abandoned.Annotations[consts.RotationPhaseAnnotation]).To(Equal(string(RotationPhaseComplete)))
+		Expect(abandoned.Annotations[consts.RotationCAFingerprintAnnotation]).To(Equal(pemFingerprint(pending.Data["caCert.pem"])))
 	})
 
-	It("reconcile fail: WebhookTlsManager disabled and cleanup error", func() {
+	It("abandons a leaf rotation interrupted before the secret was written", func() {
 		goal := goalresolvers.WebhookTlsManagerGoal{
-			CertData:                     &certData,
 			IsKubeSystemNamespaceBlocked: false,
-			IsWebhookTlsManagerEnabled:   false,
+			IsWebhookTlsManagerEnabled:   true,
 		}
-		goalresolver.EXPECT().Resolve(ctx).Return(&goal, nil).AnyTimes()
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		pending := secret(config.AppConfig.Namespace)
+		// A leaf rotation keeps the CA, so only the server certificate tells the write did not land.
+		setRotationAnnotations(pending, RotationPhasePending, goalresolvers.CertificateData{
+			CaCertPem:     pending.Data["caCert.pem"],
+			ServerCertPem: certData.ServerCertPem,
+		})
+		pending.Annotations[consts.ForcedRotationScopeAnnotation] = string(goalresolvers.RotationScopeLeaf)
+		client = fake.NewSimpleClientset(pending, mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
 
-		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
-		cerr := reconciler.Reconcile(ctx)
+		result, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
 
-		Expect(cerr).Error()
+		Expect(cerr).To(BeNil())
+		Expect(result.Actions).To(ContainElement(ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionRolledBack, Reason: "rotation interrupted before the secret was written"}))
+		Expect(result.Warnings).To(ContainElement(ContainSubstring("must be run again")))
+		Expect(result.Warnings).NotTo(ContainElement(ContainSubstring("resumed an interrupted rotation")))
+		abandoned, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(abandoned.Data).To(Equal(pending.Data))
+		Expect(abandoned.Annotations[consts.RotationPhaseAnnotation]).To(Equal(string(RotationPhaseComplete)))
+		Expect(abandoned.Annotations[consts.RotationServerCertFingerprintAnnotation]).To(Equal(pemFingerprint(pending.Data["serverCert.pem"])))
 	})
 
-	It("reconcile succeed: WebhookTlsManager disabled and cleanup succeed", func() {
+	It("forced rotation records its scope and reason on the secret and in Events", func() {
 		goal := goalresolvers.WebhookTlsManagerGoal{
 			CertData:                     &certData,
+			RotationReason:               goalresolvers.RotationReasonForced,
+			ForcedRotation:               &goalresolvers.ForcedRotation{Scope: goalresolvers.RotationScopeCA, Reason: "INC-1"},
 			IsKubeSystemNamespaceBlocked: false,
-			IsWebhookTlsManagerEnabled:   false,
+			IsWebhookTlsManagerEnabled:   true,
 		}
-		goalresolver.EXPECT().Resolve(ctx).Return(&goal, nil).AnyTimes()
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
 
-		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(goal.IsKubeSystemNamespaceBlocked), prepareCM(config.AppConfig.Namespace))
-		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
-		cerr := reconciler.Reconcile(ctx)
+		_, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
 
 		Expect(cerr).To(BeNil())
-		Expect(testutil.ToFloat64(metrics.RotateCertificateMetric)).To(BeEquivalentTo(0))
+		rotated, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(rotated.Annotations[consts.ForcedRotationScopeAnnotation]).To(Equal("ca"))
+		Expect(rotated.Annotations[consts.ForcedRotationReasonAnnotation]).To(Equal("INC-1"))
+		Expect(rotated.Annotations[consts.ForcedRotationTimeAnnotation]).NotTo(BeEmpty())
+		Expect(rotated.Data["previous-caCert.pem"]).To(BeEquivalentTo("testCaCert"))
+		events, err := client.CoreV1().Events(config.AppConfig.Namespace).List(ctx, metav1.ListOptions{})
+		Expect(err).To(BeNil())
+		var reasons []string
+		for _, event := range events.Items {
+			Expect(event.InvolvedObject.Name).To(Equal(config.SecretName()))
+			Expect(event.Message).To(ContainSubstring("INC-1"))
+			reasons = append(reasons, event.Reason)
+		}
+		Expect(reasons).To(ConsistOf("ForcedRotationStarted", "ForcedRotationCompleted"))
 	})
 
-	It("reconcile succeed: update webhook", func() {
+	It("forced rotation revoking the previous certificates removes the replaced CA from the caBundle", func() {
+		certData.RevokePrevious = true
 		goal := goalresolvers.WebhookTlsManagerGoal{
 			CertData:                     &certData,
+			RotationReason:               goalresolvers.RotationReasonForced,
+			ForcedRotation:               &goalresolvers.ForcedRotation{Scope: goalresolvers.RotationScopeCARevoke, Reason: "INC-1"},
 			IsKubeSystemNamespaceBlocked: false,
 			IsWebhookTlsManagerEnabled:   true,
 		}
-		goalresolver.EXPECT().Resolve(ctx).Return(&goal, nil)
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		compromised := secret(config.AppConfig.Namespace)
+		compromised.Data["previous-caCert.pem"] = []byte("olderCaCert")
+		client = fake.NewSimpleClientset(compromised, mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace))
 
-		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), mutatingWebhookConfiguration(goal.IsKubeSystemNamespaceBlocked), prepareCM(config.AppConfig.Namespace))
-		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
-		cerr := reconciler.Reconcile(ctx)
+		_, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
 
 		Expect(cerr).To(BeNil())
-		Expect(testutil.ToFloat64(metrics.RotateCertificateMetric)).To(BeEquivalentTo(1))
-
-		webhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
-		Expect(webhook).NotTo(BeNil())
-		Expect(webhook.Webhooks[0].ClientConfig.CABundle).To(BeEquivalentTo(goal.CertData.CaCertPem))
+		rotated, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
-		secret, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
-		Expect(secret).NotTo(BeNil())
+		Expect(rotated.Data).NotTo(HaveKey("previous-caCert.pem"))
+		webhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
+		Expect(webhook.Webhooks[0].ClientConfig.CABundle).To(BeEquivalentTo(certData.CaCertPem))
 	})
 
-	It("reconcile succeed", func() {
+	It("rotation stays secret-written until the webhook contains the new CA", func() {
 		goal := goalresolvers.WebhookTlsManagerGoal{
 			CertData:                     &certData,
 			IsKubeSystemNamespaceBlocked: false,
 			IsWebhookTlsManagerEnabled:   true,
 		}
-		goalresolver.EXPECT().Resolve(ctx).Return(&goal, nil)
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		unmanaged := mutatingWebhookConfiguration(false)
+		unmanaged.Labels = nil
+		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), unmanaged, prepareCM(config.AppConfig.Namespace))
 
-		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
-		cerr := reconciler.Reconcile(ctx)
+		result, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
 
 		Expect(cerr).To(BeNil())
-
-		webhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
-		Expect(webhook).NotTo(BeNil())
+		Expect(result.Warnings).To(ContainElement(ContainSubstring("does not contain the rotated CA")))
+		rotated, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
-		secret, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
-		Expect(secret).NotTo(BeNil())
+		Expect(rotated.Annotations[consts.RotationPhaseAnnotation]).To(Equal(string(RotationPhaseSecretWritten)))
+
+		// Once the webhook is managed, the next run resumes the rotation from the webhook step.
+		managed := mutatingWebhookConfiguration(false)
+		managed.ResourceVersion = ""
+		Expect(client.Tracker().Update(admissionregistration.SchemeGroupVersion.WithResource("mutatingwebhookconfigurations"), managed, "")).To(Succeed())
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goalresolvers.WebhookTlsManagerGoal{IsWebhookTlsManagerEnabled: true}, nil)
+
+		result, cerr = newTestReconciler(goalresolver, client).Reconcile(ctx)
+
+		Expect(cerr).To(BeNil())
+		Expect(result.Warnings).To(ContainElement(ContainSubstring("resumed an interrupted rotation")))
+		rotated, err = client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
 		Expect(err).To(BeNil())
+		Expect(rotated.Annotations[consts.RotationPhaseAnnotation]).To(Equal(string(RotationPhaseComplete)))
 	})
 
-	It("rotate cert and create secret fail", func() {
+	It("adopts the unmanaged secret and webhook", func() {
+		config.UpdateAdoptConfig(true)
 		goal := goalresolvers.WebhookTlsManagerGoal{
-			CertData:                     &certData,
+			AdoptSecret:                  true,
 			IsKubeSystemNamespaceBlocked: false,
 			IsWebhookTlsManagerEnabled:   true,
 		}
-		goalresolver.EXPECT().Resolve(ctx).Return(&goal, nil).AnyTimes()
-		client.PrependReactor("create", "secrets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-			return true, nil, fmt.Errorf("error")
-		})
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		unmanagedSecret := secret(config.AppConfig.Namespace)
+		unmanagedSecret.Labels = map[string]string{"app.kubernetes.io/managed-by": "helm"}
+		webhook := mutatingWebhookConfiguration(false)
+		webhook.Labels = nil
+		client = fake.NewSimpleClientset(unmanagedSecret, webhook, prepareCM(config.AppConfig.Namespace))
 
-		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
-		cerr := reconciler.Reconcile(ctx)
+		result, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
 
-		Expect(cerr).NotTo(BeNil())
+		Expect(cerr).To(BeNil())
+		Expect(result.Actions).To(ContainElements(
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Action: ActionUpdated, Reason: "adopted"},
+			ObjectAction{Kind: webhookKind, Name: config.WebhookConfigName(), Action: ActionUpdated, Reason: "adopted"},
+		))
+		adopted, err := client.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(adopted.Labels).To(HaveKeyWithValue(consts.ManagedLabelKey, consts.ManagedLabelValue))
+		Expect(adopted.Annotations).To(HaveKey(consts.AdoptedAtAnnotation))
+		Expect(adopted.Annotations[consts.AdoptedFromLabelsAnnotation]).To(Equal(`{"app.kubernetes.io/managed-by":"helm"}`))
+		adoptedWebhook, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(adoptedWebhook.Labels).To(HaveKeyWithValue(consts.ManagedLabelKey, consts.ManagedLabelValue))
+		Expect(adoptedWebhook.Annotations[consts.AdoptedFromLabelsAnnotation]).To(Equal(`{}`))
+		Expect(adoptedWebhook.Webhooks[0].ClientConfig.CABundle).To(Equal([]byte("testCaCert")))
+		expectNoUpdates(client)
 	})
 
-	It("rotate cert and create webhook fail", func() {
+	It("sweeps orphans after reconciling", func() {
+		config.UpdateOrphanConfig(config.OrphanPolicyDelete)
 		goal := goalresolvers.WebhookTlsManagerGoal{
-			CertData:                     &certData,
 			IsKubeSystemNamespaceBlocked: false,
 			IsWebhookTlsManagerEnabled:   true,
 		}
-		goalresolver.EXPECT().Resolve(ctx).Return(&goal, nil).AnyTimes()
-		client.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-			return true, nil, fmt.Errorf("error")
-		})
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		orphan := secret(config.AppConfig.Namespace)
+		orphan.Name = "old-tls-certs"
+		orphan.Labels = map[string]string{
+			consts.ManagedLabelKey:        consts.ManagedLabelValue,
+			consts.InstanceLabelKey:       "old",
+			consts.OwnerNamespaceLabelKey: config.AppConfig.Namespace,
+		}
+		client = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), mutatingWebhookConfiguration(false), prepareCM(config.AppConfig.Namespace), orphan)
 
-		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
-		cerr := reconciler.Reconcile(ctx)
+		result, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
 
-		Expect(cerr).NotTo(BeNil())
+		Expect(cerr).To(BeNil())
+		Expect(result.Actions).To(ContainElement(
+			ObjectAction{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: "old-tls-certs", Action: ActionDeleted, Reason: "orphaned"},
+		))
 	})
 
-	It("don't rotate cert and shouldCreateOrUpdateWebhook failed", func() {
+	It("refuses to adopt a webhook registering other webhooks", func() {
+		config.UpdateAdoptConfig(true)
 		goal := goalresolvers.WebhookTlsManagerGoal{
-			CertData:                     nil,
 			IsKubeSystemNamespaceBlocked: false,
 			IsWebhookTlsManagerEnabled:   true,
 		}
-		goalresolver.EXPECT().Resolve(ctx).Return(&goal, nil).AnyTimes()
-		client = fake.NewSimpleClientset(secret(config.AppConfig.Namespace), prepareCM(config.AppConfig.Namespace))
-		client.PrependReactor("get", "mutatingwebhookconfigurations", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-			return true, nil, fmt.Errorf("error")
-		})
+		goalresolver.EXPECT().Resolve(gomock.Any()).Return(&goal, nil)
+		webhook := mutatingWebhookConfiguration(false)
+		webhook.Labels = nil
+		webhook.Webhooks[0].Name = "other.example.com"
+		client = fake.NewSimpleClientset(managedSecret(config.AppConfig.Namespace), webhook, prepareCM(config.AppConfig.Namespace))
 
-		reconciler := NewWebhookTlsManagerReconciler(goalresolver, client)
-		cerr := reconciler.Reconcile(ctx)
+		_, cerr := newTestReconciler(goalresolver, client).Reconcile(ctx)
 
-		Expect(cerr).NotTo(BeNil())
+		Expect(errors.Is(cerr, errdefs.ErrUnmanagedObject)).To(BeTrue())
+		unchanged, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(unchanged.Labels).NotTo(HaveKey(consts.ManagedLabelKey))
 	})
 
 })
 
+// newTestReconciler returns a reconciler that retries quickly, so failing cases do not wait
+// for the default backoff.
+func newTestReconciler(goalResolver goalresolvers.WebhookTlsManagerGoalResolverInterface, client *fake.Clientset) Reconciler {
+	reconciler := NewWebhookTlsManagerReconciler(goalResolver, client).(*webhookTlsManagerReconciler)
+	reconciler.retryPolicy = retrypolicy.Policy{
+		MaxAttempts:     3,
+		Deadline:        5 * time.Second,
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     50 * time.Millisecond,
+		Multiplier:      2,
+	}
+	return reconciler
+}
+
 func mutatingWebhookConfiguration(systemNamespaceBlocked bool) *admissionregistration.MutatingWebhookConfiguration {
 	var label map[string]string
 	if systemNamespaceBlocked {
@@ -755,7 +2921,7 @@ func mutatingWebhookConfiguration(systemNamespaceBlocked bool) *admissionregistr
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   config.WebhookConfigName(),
-			Labels: label,
+			Labels: withInstanceLabels(label),
 		},
 		Webhooks: []admissionregistration.MutatingWebhook{
 			{
@@ -818,6 +2984,12 @@ func secret(namespace string) *corev1.Secret {
 	}
 }
 
+func managedSecret(namespace string) *corev1.Secret {
+	s := secret(namespace)
+	s.Labels = withInstanceLabels(map[string]string{consts.ManagedLabelKey: consts.ManagedLabelValue})
+	return s
+}
+
 func prepareCM(namespace string) *corev1.ConfigMap {
 	cmData := `
 apiVersion: admissionregistration.k8s.io/v1
@@ -878,3 +3050,93 @@ webhooks:
 	}
 	return cm
 }
+
+// mergeSecretData returns a copy of current with the entries of desired added.
+func mergeSecretData(current, desired map[string][]byte) map[string][]byte {
+	merged := make(map[string][]byte, len(current)+len(desired))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range desired {
+		merged[k] = v
+	}
+	return merged
+}
+
+// expectNoUpdates expects that no object was written with a whole-object update, which would
+// overwrite the fields of other actors.
+func expectNoUpdates(client *fake.Clientset) {
+	for _, action := range client.Actions() {
+		Expect(action.GetVerb()).NotTo(Equal("update"), "%s of %s", action.GetVerb(), action.GetResource().Resource)
+	}
+}
+
+// webhookService returns the service the webhook of mutatingWebhookConfiguration calls.
+func webhookService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook-tls-manager-webhook-config", Namespace: "kube-system"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "https", Port: 443}}},
+	}
+}
+
+// startTLSServer serves handler over TLS with cert on a local port.
+func startTLSServer(handler http.Handler, cert *x509.Certificate, key *rsa.PrivateKey) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}}
+	server.StartTLS()
+	return server
+}
+
+// serverEndpointSlice returns an EndpointSlice of service with server as its ready endpoint for
+// the port named https.
+func serverEndpointSlice(service *corev1.Service, server *httptest.Server, index int) *discoveryv1.EndpointSlice {
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	Expect(err).To(BeNil())
+	targetPort, err := strconv.Atoi(port)
+	Expect(err).To(BeNil())
+	portName, slicePort, ready := "https", int32(targetPort), true
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", service.Name, index),
+			Namespace: service.Namespace,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service.Name},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"127.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}},
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &slicePort}},
+	}
+}
+
+// testCertificate returns a certificate for dnsName signed by parent, or a self-signed CA if
+// parent is nil.
+func testCertificate(parent *x509.Certificate, parentKey *rsa.PrivateKey, dnsName string) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).To(BeNil())
+	serialNumber, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	Expect(err).To(BeNil())
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		template.Subject.CommonName = "webhook-tls-manager-test-ca"
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.DNSNames = []string{dnsName}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	Expect(err).To(BeNil())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).To(BeNil())
+	return cert, key
+}
+
+func pemCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
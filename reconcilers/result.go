@@ -0,0 +1,84 @@
+package reconcilers
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
+)
+
+// Action is what a reconcile did to an object.
+type Action string
+
+const (
+	ActionCreated    Action = "created"
+	ActionUpdated    Action = "updated"
+	ActionDeleted    Action = "deleted"
+	ActionUnchanged  Action = "unchanged"
+	ActionSkipped    Action = "skipped"
+	ActionRolledBack Action = "rolled_back"
+)
+
+// ObjectAction is an action taken on one object.
+type ObjectAction struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Action    Action `json:"action"`
+	// Reason explains skipped and rolled back objects.
+	Reason string `json:"reason,omitempty"`
+}
+
+// CertificateInfo identifies a certificate stored in the secret.
+type CertificateInfo struct {
+	// Fingerprint is the hex SHA-256 of the DER certificate, as in the certificate metrics.
+	Fingerprint  string    `json:"fingerprint"`
+	SerialNumber string    `json:"serialNumber"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+// Result describes what Reconcile did. It is returned also when Reconcile fails, listing the
+// actions of every attempt up to the failure.
+type Result struct {
+	Actions []ObjectAction `json:"actions"`
+	// Rotated is true if new certificates were written to the secret.
+	Rotated        bool   `json:"rotated"`
+	RotationReason string `json:"rotationReason,omitempty"`
+	// CACertificate and ServerCertificate are the certificates in the secret after a successful
+	// reconcile, whether they were rotated or not.
+	CACertificate     *CertificateInfo `json:"caCertificate,omitempty"`
+	ServerCertificate *CertificateInfo `json:"serverCertificate,omitempty"`
+	Warnings          []string         `json:"warnings,omitempty"`
+	// Endpoints are the endpoints of the webhooks verified by Verify or with --verify-endpoints.
+	Endpoints []EndpointVerification `json:"endpoints,omitempty"`
+	// Probes are the AdmissionReview probes sent by Probe.
+	Probes   []WebhookProbe `json:"probes,omitempty"`
+	Attempts int            `json:"attempts"`
+}
+
+// Changed reports whether any object was created, updated, deleted or rolled back.
+func (r *Result) Changed() bool {
+	for _, action := range r.Actions {
+		if action.Action != ActionUnchanged && action.Action != ActionSkipped {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Result) record(kind, namespace, name string, action Action, reason string) {
+	r.Actions = append(r.Actions, ObjectAction{Kind: kind, Namespace: namespace, Name: name, Action: action, Reason: reason})
+}
+
+func (r *Result) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+func newCertificateInfo(cert *x509.Certificate) *CertificateInfo {
+	return &CertificateInfo{
+		Fingerprint:  certificates.Fingerprint(cert),
+		SerialNumber: cert.SerialNumber.String(),
+		NotAfter:     cert.NotAfter,
+	}
+}
@@ -0,0 +1,130 @@
+package reconcilers
+
+import (
+	"bytes"
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/goalresolvers"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// previousKeyPrefix prefixes the secret keys holding the certificates replaced by the last rotation.
+const previousKeyPrefix = "previous-"
+
+var certificateKeys = []string{"caCert.pem", "caKey.pem", "serverCert.pem", "serverKey.pem"}
+
+// keepPreviousCertificates copies the certificates in secret to the previous-* keys before
+// they are replaced by data, or drops the previous-* keys if data revokes them. Writing the
+// same certificates again, e.g. on a retry, keeps the previous-* keys as they are.
+func keepPreviousCertificates(secret *corev1.Secret, data goalresolvers.CertificateData) {
+	if data.RevokePrevious {
+		for _, key := range certificateKeys {
+			delete(secret.Data, previousKeyPrefix+key)
+		}
+		return
+	}
+	if bytes.Equal(secret.Data["caCert.pem"], data.CaCertPem) && bytes.Equal(secret.Data["serverCert.pem"], data.ServerCertPem) {
+		return
+	}
+	for _, key := range certificateKeys {
+		if value, ok := secret.Data[key]; ok {
+			secret.Data[previousKeyPrefix+key] = value
+		}
+	}
+}
+
+// caBundle returns the CA of secret followed by its previous CA, if that differs, so the
+// webhook backend can still serve a certificate of the previous CA until it reloads the secret.
+func caBundle(secret *corev1.Secret) []byte {
+	bundle := append([]byte{}, secret.Data["caCert.pem"]...)
+	previous := secret.Data[previousKeyPrefix+"caCert.pem"]
+	if len(previous) == 0 || bytes.Equal(previous, bundle) {
+		return bundle
+	}
+	if len(bundle) > 0 && bundle[len(bundle)-1] != '\n' {
+		bundle = append(bundle, '\n')
+	}
+	return append(bundle, previous...)
+}
+
+// Rollback restores the certificates replaced by the last rotation and injects the restored CA
+// into the webhook. The replaced certificates become the previous ones, so a rollback can be
+// undone by rolling back again. Like a rotation, it is recorded in the rotation annotations, and
+// the next reconcile finishes it if the webhook update fails.
+func Rollback(ctx context.Context, clientset kubernetes.Interface, isKubeSystemNamespaceBlocked bool) (*Result, error) {
+	ctx, span := log.StartSpan(ctx, "Rollback", nil)
+	defer span.End()
+	ctx = log.WithFields(ctx, "component", "reconciler", "phase", "rollback")
+	logger := log.MustGetLogger(ctx)
+	result := &Result{Attempts: 1}
+
+	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if getErr != nil {
+		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
+		metrics.RecordAPIError("get", "secrets", getErr)
+		span.SetStatus(getErr)
+		return result, errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	if !isManaged(secret.Labels) {
+		err := &errdefs.ObjectError{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Reason: errdefs.ErrUnmanagedObject}
+		logger.Errorf(ctx, "secret %s is not managed. error: %s", config.SecretName(), err)
+		span.SetStatus(err)
+		return result, err
+	}
+	for _, key := range certificateKeys {
+		if len(secret.Data[previousKeyPrefix+key]) == 0 {
+			err := &errdefs.ObjectError{Kind: secretKind, Namespace: config.AppConfig.Namespace, Name: config.SecretName(), Reason: errdefs.ErrNoPreviousCertificates}
+			logger.Errorf(ctx, "secret %s has no %s%s. error: %s", config.SecretName(), previousKeyPrefix, key, err)
+			span.SetStatus(err)
+			return result, err
+		}
+	}
+
+	data := map[string][]byte{}
+	for _, key := range certificateKeys {
+		data[key], data[previousKeyPrefix+key] = secret.Data[previousKeyPrefix+key], secret.Data[key]
+	}
+	annotations := rotationAnnotations(RotationPhaseSecretWritten, goalresolvers.CertificateData{
+		CaCertPem:     data["caCert.pem"],
+		ServerCertPem: data["serverCert.pem"],
+	})
+
+	if err := waitForUnregisteredBackends(ctx, clientset, isKubeSystemNamespaceBlocked); err != nil {
+		span.SetStatus(err)
+		return result, err
+	}
+	// As in a rotation, the webhook is updated even if ctx is cancelled once the secret is written.
+	criticalCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownGracePeriod)
+	defer cancel()
+
+	fields := metadataFields(nil, annotations)
+	fields["data"] = data
+	if _, err := patchSecret(criticalCtx, clientset, fields); err != nil {
+		span.SetStatus(err)
+		return result, err
+	}
+	logger.Infof(ctx, "secret %s rolled back to the previous certificates.", config.SecretName())
+	result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionRolledBack, "rollback")
+	result.Rotated = true
+	result.RotationReason = "rollback"
+
+	if err := createOrUpdateWebhook(criticalCtx, clientset, result, isKubeSystemNamespaceBlocked); err != nil {
+		logger.Errorf(ctx, "createOrUpdateWebhook failed. error: %s", err)
+		span.SetStatus(err)
+		return result, err
+	}
+	if err := completeRotation(criticalCtx, clientset, result); err != nil {
+		span.SetStatus(err)
+		return result, err
+	}
+	recordCertificateInventory(ctx, clientset, result)
+	span.SetStatus(nil)
+	return result, nil
+}
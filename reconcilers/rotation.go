@@ -0,0 +1,209 @@
+package reconcilers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/goalresolvers"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// RotationPhase is the progress of a certificate rotation, recorded on the secret in the
+// consts.RotationPhaseAnnotation annotation together with the fingerprints of the certificates
+// the rotation writes. A rotation moves through the phases in order:
+//
+//   - pending: the new certificates are generated, the secret still holds the old ones.
+//     A new secret skips this phase, since there is nothing to record it on.
+//   - secret-written: the secret holds the new certificates, the webhook the old caBundle.
+//   - bundle-injected: the webhook caBundle was read back and contains the new CA.
+//   - complete: the rotation is finished.
+type RotationPhase string
+
+const (
+	RotationPhasePending        RotationPhase = "pending"
+	RotationPhaseSecretWritten  RotationPhase = "secret-written"
+	RotationPhaseBundleInjected RotationPhase = "bundle-injected"
+	RotationPhaseComplete       RotationPhase = "complete"
+)
+
+// rotationAnnotationKeys are the annotations a rotation writes on the secret.
+var rotationAnnotationKeys = []string{
+	consts.RotationPhaseAnnotation,
+	consts.RotationCAFingerprintAnnotation,
+	consts.RotationServerCertFingerprintAnnotation,
+	consts.ForcedRotationScopeAnnotation,
+	consts.ForcedRotationReasonAnnotation,
+	consts.ForcedRotationTimeAnnotation,
+}
+
+// pemFingerprint returns the fingerprint of the certificate in pemBytes, as in the certificate
+// metrics, or the SHA-256 of pemBytes if they do not hold a certificate.
+func pemFingerprint(pemBytes []byte) string {
+	if cert, err := certificates.ParsePEMCertificate(pemBytes); err == nil {
+		return certificates.Fingerprint(cert)
+	}
+	sum := sha256.Sum256(pemBytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// rotationAnnotations returns the annotations recording phase and the fingerprints of the
+// certificates in data.
+func rotationAnnotations(phase RotationPhase, data goalresolvers.CertificateData) map[string]string {
+	return map[string]string{
+		consts.RotationPhaseAnnotation:                 string(phase),
+		consts.RotationCAFingerprintAnnotation:         pemFingerprint(data.CaCertPem),
+		consts.RotationServerCertFingerprintAnnotation: pemFingerprint(data.ServerCertPem),
+	}
+}
+
+// setRotationAnnotations records phase and the fingerprints of the certificates in data.
+func setRotationAnnotations(secret *corev1.Secret, phase RotationPhase, data goalresolvers.CertificateData) {
+	secret.Annotations = mergeMetadata(secret.Annotations, rotationAnnotations(phase, data))
+}
+
+// markRotationPending records on the existing secret that the rotation of goal is about to
+// write it. A forced rotation also records its scope, reason and time, and an Event.
+func markRotationPending(ctx context.Context, clientset kubernetes.Interface, goal *goalresolvers.WebhookTlsManagerGoal) error {
+	annotations := rotationAnnotations(RotationPhasePending, *goal.CertData)
+	if forced := goal.ForcedRotation; forced != nil {
+		annotations[consts.ForcedRotationScopeAnnotation] = string(forced.Scope)
+		annotations[consts.ForcedRotationReasonAnnotation] = forced.Reason
+		annotations[consts.ForcedRotationTimeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	}
+	updated, err := patchSecret(ctx, clientset, metadataFields(nil, annotations))
+	if err != nil {
+		return err
+	}
+	if forced := goal.ForcedRotation; forced != nil {
+		recordEvent(ctx, clientset, secretReference(updated), corev1.EventTypeWarning, "ForcedRotationStarted", "forced rotation of scope %s started. reason: %s", forced.Scope, forced.Reason)
+	}
+	return nil
+}
+
+// setRotationPhase moves the rotation recorded on the secret to phase, keeping its fingerprints.
+func setRotationPhase(ctx context.Context, clientset kubernetes.Interface, phase RotationPhase) (*corev1.Secret, error) {
+	updated, err := patchSecret(ctx, clientset, metadataFields(nil, map[string]string{consts.RotationPhaseAnnotation: string(phase)}))
+	if err != nil {
+		return nil, err
+	}
+	log.MustGetLogger(ctx).Infof(ctx, "rotation phase of secret %s is %s.", config.SecretName(), phase)
+	return updated, nil
+}
+
+// completeRotation reads the webhook back and, if the caBundle of every webhook contains the CA
+// of the secret, records the rotation bundle-injected, then complete. A webhook that does not,
+// e.g. because it is not managed, contested or disabled, leaves the phase as it is with a
+// warning, so the next run updates the webhook again.
+func completeRotation(ctx context.Context, clientset kubernetes.Interface, result *Result) error {
+	logger := log.MustGetLogger(ctx)
+	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if getErr != nil {
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	webhook, getErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+	if getErr != nil {
+		metrics.RecordAPIError("get", "mutatingwebhookconfigurations", getErr)
+		return errdefs.NewAPIError("get", "mutatingwebhookconfigurations", config.WebhookConfigName(), getErr)
+	}
+	phase := RotationPhase(secret.Annotations[consts.RotationPhaseAnnotation])
+	for _, w := range webhook.Webhooks {
+		if !bundleContainsCA(w.ClientConfig.CABundle, secret.Data["caCert.pem"]) {
+			logger.Warningf(ctx, "caBundle of webhook %s does not contain the CA of secret %s. rotation stays %s.", w.Name, config.SecretName(), phase)
+			result.warn("caBundle of webhook %s does not contain the rotated CA", w.Name)
+			return nil
+		}
+	}
+	if phase != RotationPhaseBundleInjected {
+		if _, err := setRotationPhase(ctx, clientset, RotationPhaseBundleInjected); err != nil {
+			return err
+		}
+	}
+	_, err := setRotationPhase(ctx, clientset, RotationPhaseComplete)
+	return err
+}
+
+// bundleContainsCA reports whether bundle holds the certificate in caCert. Certificates are
+// compared by fingerprint, so a bundle re-encoded by another tool, e.g. with other line endings,
+// still matches. A caCert that is not a PEM certificate is looked up verbatim.
+func bundleContainsCA(bundle, caCert []byte) bool {
+	ca, err := certificates.ParsePEMCertificate(caCert)
+	if err != nil {
+		return bytes.Contains(bundle, caCert)
+	}
+	fingerprint := certificates.Fingerprint(ca)
+	for rest := bundle; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return false
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil && certificates.Fingerprint(cert) == fingerprint {
+			return true
+		}
+	}
+}
+
+// secretWritten reports whether secret holds both certificates recorded by its rotation. Both are
+// compared, as a leaf rotation keeps the CA.
+func secretWritten(secret *corev1.Secret) bool {
+	return pemFingerprint(secret.Data["caCert.pem"]) == secret.Annotations[consts.RotationCAFingerprintAnnotation] &&
+		pemFingerprint(secret.Data["serverCert.pem"]) == secret.Annotations[consts.RotationServerCertFingerprintAnnotation]
+}
+
+// resumeRotation finishes a rotation that a previous run left unfinished. A pending rotation
+// whose certificates never reached the secret is abandoned, since its keys are lost. Any later
+// phase means the secret holds the new certificates, so the webhook is brought in line.
+func resumeRotation(ctx context.Context, clientset kubernetes.Interface, result *Result, goal *goalresolvers.WebhookTlsManagerGoal) error {
+	logger := log.MustGetLogger(ctx)
+	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if getErr != nil {
+		// Missing secrets are handled by the goal resolver.
+		return nil
+	}
+	phase := RotationPhase(secret.Annotations[consts.RotationPhaseAnnotation])
+	switch phase {
+	case "", RotationPhaseComplete:
+		return nil
+	case RotationPhasePending:
+		if !secretWritten(secret) {
+			logger.Warningf(ctx, "rotation of secret %s was interrupted before the secret was written. abandoning it.", config.SecretName())
+			abandoned := rotationAnnotations(RotationPhaseComplete, goalresolvers.CertificateData{
+				CaCertPem:     secret.Data["caCert.pem"],
+				ServerCertPem: secret.Data["serverCert.pem"],
+			})
+			if _, err := patchSecret(ctx, clientset, metadataFields(nil, abandoned)); err != nil {
+				return err
+			}
+			result.record(secretKind, config.AppConfig.Namespace, config.SecretName(), ActionRolledBack, "rotation interrupted before the secret was written")
+			result.warn("rotation of secret %s was interrupted before the secret was written and was abandoned. a forced rotation must be run again", config.SecretName())
+			return nil
+		}
+		// The write landed, but the process stopped before recording it.
+		if _, err := setRotationPhase(ctx, clientset, RotationPhaseSecretWritten); err != nil {
+			return err
+		}
+	}
+
+	logger.Infof(ctx, "resuming rotation of secret %s from phase %s.", config.SecretName(), phase)
+	result.warn("resumed an interrupted rotation of secret %s from phase %s", config.SecretName(), phase)
+	if phase != RotationPhaseBundleInjected {
+		if err := createOrUpdateWebhook(log.WithFields(ctx, "phase", "webhook"), clientset, result, goal.IsKubeSystemNamespaceBlocked); err != nil {
+			return err
+		}
+	}
+	return completeRotation(ctx, clientset, result)
+}
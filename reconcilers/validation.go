@@ -0,0 +1,282 @@
+package reconcilers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	admissionregistrationv1apply "k8s.io/client-go/applyconfigurations/admissionregistration/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/consts"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+var (
+	supportedAdmissionReviewVersions = []string{"v1", "v1beta1"}
+	supportedOperations              = []admissionregistration.OperationType{
+		admissionregistration.OperationAll, admissionregistration.Create, admissionregistration.Update,
+		admissionregistration.Delete, admissionregistration.Connect,
+	}
+)
+
+// dryRunWebhookFunc sends the webhook to the API server as a server-side dry-run. It is a
+// variable because the fake clientset ignores the dry-run option and would store the object.
+var dryRunWebhookFunc = dryRunWebhook
+
+// checkWebhookConfig validates the webhook configuration declared in the ConfigMap, then
+// dry-runs its create, or its apply if exists is set. All problems are reported together in an
+// ObjectError on the ConfigMap with the reason ErrConfigMapInvalid. A Service that cannot be
+// found is only a warning, as the webhook configuration is usually applied before its backend is
+// deployed.
+func checkWebhookConfig(ctx context.Context, clientset kubernetes.Interface, result *Result, declared *admissionregistration.MutatingWebhookConfiguration, exists bool) error {
+	logger := log.MustGetLogger(ctx)
+	problems := validateWebhookConfig(declared)
+	servicePorts, err := checkServices(ctx, clientset, result, declared)
+	if err != nil {
+		return err
+	}
+	problems = append(problems, servicePorts...)
+	if len(problems) == 0 {
+		dryRunErr := dryRunWebhookFunc(ctx, clientset, declared, exists)
+		if k8serrors.IsInvalid(dryRunErr) {
+			problems = append(problems, fmt.Sprintf("rejected by the API server: %s", dryRunErr))
+		} else if dryRunErr != nil {
+			return dryRunErr
+		}
+	}
+	if len(problems) == 0 {
+		logger.Infof(ctx, "mutating webhook configuration %s is valid.", declared.Name)
+		return nil
+	}
+	errs := make([]error, 0, len(problems))
+	for _, problem := range problems {
+		logger.Errorf(ctx, "mutating webhook configuration %s is invalid: %s", declared.Name, problem)
+		errs = append(errs, errors.New(problem))
+	}
+	return &errdefs.ObjectError{Kind: "ConfigMap", Namespace: config.AppConfig.Namespace, Name: config.ConfigMapName(), Reason: errdefs.ErrConfigMapInvalid, Err: errors.Join(errs...)}
+}
+
+// validateWebhookConfig returns the problems of webhookConfig that can be found without the API
+// server, each naming the field it concerns.
+func validateWebhookConfig(webhookConfig *admissionregistration.MutatingWebhookConfiguration) []string {
+	var problems []string
+	if webhookConfig.Name != config.WebhookConfigName() {
+		problems = append(problems, fmt.Sprintf("metadata.name: %q differs from the managed name %q", webhookConfig.Name, config.WebhookConfigName()))
+	}
+	if len(webhookConfig.Webhooks) == 0 {
+		problems = append(problems, "webhooks: at least one webhook is required")
+	}
+	names := map[string]bool{}
+	for i, webhook := range webhookConfig.Webhooks {
+		path := fmt.Sprintf("webhooks[%d]", i)
+		if webhook.Name == "" {
+			problems = append(problems, path+".name: required")
+		} else if errs := validation.IsDNS1123Subdomain(webhook.Name); len(errs) > 0 {
+			problems = append(problems, fmt.Sprintf("%s.name: %q is invalid: %s", path, webhook.Name, strings.Join(errs, "; ")))
+		} else if strings.Count(webhook.Name, ".") < 2 {
+			problems = append(problems, fmt.Sprintf("%s.name: %q must be fully qualified, e.g. vpa.k8s.io", path, webhook.Name))
+		} else if names[webhook.Name] {
+			problems = append(problems, fmt.Sprintf("%s.name: %q is not unique", path, webhook.Name))
+		}
+		names[webhook.Name] = true
+		problems = append(problems, validateClientConfig(path+".clientConfig", webhook.ClientConfig)...)
+		problems = append(problems, validateWebhookSettings(path, webhook)...)
+		for j, rule := range webhook.Rules {
+			problems = append(problems, validateRule(fmt.Sprintf("%s.rules[%d]", path, j), rule)...)
+		}
+	}
+	return problems
+}
+
+func validateClientConfig(path string, clientConfig admissionregistration.WebhookClientConfig) []string {
+	var problems []string
+	switch {
+	case clientConfig.URL == nil && clientConfig.Service == nil:
+		problems = append(problems, path+": one of url and service is required")
+	case clientConfig.URL != nil && clientConfig.Service != nil:
+		problems = append(problems, path+": only one of url and service is allowed")
+	case clientConfig.URL != nil:
+		if u, err := url.Parse(*clientConfig.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s.url: %q must be an https URL", path, *clientConfig.URL))
+		}
+	default:
+		service := clientConfig.Service
+		if service.Name == "" {
+			problems = append(problems, path+".service.name: required")
+		}
+		if service.Namespace == "" {
+			problems = append(problems, path+".service.namespace: required")
+		}
+		if service.Port != nil && (*service.Port < 1 || *service.Port > 65535) {
+			problems = append(problems, fmt.Sprintf("%s.service.port: %d is not a valid port", path, *service.Port))
+		}
+	}
+	return problems
+}
+
+func validateWebhookSettings(path string, webhook admissionregistration.MutatingWebhook) []string {
+	var problems []string
+	if len(webhook.AdmissionReviewVersions) == 0 {
+		problems = append(problems, fmt.Sprintf("%s.admissionReviewVersions: required, supported are %v", path, supportedAdmissionReviewVersions))
+	}
+	for _, version := range webhook.AdmissionReviewVersions {
+		if !slices.Contains(supportedAdmissionReviewVersions, version) {
+			problems = append(problems, fmt.Sprintf("%s.admissionReviewVersions: %q is not supported, supported are %v", path, version, supportedAdmissionReviewVersions))
+		}
+	}
+	if webhook.SideEffects == nil {
+		problems = append(problems, path+".sideEffects: required, None or NoneOnDryRun")
+	} else if *webhook.SideEffects != admissionregistration.SideEffectClassNone && *webhook.SideEffects != admissionregistration.SideEffectClassNoneOnDryRun {
+		problems = append(problems, fmt.Sprintf("%s.sideEffects: %q is not supported, expected None or NoneOnDryRun", path, *webhook.SideEffects))
+	}
+	if p := webhook.FailurePolicy; p != nil && *p != admissionregistration.Ignore && *p != admissionregistration.Fail {
+		problems = append(problems, fmt.Sprintf("%s.failurePolicy: %q is not supported, expected Ignore or Fail", path, *p))
+	}
+	if p := webhook.MatchPolicy; p != nil && *p != admissionregistration.Exact && *p != admissionregistration.Equivalent {
+		problems = append(problems, fmt.Sprintf("%s.matchPolicy: %q is not supported, expected Exact or Equivalent", path, *p))
+	}
+	if p := webhook.ReinvocationPolicy; p != nil && *p != admissionregistration.NeverReinvocationPolicy && *p != admissionregistration.IfNeededReinvocationPolicy {
+		problems = append(problems, fmt.Sprintf("%s.reinvocationPolicy: %q is not supported, expected Never or IfNeeded", path, *p))
+	}
+	if t := webhook.TimeoutSeconds; t != nil && (*t < 1 || *t > 30) {
+		problems = append(problems, fmt.Sprintf("%s.timeoutSeconds: %d must be between 1 and 30", path, *t))
+	}
+	return problems
+}
+
+func validateRule(path string, rule admissionregistration.RuleWithOperations) []string {
+	var problems []string
+	if len(rule.Operations) == 0 {
+		problems = append(problems, path+".operations: required")
+	}
+	for _, operation := range rule.Operations {
+		if !slices.Contains(supportedOperations, operation) {
+			problems = append(problems, fmt.Sprintf("%s.operations: %q is not supported, expected one of %v", path, operation, supportedOperations))
+		}
+	}
+	if len(rule.APIGroups) == 0 {
+		problems = append(problems, path+".apiGroups: required")
+	}
+	if len(rule.APIVersions) == 0 {
+		problems = append(problems, path+".apiVersions: required")
+	}
+	if len(rule.Resources) == 0 {
+		problems = append(problems, path+".resources: required")
+	}
+	if s := rule.Scope; s != nil && *s != admissionregistration.AllScopes && *s != admissionregistration.ClusterScope && *s != admissionregistration.NamespacedScope {
+		problems = append(problems, fmt.Sprintf("%s.scope: %q is not supported, expected Cluster, Namespaced or *", path, *s))
+	}
+	return problems
+}
+
+// checkServices returns a problem for every webhook whose Service lacks the port it calls. A
+// Service that is missing, or that cannot be read, is reported as a warning.
+func checkServices(ctx context.Context, clientset kubernetes.Interface, result *Result, webhookConfig *admissionregistration.MutatingWebhookConfiguration) ([]string, error) {
+	logger := log.MustGetLogger(ctx)
+	var problems []string
+	for i, webhook := range webhookConfig.Webhooks {
+		ref := webhook.ClientConfig.Service
+		if ref == nil || ref.Name == "" || ref.Namespace == "" {
+			continue
+		}
+		path := fmt.Sprintf("webhooks[%d].clientConfig.service", i)
+		service, getErr := clientset.CoreV1().Services(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(getErr) || k8serrors.IsForbidden(getErr) {
+			logger.Warningf(ctx, "cannot check service %s/%s of %s. error: %s", ref.Namespace, ref.Name, path, getErr)
+			result.warn("%s: service %s/%s could not be checked: %s", path, ref.Namespace, ref.Name, getErr)
+			continue
+		}
+		if getErr != nil {
+			logger.Errorf(ctx, "get service %s/%s failed. error: %s", ref.Namespace, ref.Name, getErr)
+			metrics.RecordAPIError("get", "services", getErr)
+			return nil, errdefs.NewAPIError("get", "services", ref.Name, getErr)
+		}
+		port := int32(443)
+		if ref.Port != nil {
+			port = *ref.Port
+		}
+		found := false
+		for _, servicePort := range service.Spec.Ports {
+			found = found || servicePort.Port == port
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s.port: service %s/%s has no port %d", path, ref.Namespace, ref.Name, port))
+		}
+	}
+	return problems, nil
+}
+
+// Validate checks the webhook configuration in the ConfigMap as a reconcile would before applying
+// it, including the server-side dry-run, without changing anything. Problems are returned as an
+// ObjectError with the reason ErrConfigMapInvalid, warnings in the result.
+func Validate(ctx context.Context, clientset kubernetes.Interface, isKubeSystemNamespaceBlocked bool) (*Result, error) {
+	ctx, span := log.StartSpan(ctx, "Validate", nil)
+	defer span.End()
+	ctx = log.WithFields(ctx, "component", "reconciler", "phase", "validate")
+	logger := log.MustGetLogger(ctx)
+	result := &Result{Attempts: 1}
+
+	var caCert []byte
+	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if getErr == nil {
+		caCert = caBundle(secret)
+	} else if !k8serrors.IsNotFound(getErr) {
+		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
+		metrics.RecordAPIError("get", "secrets", getErr)
+		err := errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+		span.SetStatus(err)
+		return result, err
+	}
+	declared, err := getMutatingWebhookConfigFromConfigmap(ctx, clientset, caCert, isKubeSystemNamespaceBlocked)
+	if err != nil {
+		span.SetStatus(err)
+		return result, err
+	}
+
+	_, getErr = clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+	if getErr != nil && !k8serrors.IsNotFound(getErr) {
+		logger.Errorf(ctx, "get mutating webhook configuration %s failed. error: %s", config.WebhookConfigName(), getErr)
+		metrics.RecordAPIError("get", "mutatingwebhookconfigurations", getErr)
+		err := errdefs.NewAPIError("get", "mutatingwebhookconfigurations", config.WebhookConfigName(), getErr)
+		span.SetStatus(err)
+		return result, err
+	}
+	err = checkWebhookConfig(ctx, clientset, result, declared, getErr == nil)
+	span.SetStatus(err)
+	return result, err
+}
+
+// dryRunWebhook creates or applies webhookConfig with dryRun=All, so the API server validates
+// it without storing it. The apply is forced, since conflicts are reported by the apply itself.
+func dryRunWebhook(ctx context.Context, clientset kubernetes.Interface, webhookConfig *admissionregistration.MutatingWebhookConfiguration, exists bool) error {
+	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	verb := "create"
+	var err error
+	if exists {
+		verb = "apply"
+		var applyConfig *admissionregistrationv1apply.MutatingWebhookConfigurationApplyConfiguration
+		if applyConfig, err = webhookApplyConfiguration(webhookConfig); err != nil {
+			return err
+		}
+		_, err = client.Apply(ctx, applyConfig, metav1.ApplyOptions{FieldManager: consts.FieldManager, Force: true, DryRun: []string{metav1.DryRunAll}})
+	} else {
+		_, err = client.Create(ctx, webhookConfig, metav1.CreateOptions{FieldManager: consts.FieldManager, DryRun: []string{metav1.DryRunAll}})
+	}
+	if err != nil && !k8serrors.IsInvalid(err) {
+		log.MustGetLogger(ctx).Errorf(ctx, "dry-run %s mutating webhook configuration %s failed. error: %s", verb, webhookConfig.Name, err)
+		metrics.RecordAPIError(verb, "mutatingwebhookconfigurations", err)
+		return errdefs.NewAPIError(verb, "mutatingwebhookconfigurations", webhookConfig.Name, err)
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+package reconcilers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/Azure/webhook-tls-manager/config"
+	"github.com/Azure/webhook-tls-manager/errdefs"
+	"github.com/Azure/webhook-tls-manager/metrics"
+	"github.com/Azure/webhook-tls-manager/toolkit/certificates"
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// Serving is the certificate of the secret an endpoint of the webhook presented.
+type Serving string
+
+const (
+	ServingCurrent     Serving = "current"
+	ServingPrevious    Serving = "previous"
+	ServingUnknown     Serving = "unknown"
+	ServingUnreachable Serving = "unreachable"
+)
+
+// verifyTimeout bounds the TLS handshake with one endpoint.
+const verifyTimeout = 5 * time.Second
+
+// EndpointVerification is the result of the TLS handshake with one endpoint of a webhook.
+type EndpointVerification struct {
+	Webhook    string  `json:"webhook"`
+	Address    string  `json:"address"`
+	ServerName string  `json:"serverName"`
+	Serving    Serving `json:"serving"`
+	// Trusted is true if the certificate chains to the caBundle of the webhook and is valid for
+	// ServerName.
+	Trusted bool   `json:"trusted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// verifyEndpoints performs a TLS handshake with every ready endpoint of every webhook, using the
+// caBundle of the webhook and the server name the API server expects, and adds the outcome to
+// the result. An endpoint serving the previous or an unknown but trusted certificate, or a webhook
+// without ready endpoints, is a warning. An endpoint that is unreachable or whose certificate is
+// not trusted is returned as a problem.
+func verifyEndpoints(ctx context.Context, clientset kubernetes.Interface, result *Result) ([]string, error) {
+	logger := log.MustGetLogger(ctx)
+	secret, getErr := clientset.CoreV1().Secrets(config.AppConfig.Namespace).Get(ctx, config.SecretName(), metav1.GetOptions{})
+	if getErr != nil {
+		logger.Errorf(ctx, "get secret %s failed. error: %s", config.SecretName(), getErr)
+		metrics.RecordAPIError("get", "secrets", getErr)
+		return nil, errdefs.NewAPIError("get", "secrets", config.SecretName(), getErr)
+	}
+	// A certificate that cannot be parsed matches no endpoint.
+	current, _ := certificates.ParsePEMCertificate(secret.Data["serverCert.pem"])
+	previous, _ := certificates.ParsePEMCertificate(secret.Data[previousKeyPrefix+"serverCert.pem"])
+
+	webhookConfig, getErr := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, config.WebhookConfigName(), metav1.GetOptions{})
+	if getErr != nil {
+		logger.Errorf(ctx, "get mutating webhook configuration %s failed. error: %s", config.WebhookConfigName(), getErr)
+		metrics.RecordAPIError("get", "mutatingwebhookconfigurations", getErr)
+		return nil, errdefs.NewAPIError("get", "mutatingwebhookconfigurations", config.WebhookConfigName(), getErr)
+	}
+
+	var problems []string
+	for _, webhook := range webhookConfig.Webhooks {
+		serverName, addresses, err := webhookEndpoints(ctx, clientset, webhook.ClientConfig)
+		if err != nil {
+			return nil, err
+		}
+		if len(addresses) == 0 {
+			logger.Warningf(ctx, "webhook %s has no ready endpoints to verify.", webhook.Name)
+			result.warn("webhook %s has no ready endpoints to verify", webhook.Name)
+			continue
+		}
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(webhook.ClientConfig.CABundle)
+		for _, address := range addresses {
+			verification := verifyEndpoint(ctx, webhook.Name, address, serverName, roots, current, previous)
+			result.Endpoints = append(result.Endpoints, verification)
+			switch {
+			case verification.Serving == ServingUnreachable:
+				problems = append(problems, fmt.Sprintf("endpoint %s of webhook %s is unreachable: %s", address, webhook.Name, verification.Error))
+			case !verification.Trusted:
+				problems = append(problems, fmt.Sprintf("endpoint %s of webhook %s serves the %s certificate, which is not trusted: %s", address, webhook.Name, verification.Serving, verification.Error))
+			case verification.Serving == ServingPrevious:
+				result.warn("endpoint %s of webhook %s serves the previous certificate. its backend has not reloaded the secret yet", address, webhook.Name)
+			case verification.Serving == ServingUnknown:
+				result.warn("endpoint %s of webhook %s serves a trusted certificate that is not in the secret", address, webhook.Name)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// webhookEndpoints returns the server name the API server expects from the backend of a webhook
+// and the addresses of its ready endpoints. A service is resolved through its EndpointSlices.
+func webhookEndpoints(ctx context.Context, clientset kubernetes.Interface, clientConfig admissionregistration.WebhookClientConfig) (string, []string, error) {
+	logger := log.MustGetLogger(ctx)
+	if clientConfig.URL != nil {
+		u, err := url.Parse(*clientConfig.URL)
+		if err != nil {
+			return "", nil, fmt.Errorf("parse webhook url %s: %w", *clientConfig.URL, err)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		return u.Hostname(), []string{net.JoinHostPort(u.Hostname(), port)}, nil
+	}
+	ref := clientConfig.Service
+	if ref == nil {
+		return "", nil, nil
+	}
+	serverName := ref.Name + "." + ref.Namespace + ".svc"
+	service, getErr := clientset.CoreV1().Services(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(getErr) {
+		return serverName, nil, nil
+	}
+	if getErr != nil {
+		logger.Errorf(ctx, "get service %s/%s failed. error: %s", ref.Namespace, ref.Name, getErr)
+		metrics.RecordAPIError("get", "services", getErr)
+		return "", nil, errdefs.NewAPIError("get", "services", ref.Name, getErr)
+	}
+	port := int32(443)
+	if ref.Port != nil {
+		port = *ref.Port
+	}
+	portName, found := "", false
+	for _, servicePort := range service.Spec.Ports {
+		if servicePort.Port == port {
+			portName, found = servicePort.Name, true
+		}
+	}
+	if !found {
+		return serverName, nil, nil
+	}
+
+	endpointSlices, listErr := clientset.DiscoveryV1().EndpointSlices(ref.Namespace).List(ctx, metav1.ListOptions{LabelSelector: discoveryv1.LabelServiceName + "=" + ref.Name})
+	if listErr != nil {
+		logger.Errorf(ctx, "list endpoint slices of service %s/%s failed. error: %s", ref.Namespace, ref.Name, listErr)
+		metrics.RecordAPIError("list", "endpointslices", listErr)
+		return "", nil, errdefs.NewAPIError("list", "endpointslices", ref.Name, listErr)
+	}
+	var addresses []string
+	for _, slice := range endpointSlices.Items {
+		var targetPort *int32
+		for _, slicePort := range slice.Ports {
+			if (slicePort.Name == nil && portName == "" || slicePort.Name != nil && *slicePort.Name == portName) && slicePort.Port != nil {
+				targetPort = slicePort.Port
+			}
+		}
+		if targetPort == nil {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				addresses = append(addresses, net.JoinHostPort(address, strconv.Itoa(int(*targetPort))))
+			}
+		}
+	}
+	return serverName, addresses, nil
+}
+
+// verifyEndpoint performs a TLS handshake with address and reports which certificate it serves
+// and whether roots trust it for serverName.
+func verifyEndpoint(ctx context.Context, webhook, address, serverName string, roots *x509.CertPool, current, previous *x509.Certificate) EndpointVerification {
+	logger := log.MustGetLogger(ctx)
+	verification := EndpointVerification{Webhook: webhook, Address: address, ServerName: serverName, Serving: ServingUnreachable}
+	var served *x509.Certificate
+	var verifyErr error
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+		// The certificate is verified in VerifyConnection, so the handshake completes also with
+		// an untrusted certificate, which can then be told apart from the certificates of the secret.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("no certificate presented")
+			}
+			served = state.PeerCertificates[0]
+			intermediates := x509.NewCertPool()
+			for _, cert := range state.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, verifyErr = served.Verify(x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: intermediates})
+			return nil
+		},
+	}}
+	dialCtx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+	conn, dialErr := dialer.DialContext(dialCtx, "tcp", address)
+	if dialErr != nil {
+		logger.Warningf(ctx, "TLS handshake with endpoint %s of webhook %s failed. error: %s", address, webhook, dialErr)
+		verification.Error = dialErr.Error()
+		return verification
+	}
+	conn.Close()
+
+	switch {
+	case current != nil && served.Equal(current):
+		verification.Serving = ServingCurrent
+	case previous != nil && served.Equal(previous):
+		verification.Serving = ServingPrevious
+	default:
+		verification.Serving = ServingUnknown
+	}
+	verification.Trusted = verifyErr == nil
+	if verifyErr != nil {
+		verification.Error = verifyErr.Error()
+	}
+	logger.Infof(ctx, "endpoint %s of webhook %s serves the %s certificate. trusted: %t", address, webhook, verification.Serving, verification.Trusted)
+	return verification
+}
+
+// Verify checks that every ready endpoint of the webhooks serves a certificate that the caBundle of
+// the webhook trusts for the server name the API server expects, and reports whether it is the
+// current, the previous or an unknown certificate. Unreachable or untrusted endpoints are
+// returned as an ObjectError with the reason ErrEndpointUntrusted.
+func Verify(ctx context.Context, clientset kubernetes.Interface) (*Result, error) {
+	ctx, span := log.StartSpan(ctx, "Verify", nil)
+	defer span.End()
+	ctx = log.WithFields(ctx, "component", "reconciler", "phase", "verify")
+	logger := log.MustGetLogger(ctx)
+	result := &Result{Attempts: 1}
+
+	problems, err := verifyEndpoints(ctx, clientset, result)
+	if err == nil && len(problems) > 0 {
+		errs := make([]error, 0, len(problems))
+		for _, problem := range problems {
+			logger.Errorf(ctx, "verification failed: %s", problem)
+			errs = append(errs, errors.New(problem))
+		}
+		err = &errdefs.ObjectError{Kind: webhookKind, Name: config.WebhookConfigName(), Reason: errdefs.ErrEndpointUntrusted, Err: errors.Join(errs...)}
+	}
+	span.SetStatus(err)
+	return result, err
+}
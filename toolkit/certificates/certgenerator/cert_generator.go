@@ -26,6 +26,14 @@ func NewCertGenerator(certCreator certcreator.CertCreator) CertGenerator {
 	}
 }
 
+func generateKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	_, span := log.StartSpan(ctx, "rsa.GenerateKey", map[string]interface{}{"key.size": KeySize})
+	defer span.End()
+	privateKey, err := rsa.GenerateKey(rand.Reader, KeySize)
+	span.SetStatus(err)
+	return privateKey, err
+}
+
 func (c *certificateGeneratorImp) CreateSelfSignedCertificateKeyPair(ctx context.Context, csr *x509.Certificate) (*x509.Certificate, *rsa.PrivateKey, *retry.Error) {
 	if csr == nil {
 		return nil, nil, retry.NewError(false, fmt.Errorf("certificate signing request is nil"))
@@ -33,7 +41,7 @@ func (c *certificateGeneratorImp) CreateSelfSignedCertificateKeyPair(ctx context
 
 	logger := log.MustGetLogger(ctx)
 
-	privateKey, err := rsa.GenerateKey(rand.Reader, KeySize)
+	privateKey, err := generateKey(ctx)
 	if err != nil {
 		logger.Errorf(ctx, "rsa.GenerateKeyfailed: %s", err)
 		return nil, nil, retry.NewError(true, err)
@@ -55,7 +63,7 @@ func (c *certificateGeneratorImp) CreateCertificateKeyPair(ctx context.Context,
 
 	logger := log.MustGetLogger(ctx)
 
-	privateKey, err := rsa.GenerateKey(rand.Reader, KeySize)
+	privateKey, err := generateKey(ctx)
 	if err != nil {
 		logger.Errorf(ctx, "rsa.GenerateKey failed: %s", err)
 		return nil, nil, retry.NewError(true, err)
@@ -6,8 +6,11 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"math/big"
@@ -46,6 +49,30 @@ func IsPEMCertificateExpired(ctx context.Context, encodedCert, certName string,
 	return false, nil
 }
 
+// ParsePEMCertificate parses the first PEM block of encodedCert as a x509 certificate
+func ParsePEMCertificate(encodedCert []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(encodedCert)
+	if block == nil || len(block.Bytes) < 1 {
+		return nil, fmt.Errorf("failed to pem decode cert")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParsePEMPrivateKey parses the first PEM block of encodedKey as a PKCS #1 RSA private key
+func ParsePEMPrivateKey(encodedKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(encodedKey)
+	if block == nil || len(block.Bytes) < 1 {
+		return nil, fmt.Errorf("failed to pem decode key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// Fingerprint returns the hex encoded SHA-256 digest of the DER encoded certificate
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
 func GetPEMCertificateString(expirationTime time.Time) (string, error) {
 	priv, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
 	if err != nil {
@@ -0,0 +1,183 @@
+package log
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/klog/v2"
+)
+
+type logrusBackend struct {
+	logger *logrus.Logger
+}
+
+func newLogrusBackend(opts Options) Backend {
+	logger := logrus.New()
+	logger.SetOutput(opts.Output)
+	switch opts.Level {
+	case TraceLevel:
+		logger.SetLevel(logrus.TraceLevel)
+	case DebugLevel:
+		logger.SetLevel(logrus.DebugLevel)
+	case InfoLevel:
+		logger.SetLevel(logrus.InfoLevel)
+	case WarnLevel:
+		logger.SetLevel(logrus.WarnLevel)
+	default:
+		logger.SetLevel(logrus.ErrorLevel)
+	}
+	if opts.Format == TextFormat {
+		logger.Formatter = &logrus.TextFormatter{FullTimestamp: true}
+	} else {
+		logger.Formatter = &logrus.JSONFormatter{}
+	}
+	return &logrusBackend{logger: logger}
+}
+
+func (b *logrusBackend) logrusLevel(level Level) logrus.Level {
+	switch level {
+	case TraceLevel:
+		return logrus.TraceLevel
+	case DebugLevel:
+		return logrus.DebugLevel
+	case InfoLevel:
+		return logrus.InfoLevel
+	case WarnLevel:
+		return logrus.WarnLevel
+	default:
+		return logrus.ErrorLevel
+	}
+}
+
+func (b *logrusBackend) Enabled(level Level) bool {
+	return b.logger.IsLevelEnabled(b.logrusLevel(level))
+}
+
+func (b *logrusBackend) Log(level Level, msg string, fields map[string]interface{}) {
+	b.logger.WithFields(fields).Log(b.logrusLevel(level), msg)
+}
+
+// slogTraceLevel sits below slog.LevelDebug, which slog leaves room for.
+const slogTraceLevel = slog.LevelDebug - 4
+
+type slogBackend struct {
+	logger *slog.Logger
+}
+
+func newSlogBackend(opts Options) Backend {
+	handlerOptions := &slog.HandlerOptions{Level: slogLevel(opts.Level)}
+	var handler slog.Handler
+	if opts.Format == TextFormat {
+		handler = slog.NewTextHandler(opts.Output, handlerOptions)
+	} else {
+		handler = slog.NewJSONHandler(opts.Output, handlerOptions)
+	}
+	return &slogBackend{logger: slog.New(handler)}
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case TraceLevel:
+		return slogTraceLevel
+	case DebugLevel:
+		return slog.LevelDebug
+	case InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+func (b *slogBackend) Enabled(level Level) bool {
+	return b.logger.Enabled(context.Background(), slogLevel(level))
+}
+
+func (b *slogBackend) Log(level Level, msg string, fields map[string]interface{}) {
+	b.logger.Log(context.Background(), slogLevel(level), msg, keysAndValues(fields)...)
+}
+
+// klogBackend logs through the global klog logger, so it shares its output with client-go.
+type klogBackend struct {
+	level Level
+}
+
+// klogDepth skips the backend and the Logger frames so klog's header points at the caller.
+const klogDepth = 3
+
+func newKlogBackend(opts Options) (Backend, error) {
+	if opts.Format != TextFormat {
+		return nil, fmt.Errorf("klog backend only supports the %s format", TextFormat)
+	}
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	verbosity := 0
+	switch opts.Level {
+	case TraceLevel:
+		verbosity = 5
+	case DebugLevel:
+		verbosity = 4
+	}
+	for name, value := range map[string]string{
+		"logtostderr":     "false",
+		"alsologtostderr": "false",
+		"one_output":      "true",
+		"v":               strconv.Itoa(verbosity),
+	} {
+		if err := flags.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	klog.SetOutput(opts.Output)
+	return &klogBackend{level: opts.Level}, nil
+}
+
+func (b *klogBackend) Enabled(level Level) bool {
+	return level >= b.level
+}
+
+func (b *klogBackend) Log(level Level, msg string, fields map[string]interface{}) {
+	if !b.Enabled(level) {
+		return
+	}
+	kvs := keysAndValues(fields)
+	switch level {
+	case TraceLevel:
+		klog.V(5).InfoSDepth(klogDepth, msg, kvs...)
+	case DebugLevel:
+		klog.V(4).InfoSDepth(klogDepth, msg, kvs...)
+	case InfoLevel:
+		klog.InfoSDepth(klogDepth, msg, kvs...)
+	case WarnLevel:
+		// klog has no structured warning call.
+		pairs := make([]string, 0, len(kvs)/2)
+		for i := 0; i+1 < len(kvs); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", kvs[i], fmt.Sprint(kvs[i+1])))
+		}
+		klog.WarningDepth(klogDepth, strconv.Quote(msg)+" "+strings.Join(pairs, " "))
+	default:
+		klog.ErrorSDepth(klogDepth, nil, msg, kvs...)
+	}
+	klog.Flush()
+}
+
+// keysAndValues flattens fields into sorted key-value pairs for slog and klog.
+func keysAndValues(fields map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, k, fields[k])
+	}
+	return kvs
+}
@@ -3,9 +3,12 @@ package log
 import (
 	"context"
 	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
 	"runtime"
-
-	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
 
 	otelTrace "go.opentelemetry.io/otel/trace"
 )
@@ -17,14 +20,90 @@ const (
 	lineNumberFieldName   = "lineNumber"
 )
 
+// Level is the severity of a log line.
+type Level int
+
+const (
+	TraceLevel Level = iota
+	DebugLevel
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case TraceLevel:
+		return "trace"
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel accepts the level names trace, debug, info, warning (or warn) and error, and for
+// backwards compatibility the integer levels 3 (info), 4 (debug) and 5 (trace).
+func ParseLevel(level string) (Level, error) {
+	switch strings.ToLower(level) {
+	case "trace", "5":
+		return TraceLevel, nil
+	case "debug", "4":
+		return DebugLevel, nil
+	case "info", "3":
+		return InfoLevel, nil
+	case "warning", "warn":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	if _, err := strconv.Atoi(level); err == nil {
+		// Other integer levels were always treated as info.
+		return InfoLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q", level)
+}
+
+// Backend writes log lines. Implementations exist for logrus, log/slog and klog.
+type Backend interface {
+	Enabled(level Level) bool
+	Log(level Level, msg string, fields map[string]interface{})
+}
+
+const (
+	LogrusBackend = "logrus"
+	SlogBackend   = "slog"
+	KlogBackend   = "klog"
+
+	JSONFormat = "json"
+	TextFormat = "text"
+)
+
+// Options configures New. The zero value logs info and above as JSON through logrus to stderr.
+type Options struct {
+	Backend string
+	Level   Level
+	Format  string
+	Output  io.Writer
+}
+
 type Logger struct {
-	logger *logrus.Entry
+	backend Backend
+	fields  map[string]interface{}
 }
 
 type loggerKeyType string
 
 const loggerKey loggerKeyType = "web-tls-manager"
 
+type fieldsKeyType struct{}
+
+var fieldsKey = fieldsKeyType{}
+
 func (logger *Logger) WithLogger(ctx context.Context) context.Context {
 	return context.WithValue(ctx, loggerKey, logger)
 }
@@ -37,6 +116,27 @@ func MustGetLogger(ctx context.Context) *Logger {
 	return logger
 }
 
+// WithFields returns a context carrying the given key-value pairs, e.g. "object", name,
+// "phase", "rotate". They are added to every line logged with the context and its children.
+func WithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	fields := map[string]interface{}{}
+	for k, v := range fieldsFromContext(ctx) {
+		fields[k] = v
+	}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields[fmt.Sprint(keysAndValues[i])] = keysAndValues[i+1]
+	}
+	return context.WithValue(ctx, fieldsKey, fields)
+}
+
+func fieldsFromContext(ctx context.Context) map[string]interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey).(map[string]interface{})
+	return fields
+}
+
 func getEpochRandomString() (string, error) {
 	randomBytes := make([]byte, 5)
 	_, err := rand.Read(randomBytes)
@@ -50,27 +150,53 @@ func getEpochRandomString() (string, error) {
 	return string(randomBytes), nil
 }
 
+// NewLogger returns a logrus JSON logger for the integer levels 3 (info), 4 (debug) and 5 (trace).
 func NewLogger(loggerLevel int) *Logger {
-	logger := logrus.New()
-	switch loggerLevel {
-	case 4:
-		logger.SetLevel(logrus.DebugLevel)
-	case 5:
-		logger.SetLevel(logrus.TraceLevel)
+	level, _ := ParseLevel(strconv.Itoa(loggerLevel))
+	logger, _ := New(Options{Level: level})
+	return logger
+}
+
+// New returns a logger on the backend selected by opts.
+func New(opts Options) (*Logger, error) {
+	if opts.Output == nil {
+		opts.Output = os.Stderr
+	}
+	if opts.Format == "" {
+		opts.Format = JSONFormat
+	}
+	if opts.Format != JSONFormat && opts.Format != TextFormat {
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	var backend Backend
+	var err error
+	switch opts.Backend {
+	case "", LogrusBackend:
+		backend = newLogrusBackend(opts)
+	case SlogBackend:
+		backend = newSlogBackend(opts)
+	case KlogBackend:
+		backend, err = newKlogBackend(opts)
 	default:
-		logger.SetLevel(logrus.InfoLevel)
+		err = fmt.Errorf("unknown log backend %q", opts.Backend)
+	}
+	if err != nil {
+		return nil, err
 	}
-	logger.Formatter = &logrus.JSONFormatter{}
 	epoch, _ := getEpochRandomString()
-	return &Logger{logger: logger.WithField(epochFieldName, epoch)}
+	return &Logger{backend: backend, fields: map[string]interface{}{epochFieldName: epoch}}, nil
 }
 
-func (logger *Logger) withCallerInfo() *logrus.Entry {
-	_, file, line, _ := runtime.Caller(3)
-	fields := make(map[string]interface{})
-	fields[fileNameFieldName] = file
-	fields[lineNumberFieldName] = line
-	return logger.logger.WithFields(fields)
+func (logger *Logger) withFields(fields map[string]interface{}) *Logger {
+	merged := make(map[string]interface{}, len(logger.fields)+len(fields))
+	for k, v := range logger.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{backend: logger.backend, fields: merged}
 }
 
 func GetOtelSpanFromContext(ctx context.Context) Span {
@@ -87,37 +213,56 @@ func (logger *Logger) withSpanInfo(ctx context.Context) *Logger {
 	if !span.IsValid() {
 		return logger
 	}
-	logrusLogger := logger.logger.WithFields(map[string]interface{}{
+	return logger.withFields(map[string]interface{}{
 		"spanID":  span.GetSpanID(),
 		"traceID": span.GetTraceID(),
 	})
-	return &Logger{logrusLogger}
+}
+
+// log is called by the exported methods only, so the caller two frames up is the code that logged.
+func (logger *Logger) log(ctx context.Context, level Level, msg string) {
+	_, file, line, _ := runtime.Caller(2)
+	fields := logger.withSpanInfo(ctx).withFields(fieldsFromContext(ctx)).fields
+	fields[fileNameFieldName] = file
+	fields[lineNumberFieldName] = line
+	logger.backend.Log(level, msg, fields)
 }
 
 func (logger *Logger) Info(ctx context.Context, msg string) {
-	logger.withSpanInfo(ctx).withCallerInfo().Info(msg)
+	logger.log(ctx, InfoLevel, RedactString(msg))
 }
 
 func (logger *Logger) Infof(ctx context.Context, fmt string, args ...interface{}) {
-	logger.withSpanInfo(ctx).withCallerInfo().Infof(fmt, args...)
+	if !logger.backend.Enabled(InfoLevel) {
+		return
+	}
+	logger.log(ctx, InfoLevel, sprintf(fmt, redactArgs(args, true)...))
 }
 
 func (logger *Logger) Error(ctx context.Context, msg string) {
-	logger.withSpanInfo(ctx).withCallerInfo().Error(msg)
+	logger.log(ctx, ErrorLevel, RedactString(msg))
 }
 
 func (logger *Logger) Errorf(ctx context.Context, fmt string, args ...interface{}) {
-	logger.withSpanInfo(ctx).withCallerInfo().Errorf(fmt, args...)
+	logger.log(ctx, ErrorLevel, sprintf(fmt, redactArgs(args, true)...))
 }
 
 func (logger *Logger) Warning(ctx context.Context, msg string) {
-	logger.withSpanInfo(ctx).withCallerInfo().Error(msg)
+	logger.log(ctx, WarnLevel, RedactString(msg))
 }
 
 func (logger *Logger) Warningf(ctx context.Context, fmt string, args ...interface{}) {
-	logger.withSpanInfo(ctx).withCallerInfo().Warningf(fmt, args...)
+	logger.log(ctx, WarnLevel, sprintf(fmt, redactArgs(args, true)...))
 }
 
+// Debugf renders objects in full, with secret material redacted.
 func (logger *Logger) Debugf(ctx context.Context, fmt string, args ...interface{}) {
-	logger.withSpanInfo(ctx).withCallerInfo().Debugf(fmt, args...)
+	if !logger.backend.Enabled(DebugLevel) {
+		return
+	}
+	logger.log(ctx, DebugLevel, sprintf(fmt, redactArgs(args, false)...))
+}
+
+func sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(format, args...)
 }
@@ -4,29 +4,23 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 var _ = Describe(
 	"Logger functionality",
 	func() {
 		Context("WithSpanInfo", func() {
-			var (
-				baseLogger *logrus.Logger
-				logger     *Logger
-			)
+			var logger *Logger
 
 			BeforeEach(func() {
-				baseLogger = logrus.New()
-				logger = &Logger{logger: logrus.NewEntry(baseLogger)}
-			})
-
-			BeforeEach(func() {
-				baseLogger = logrus.New()
-				logger = &Logger{logger: logrus.NewEntry(baseLogger)}
+				logger = NewLogger(3)
 			})
 
 			It("returns the same logger when context is nil", func() {
@@ -46,7 +40,7 @@ var _ = Describe(
 			logger := NewLogger(3)
 			ctx := logger.WithLogger(context.Background())
 			buf := &bytes.Buffer{}
-			logger.logger.Logger.SetOutput(buf)
+			logger.backend.(*logrusBackend).logger.SetOutput(buf)
 			logger.Info(ctx, "test")
 			fmt.Print(buf.String())
 			Expect(buf.String()).To(ContainSubstring("test"))
@@ -58,10 +52,180 @@ var _ = Describe(
 			Expect(ctx).NotTo(BeNil())
 			logger = MustGetLogger(ctx)
 			buf := &bytes.Buffer{}
-			logger.logger.Logger.SetOutput(buf)
+			logger.backend.(*logrusBackend).logger.SetOutput(buf)
 			logger.Error(ctx, "test")
 			fmt.Print(buf.String())
 			Expect(buf.String()).To(ContainSubstring("test"))
 		})
+
+		Context("tracing", func() {
+			const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+			var recorder *tracetest.SpanRecorder
+
+			BeforeEach(func() {
+				recorder = tracetest.NewSpanRecorder()
+				otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			})
+
+			It("starts spans as children of the traceparent", func() {
+				ctx := ContextWithTraceParent(context.Background(), traceParent)
+				ctx, span := StartSpan(ctx, "test", map[string]interface{}{"attempt": 1})
+				span.SetStatus(nil)
+				span.End()
+				Expect(span.GetTraceID()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+				Expect(GetOtelSpanFromContext(ctx).GetSpanID()).To(Equal(span.GetSpanID()))
+				Expect(recorder.Ended()).To(HaveLen(1))
+				Expect(recorder.Ended()[0].Parent().SpanID().String()).To(Equal("00f067aa0ba902b7"))
+			})
+
+			It("ignores an empty traceparent", func() {
+				ctx := ContextWithTraceParent(context.Background(), "")
+				Expect(GetOtelSpanFromContext(ctx).IsValid()).To(BeFalse())
+			})
+
+			It("logs span info", func() {
+				buf := &bytes.Buffer{}
+				logger, _ := New(Options{Output: buf})
+				ctx, span := StartSpan(logger.WithLogger(context.Background()), "test", nil)
+				defer span.End()
+				logger.Info(ctx, "test")
+				Expect(buf.String()).To(ContainSubstring(span.GetTraceID()))
+			})
+
+			It("rejects unsupported exporters", func() {
+				os.Setenv(tracesExporterEnv, "zipkin")
+				defer os.Unsetenv(tracesExporterEnv)
+				_, err := InitTracerProvider(context.Background(), "test")
+				Expect(err).NotTo(BeNil())
+			})
+
+			It("shuts down the exporters created before one fails", func() {
+				var created []*fakeExporter
+				build := func(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+					if name == "zipkin" {
+						return nil, fmt.Errorf("unsupported %q", name)
+					}
+					exporter := &fakeExporter{}
+					created = append(created, exporter)
+					return exporter, nil
+				}
+				_, err := newExporters(context.Background(), "otlp, console,zipkin", build)
+				Expect(err).NotTo(BeNil())
+				Expect(created).To(HaveLen(2))
+				for _, exporter := range created {
+					Expect(exporter.shutdown).To(BeTrue())
+				}
+			})
+
+			It("configures the console exporter", func() {
+				os.Setenv(tracesExporterEnv, "console")
+				defer os.Unsetenv(tracesExporterEnv)
+				shutdown, err := InitTracerProvider(context.Background(), "test")
+				Expect(err).To(BeNil())
+				Expect(shutdown(context.Background())).To(BeNil())
+			})
+		})
+
+		Context("backends", func() {
+			var buf *bytes.Buffer
+
+			BeforeEach(func() {
+				buf = &bytes.Buffer{}
+			})
+
+			log := func(logger *Logger) {
+				ctx := WithFields(logger.WithLogger(context.Background()), "object", "vpa", "phase", "rotate")
+				logger.Debugf(ctx, "hidden %d", 1)
+				logger.Infof(ctx, "shown %d", 1)
+				logger.Warning(ctx, "warned")
+				logger.Error(ctx, "failed")
+			}
+
+			It("logs JSON through logrus", func() {
+				logger, err := New(Options{Backend: LogrusBackend, Level: InfoLevel, Format: JSONFormat, Output: buf})
+				Expect(err).To(BeNil())
+				log(logger)
+				Expect(buf.String()).To(ContainSubstring(`"msg":"shown 1"`))
+				Expect(buf.String()).To(ContainSubstring(`"phase":"rotate"`))
+				Expect(buf.String()).To(ContainSubstring(`"level":"warning"`))
+				Expect(buf.String()).NotTo(ContainSubstring("hidden"))
+			})
+
+			It("logs text through logrus", func() {
+				logger, err := New(Options{Backend: LogrusBackend, Level: DebugLevel, Format: TextFormat, Output: buf})
+				Expect(err).To(BeNil())
+				log(logger)
+				Expect(buf.String()).To(ContainSubstring(`msg="hidden 1"`))
+				Expect(buf.String()).To(ContainSubstring("object=vpa"))
+			})
+
+			It("logs JSON through slog", func() {
+				logger, err := New(Options{Backend: SlogBackend, Level: InfoLevel, Format: JSONFormat, Output: buf})
+				Expect(err).To(BeNil())
+				log(logger)
+				Expect(buf.String()).To(ContainSubstring(`"msg":"shown 1"`))
+				Expect(buf.String()).To(ContainSubstring(`"object":"vpa"`))
+				Expect(buf.String()).To(ContainSubstring(`"level":"WARN"`))
+				Expect(buf.String()).NotTo(ContainSubstring("hidden"))
+			})
+
+			It("logs text through slog", func() {
+				logger, err := New(Options{Backend: SlogBackend, Level: TraceLevel, Format: TextFormat, Output: buf})
+				Expect(err).To(BeNil())
+				log(logger)
+				Expect(buf.String()).To(ContainSubstring(`msg="hidden 1"`))
+				Expect(buf.String()).To(ContainSubstring("phase=rotate"))
+			})
+
+			It("logs text through klog", func() {
+				logger, err := New(Options{Backend: KlogBackend, Level: InfoLevel, Format: TextFormat, Output: buf})
+				Expect(err).To(BeNil())
+				log(logger)
+				Expect(buf.String()).To(ContainSubstring(`"shown 1" env_epoch=`))
+				Expect(buf.String()).To(ContainSubstring(`phase="rotate"`))
+				Expect(buf.String()).To(ContainSubstring("log_test.go"))
+				Expect(buf.String()).NotTo(ContainSubstring("hidden"))
+			})
+
+			It("rejects JSON for klog", func() {
+				_, err := New(Options{Backend: KlogBackend, Format: JSONFormat, Output: buf})
+				Expect(err).NotTo(BeNil())
+			})
+
+			It("rejects unknown backends and formats", func() {
+				_, err := New(Options{Backend: "zap"})
+				Expect(err).NotTo(BeNil())
+				_, err = New(Options{Format: "yaml"})
+				Expect(err).NotTo(BeNil())
+			})
+		})
+
+		It("parses named and integer levels", func() {
+			for input, expected := range map[string]Level{
+				"3": InfoLevel, "4": DebugLevel, "5": TraceLevel, "0": InfoLevel,
+				"trace": TraceLevel, "DEBUG": DebugLevel, "info": InfoLevel, "warn": WarnLevel, "error": ErrorLevel,
+			} {
+				level, err := ParseLevel(input)
+				Expect(err).To(BeNil())
+				Expect(level).To(Equal(expected), input)
+			}
+			_, err := ParseLevel("verbose")
+			Expect(err).NotTo(BeNil())
+		})
 	},
 )
+
+// fakeExporter records whether it was shut down.
+type fakeExporter struct {
+	shutdown bool
+}
+
+func (e *fakeExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return nil
+}
+
+func (e *fakeExporter) Shutdown(context.Context) error {
+	e.shutdown = true
+	return nil
+}
@@ -0,0 +1,250 @@
+package log
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const pemBeginMarker = "-----BEGIN "
+
+// maxRedactDepth bounds the walk of redactValue, e.g. through cyclic pointers.
+const maxRedactDepth = 16
+
+var (
+	pemBlockRegexp = regexp.MustCompile(`-----BEGIN ([A-Z0-9 ]+)-----[^-]*-----END [A-Z0-9 ]+-----`)
+	// Anything left after the complete blocks are replaced, e.g. a truncated key, is dropped
+	// up to the end of the string.
+	pemRemainderRegexp = regexp.MustCompile(`-----BEGIN ([A-Z0-9 ]+)-----[\s\S]*`)
+)
+
+// RedactString replaces every PEM block in s with its type and SHA-256 fingerprint.
+// For certificates the fingerprint is the same as the one exported in the certificate metrics.
+func RedactString(s string) string {
+	if !strings.Contains(s, pemBeginMarker) {
+		return s
+	}
+	s = pemBlockRegexp.ReplaceAllStringFunc(s, func(block string) string {
+		decoded, _ := pem.Decode([]byte(block))
+		if decoded == nil {
+			return "<redacted PEM>"
+		}
+		sum := sha256.Sum256(decoded.Bytes)
+		return fmt.Sprintf("<redacted %s sha256:%s>", decoded.Type, hex.EncodeToString(sum[:]))
+	})
+	return pemRemainderRegexp.ReplaceAllString(s, "<redacted $1>")
+}
+
+// Redact returns a representation of arg that is safe to log. Secrets are always reduced to
+// their name and keys. Other Kubernetes objects are reduced to a one line summary unless
+// summarize is false, in which case they, like any other Kubernetes API struct, are rendered
+// as JSON with every PEM block (also base64 encoded ones such as caBundle) replaced by its
+// fingerprint. Any other argument is only replaced when a string or byte slice in it, also
+// nested in structs, maps, slices or pointers, contains a PEM block.
+func Redact(arg interface{}, summarize bool) interface{} {
+	switch v := arg.(type) {
+	case nil:
+		return nil
+	case string:
+		return RedactString(v)
+	case []byte:
+		return RedactString(string(v))
+	case error:
+		if strings.Contains(v.Error(), pemBeginMarker) {
+			return RedactString(v.Error())
+		}
+		return v
+	}
+
+	value := reflect.ValueOf(arg)
+	if value.Kind() == reflect.Struct {
+		// Kubernetes objects implement metav1.Object on their pointer only.
+		ptr := reflect.New(value.Type())
+		ptr.Elem().Set(value)
+		value = ptr
+	}
+	if value.Kind() == reflect.Ptr && !value.IsNil() {
+		switch v := value.Interface().(type) {
+		case *corev1.Secret:
+			return summarizeSecret(v)
+		case metav1.Object:
+			if summarize {
+				return summarizeObject(v)
+			}
+			return redactJSON(v)
+		}
+		if strings.HasPrefix(value.Elem().Type().PkgPath(), "k8s.io/api/") {
+			return redactJSON(value.Interface())
+		}
+	}
+
+	switch reflect.ValueOf(arg).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Ptr, reflect.Interface:
+		r := &redactor{}
+		r.redactValue(reflect.ValueOf(arg), 0)
+		if r.redacted {
+			return r.String()
+		}
+	}
+	return arg
+}
+
+// redactor renders a value like %+v with every PEM block replaced by its fingerprint. It walks
+// the value itself, as %+v prints byte slices as numbers, which hides key material from RedactString.
+type redactor struct {
+	strings.Builder
+	// redacted is true once a PEM block was replaced.
+	redacted bool
+}
+
+func (r *redactor) redactValue(value reflect.Value, depth int) {
+	if depth > maxRedactDepth {
+		r.WriteString("...")
+		return
+	}
+	switch value.Kind() {
+	case reflect.Invalid:
+		r.WriteString("<nil>")
+	case reflect.String:
+		r.redactString(value.String())
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			r.WriteString("<nil>")
+			return
+		}
+		if value.Kind() == reflect.Ptr {
+			r.WriteString("&")
+		}
+		r.redactValue(value.Elem(), depth+1)
+	case reflect.Struct:
+		r.WriteString("{")
+		for i := 0; i < value.NumField(); i++ {
+			if i > 0 {
+				r.WriteString(" ")
+			}
+			r.WriteString(value.Type().Field(i).Name + ":")
+			r.redactValue(value.Field(i), depth+1)
+		}
+		r.WriteString("}")
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			if bytes := value.Bytes(); strings.Contains(string(bytes), pemBeginMarker) {
+				r.redactString(string(bytes))
+				return
+			}
+		}
+		r.WriteString("[")
+		for i := 0; i < value.Len(); i++ {
+			if i > 0 {
+				r.WriteString(" ")
+			}
+			r.redactValue(value.Index(i), depth+1)
+		}
+		r.WriteString("]")
+	case reflect.Map:
+		entries := make([]string, 0, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			entry := &redactor{}
+			entry.redactValue(iter.Key(), depth+1)
+			entry.WriteString(":")
+			entry.redactValue(iter.Value(), depth+1)
+			r.redacted = r.redacted || entry.redacted
+			entries = append(entries, entry.String())
+		}
+		sort.Strings(entries)
+		r.WriteString("map[" + strings.Join(entries, " ") + "]")
+	default:
+		fmt.Fprintf(r, "%+v", value)
+	}
+}
+
+func (r *redactor) redactString(s string) {
+	if strings.Contains(s, pemBeginMarker) {
+		s = RedactString(s)
+		r.redacted = true
+	}
+	r.WriteString(s)
+}
+
+func redactArgs(args []interface{}, summarize bool) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		redacted[i] = Redact(arg, summarize)
+	}
+	return redacted
+}
+
+func summarizeSecret(secret *corev1.Secret) string {
+	if secret == nil {
+		return "Secret <nil>"
+	}
+	keys := make([]string, 0, len(secret.Data)+len(secret.StringData))
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	for k := range secret.StringData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("Secret %s (type %s, keys: [%s])", objectName(secret), secret.Type, strings.Join(keys, " "))
+}
+
+func summarizeObject(obj metav1.Object) string {
+	return fmt.Sprintf("%s %s (resourceVersion %q)", reflect.TypeOf(obj).Elem().Name(), objectName(obj), obj.GetResourceVersion())
+}
+
+func objectName(obj metav1.Object) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func redactJSON(arg interface{}) interface{} {
+	raw, err := json.Marshal(arg)
+	if err != nil {
+		return arg
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return arg
+	}
+	redacted, err := json.Marshal(redactJSONValue(decoded))
+	if err != nil {
+		return arg
+	}
+	return string(redacted)
+}
+
+func redactJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = redactJSONValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSONValue(item)
+		}
+	case string:
+		if strings.Contains(v, pemBeginMarker) {
+			return RedactString(v)
+		}
+		// []byte fields such as caBundle are base64 encoded in JSON.
+		if decoded, err := base64.StdEncoding.DecodeString(v); err == nil && strings.Contains(string(decoded), pemBeginMarker) {
+			return RedactString(string(decoded))
+		}
+	}
+	return value
+}
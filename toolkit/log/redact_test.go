@@ -0,0 +1,110 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Redact", func() {
+	var (
+		keyPem      string
+		fingerprint string
+	)
+
+	BeforeEach(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).To(BeNil())
+		der, err := x509.MarshalECPrivateKey(key)
+		Expect(err).To(BeNil())
+		keyPem = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+		sum := sha256.Sum256(der)
+		fingerprint = hex.EncodeToString(sum[:])
+	})
+
+	It("replaces PEM blocks with fingerprints", func() {
+		res := RedactString("key: " + keyPem + " end")
+		Expect(res).To(Equal("key: <redacted EC PRIVATE KEY sha256:" + fingerprint + ">\n end"))
+	})
+
+	It("redacts truncated PEM blocks", func() {
+		res := RedactString("key: " + keyPem[:60])
+		Expect(res).To(Equal("key: <redacted EC PRIVATE KEY>"))
+	})
+
+	It("summarizes secrets at every level", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "kube-system"},
+			Data:       map[string][]byte{"caKey.pem": []byte(keyPem), "caCert.pem": []byte("cert")},
+			Type:       corev1.SecretTypeOpaque,
+		}
+		Expect(Redact(secret, true)).To(Equal("Secret kube-system/test (type Opaque, keys: [caCert.pem caKey.pem])"))
+		Expect(Redact(*secret, false)).To(Equal("Secret kube-system/test (type Opaque, keys: [caCert.pem caKey.pem])"))
+	})
+
+	It("summarizes objects and redacts full dumps", func() {
+		webhook := &admissionregistration.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", ResourceVersion: "1"},
+			Webhooks: []admissionregistration.MutatingWebhook{
+				{Name: "test", ClientConfig: admissionregistration.WebhookClientConfig{CABundle: []byte(keyPem)}},
+			},
+		}
+		Expect(Redact(webhook, true)).To(Equal(`MutatingWebhookConfiguration test (resourceVersion "1")`))
+		dump := Redact(webhook, false)
+		Expect(dump).To(ContainSubstring("sha256:" + fingerprint))
+		Expect(dump).NotTo(ContainSubstring("BEGIN"))
+		dump = Redact(webhook.Webhooks[0], false)
+		Expect(dump).To(ContainSubstring("sha256:" + fingerprint))
+	})
+
+	It("keeps other arguments", func() {
+		err := errors.New("test")
+		Expect(Redact(err, true)).To(BeIdenticalTo(err))
+		Expect(Redact(3, true)).To(Equal(3))
+		Expect(Redact(errors.New(keyPem), true)).To(ContainSubstring(fingerprint))
+		Expect(Redact(struct{ Key string }{keyPem}, true)).NotTo(ContainSubstring("BEGIN"))
+	})
+
+	It("redacts key material nested in other values", func() {
+		type keyPair struct {
+			Name string
+			data map[string][]byte
+		}
+		type wrapper struct {
+			Pairs []*keyPair
+			Extra interface{}
+		}
+		arg := wrapper{Pairs: []*keyPair{{Name: "ca", data: map[string][]byte{"key.pem": []byte(keyPem)}}}, Extra: 3}
+
+		res := Redact(arg, true)
+
+		Expect(res).To(Equal("{Pairs:[&{Name:ca data:map[key.pem:<redacted EC PRIVATE KEY sha256:" + fingerprint + ">\n]}] Extra:3}"))
+		Expect(Redact(map[string]interface{}{"pair": &arg}, true)).To(ContainSubstring("sha256:" + fingerprint))
+		plain := wrapper{Pairs: []*keyPair{{Name: "ca", data: map[string][]byte{"key.pem": []byte("none")}}}}
+		Expect(Redact(plain, true)).To(Equal(plain))
+	})
+
+	It("redacts logged arguments", func() {
+		buf := &bytes.Buffer{}
+		logger, _ := New(Options{Level: DebugLevel, Output: buf})
+		ctx := logger.WithLogger(context.Background())
+		logger.Infof(ctx, "caBundle: %s", []byte(keyPem))
+		logger.Debugf(ctx, "caBundle: %s", keyPem)
+		logger.Error(ctx, keyPem)
+		Expect(buf.String()).NotTo(ContainSubstring("BEGIN"))
+		Expect(buf.String()).To(ContainSubstring(fingerprint))
+	})
+})
@@ -0,0 +1,146 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	tracerName = "github.com/Azure/webhook-tls-manager"
+
+	tracesExporterEnv     = "OTEL_TRACES_EXPORTER"
+	otlpEndpointEnv       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpTracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	otlpProtocolEnv       = "OTEL_EXPORTER_OTLP_PROTOCOL"
+	otlpTracesProtocolEnv = "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"
+)
+
+// ShutdownFunc flushes and stops the tracer provider.
+type ShutdownFunc func(ctx context.Context) error
+
+// InitTracerProvider configures the global tracer provider from the standard OTEL_* environment
+// variables. OTEL_TRACES_EXPORTER selects the exporters ("otlp", "console", "none"), and
+// defaults to "otlp" only when an OTLP endpoint is configured, so a job without a collector
+// does not spend its shutdown on failed exports. The OTLP protocol ("grpc" or "http/protobuf")
+// comes from OTEL_EXPORTER_OTLP_TRACES_PROTOCOL or OTEL_EXPORTER_OTLP_PROTOCOL; endpoint,
+// headers, sampler and resource attributes are read by the SDK itself.
+func InitTracerProvider(ctx context.Context, serviceName string) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporterNames := os.Getenv(tracesExporterEnv)
+	if exporterNames == "" {
+		exporterNames = "none"
+		if os.Getenv(otlpEndpointEnv) != "" || os.Getenv(otlpTracesEndpointEnv) != "" {
+			exporterNames = "otlp"
+		}
+	}
+
+	exporters, err := newExporters(ctx, exporterNames, newExporter)
+	if err != nil {
+		return nil, err
+	}
+	if len(exporters) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		shutdownExporters(ctx, exporters)
+		return nil, err
+	}
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	for _, exporter := range exporters {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newExporters creates the exporters of the comma-separated names with build. If one cannot be
+// created, those already created are shut down, so their connections are not leaked.
+func newExporters(ctx context.Context, names string, build func(ctx context.Context, name string) (sdktrace.SpanExporter, error)) ([]sdktrace.SpanExporter, error) {
+	var exporters []sdktrace.SpanExporter
+	for _, name := range strings.Split(names, ",") {
+		exporter, err := build(ctx, strings.TrimSpace(name))
+		if err != nil {
+			shutdownExporters(ctx, exporters)
+			return nil, err
+		}
+		if exporter != nil {
+			exporters = append(exporters, exporter)
+		}
+	}
+	return exporters, nil
+}
+
+// newExporter creates the exporter named name, or returns nil for "none".
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "none":
+		return nil, nil
+	case "otlp":
+		return newOtlpExporter(ctx)
+	case "console":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unsupported %s %q", tracesExporterEnv, name)
+	}
+}
+
+// shutdownExporters shuts down exporters no tracer provider took over.
+func shutdownExporters(ctx context.Context, exporters []sdktrace.SpanExporter) {
+	for _, exporter := range exporters {
+		_ = exporter.Shutdown(ctx)
+	}
+}
+
+func newOtlpExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	protocol := os.Getenv(otlpTracesProtocolEnv)
+	if protocol == "" {
+		protocol = os.Getenv(otlpProtocolEnv)
+	}
+	switch protocol {
+	case "grpc":
+		return otlptracegrpc.New(ctx)
+	case "", "http/protobuf":
+		return otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+	}
+}
+
+// ContextWithTraceParent returns a context whose spans are children of the W3C traceparent,
+// e.g. the TRACEPARENT environment variable set by a deploy pipeline. An empty or invalid
+// traceparent leaves the context unchanged.
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{"traceparent": traceParent}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// StartSpan starts a span named name as a child of the span in ctx. The returned context
+// carries the new span, so loggers called with it log the span and trace IDs.
+func StartSpan(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name)
+	s := &otelSpan{span: span}
+	s.SetAttributes(attributes)
+	return ctx, s
+}
@@ -0,0 +1,114 @@
+package retrypolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+// Class is the kind of failure an error represents, which decides whether and when it is retried.
+type Class string
+
+const (
+	// Transient covers network errors, timeouts and server errors. Retried with backoff.
+	Transient Class = "transient"
+	// Conflict covers optimistic concurrency failures. Retried after the initial interval.
+	Conflict Class = "conflict"
+	// Throttled covers errors for which the API server asked the client to slow down.
+	// Retried after the longer of the backoff and the suggested Retry-After delay.
+	Throttled Class = "throttled"
+	// Permanent covers errors that will not go away by retrying, such as a missing or invalid
+	// ConfigMap, a missing permission or a cancelled context.
+	Permanent Class = "permanent"
+	// Crypto covers errors of the certificate toolkit. Retried only if the toolkit marked them
+	// retriable.
+	Crypto Class = "crypto"
+)
+
+// Classification is the result of Classify.
+type Classification struct {
+	Class     Class
+	Retriable bool
+	// RetryAfter is the delay suggested by the API server, if any.
+	RetryAfter time.Duration
+}
+
+// permanent is implemented by errors that know they cannot be retried.
+type permanent interface {
+	Permanent() bool
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string   { return e.err.Error() }
+func (e *permanentError) Unwrap() error   { return e.err }
+func (e *permanentError) Permanent() bool { return true }
+
+// NewPermanentError marks err as not retriable, e.g. a configuration error detected locally.
+func NewPermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// CryptoError is an error of the certificate toolkit. Retriable is copied from the retry.Error
+// the toolkit returned, e.g. a failed key generation is retriable, an invalid request is not.
+type CryptoError struct {
+	Retriable bool
+	Err       error
+}
+
+func (e *CryptoError) Error() string { return e.Err.Error() }
+func (e *CryptoError) Unwrap() error { return e.Err }
+
+// NewCryptoError converts a retry.Error returned by the certificate toolkit.
+func NewCryptoError(rerr *retry.Error) error {
+	if rerr == nil {
+		return nil
+	}
+	err := rerr.RawError
+	if err == nil {
+		err = fmt.Errorf("certificate toolkit error")
+	}
+	return &CryptoError{Retriable: rerr.Retriable, Err: err}
+}
+
+// Classify returns the class of err. Errors that are not recognised are transient.
+func Classify(err error) Classification {
+	if err == nil {
+		return Classification{Class: Transient, Retriable: false}
+	}
+
+	var cryptoErr *CryptoError
+	if errors.As(err, &cryptoErr) {
+		return Classification{Class: Crypto, Retriable: cryptoErr.Retriable}
+	}
+	var p permanent
+	if errors.As(err, &p) && p.Permanent() {
+		return Classification{Class: Permanent}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return Classification{Class: Permanent}
+	}
+
+	switch {
+	case k8serrors.IsConflict(err), k8serrors.IsAlreadyExists(err):
+		return Classification{Class: Conflict, Retriable: true}
+	case k8serrors.IsNotFound(err), k8serrors.IsForbidden(err), k8serrors.IsUnauthorized(err),
+		k8serrors.IsInvalid(err), k8serrors.IsBadRequest(err), k8serrors.IsMethodNotSupported(err),
+		k8serrors.IsNotAcceptable(err), k8serrors.IsUnsupportedMediaType(err), k8serrors.IsGone(err),
+		k8serrors.IsRequestEntityTooLargeError(err):
+		return Classification{Class: Permanent}
+	}
+	if delay, ok := k8serrors.SuggestsClientDelay(err); ok || k8serrors.IsTooManyRequests(err) {
+		return Classification{Class: Throttled, Retriable: true, RetryAfter: time.Duration(delay) * time.Second}
+	}
+	return Classification{Class: Transient, Retriable: true}
+}
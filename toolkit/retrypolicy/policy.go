@@ -0,0 +1,86 @@
+package retrypolicy
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts     = 10
+	DefaultDeadline        = time.Minute
+	DefaultInitialInterval = time.Second
+	DefaultMaxInterval     = 15 * time.Second
+	DefaultMultiplier      = 2.0
+	DefaultJitter          = 0.2
+)
+
+// Policy is an exponential backoff with jitter, bounded by a number of attempts and a deadline
+// measured from the first attempt.
+type Policy struct {
+	MaxAttempts     int
+	Deadline        time.Duration
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// Jitter spreads every delay uniformly over +/- Jitter of its value.
+	Jitter float64
+}
+
+// DefaultPolicy returns the policy used by the reconciler unless configured otherwise.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:     DefaultMaxAttempts,
+		Deadline:        DefaultDeadline,
+		InitialInterval: DefaultInitialInterval,
+		MaxInterval:     DefaultMaxInterval,
+		Multiplier:      DefaultMultiplier,
+		Jitter:          DefaultJitter,
+	}
+}
+
+// Backoff returns the delay after the given failed attempt, counting from 1, before jitter.
+func (p Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && backoff > float64(p.MaxInterval) {
+		return p.MaxInterval
+	}
+	return time.Duration(backoff)
+}
+
+// Delay returns how long to wait after the given failed attempt. Conflicts are retried after
+// the initial interval, throttled errors after at least the delay the API server asked for.
+func (p Policy) Delay(attempt int, c Classification) time.Duration {
+	delay := p.Backoff(attempt)
+	if c.Class == Conflict {
+		delay = p.InitialInterval
+	}
+	delay = p.jitter(delay)
+	if c.RetryAfter > delay {
+		delay = c.RetryAfter
+	}
+	return delay
+}
+
+func (p Policy) jitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+}
+
+// Wait waits for d, or returns the context error as soon as ctx is done.
+func Wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
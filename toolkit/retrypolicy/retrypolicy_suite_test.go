@@ -0,0 +1,13 @@
+package retrypolicy
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RetryPolicy Suite")
+}
@@ -0,0 +1,102 @@
+package retrypolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/legacy-cloud-providers/azure/retry"
+)
+
+var _ = Describe("Classify", func() {
+	resource := corev1.Resource("secrets")
+
+	It("classifies Kubernetes API errors", func() {
+		for err, class := range map[error]Class{
+			k8serrors.NewConflict(resource, "name", errors.New("conflict")):           Conflict,
+			k8serrors.NewAlreadyExists(resource, "name"):                              Conflict,
+			k8serrors.NewNotFound(resource, "name"):                                   Permanent,
+			k8serrors.NewForbidden(resource, "name", errors.New("forbidden")):         Permanent,
+			k8serrors.NewUnauthorized("unauthorized"):                                 Permanent,
+			k8serrors.NewBadRequest("bad request"):                                    Permanent,
+			k8serrors.NewTooManyRequests("slow down", 3):                              Throttled,
+			k8serrors.NewServerTimeout(resource, "get", 2):                            Throttled,
+			k8serrors.NewInternalError(errors.New("internal")):                        Transient,
+			fmt.Errorf("wrapped: %w", k8serrors.NewNotFound(resource, "name")):        Permanent,
+			errors.New("connection refused"):                                          Transient,
+			NewPermanentError(errors.New("mutatingWebhookConfig is empty")):           Permanent,
+			fmt.Errorf("reconcile: %w", context.Canceled):                             Permanent,
+			NewCryptoError(retry.NewError(true, errors.New("key generation failed"))): Crypto,
+			NewCryptoError(retry.NewError(false, errors.New("invalid request"))):      Crypto,
+		} {
+			Expect(Classify(err).Class).To(Equal(class), err.Error())
+			if class != Crypto {
+				Expect(Classify(err).Retriable).To(Equal(class != Permanent), err.Error())
+			}
+		}
+	})
+
+	It("honours the crypto retriable flag", func() {
+		Expect(Classify(NewCryptoError(retry.NewError(true, errors.New("retriable")))).Retriable).To(BeTrue())
+		Expect(Classify(NewCryptoError(retry.NewError(false, errors.New("not retriable")))).Retriable).To(BeFalse())
+	})
+
+	It("reads Retry-After", func() {
+		Expect(Classify(k8serrors.NewTooManyRequests("slow down", 3)).RetryAfter).To(Equal(3 * time.Second))
+	})
+
+	It("keeps the wrapped errors", func() {
+		raw := errors.New("raw")
+		Expect(errors.Is(NewPermanentError(raw), raw)).To(BeTrue())
+		Expect(errors.Is(NewCryptoError(retry.NewError(false, raw)), raw)).To(BeTrue())
+		Expect(NewPermanentError(nil)).To(BeNil())
+		Expect(NewCryptoError(nil)).To(BeNil())
+	})
+})
+
+var _ = Describe("Policy", func() {
+	policy := Policy{
+		MaxAttempts:     5,
+		Deadline:        time.Minute,
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2,
+	}
+
+	It("backs off exponentially up to the max interval", func() {
+		Expect(policy.Backoff(1)).To(Equal(time.Second))
+		Expect(policy.Backoff(2)).To(Equal(2 * time.Second))
+		Expect(policy.Backoff(3)).To(Equal(4 * time.Second))
+		Expect(policy.Backoff(4)).To(Equal(5 * time.Second))
+	})
+
+	It("retries conflicts after the initial interval", func() {
+		Expect(policy.Delay(4, Classification{Class: Conflict, Retriable: true})).To(Equal(time.Second))
+	})
+
+	It("waits at least as long as the server asked", func() {
+		Expect(policy.Delay(1, Classification{Class: Throttled, Retriable: true, RetryAfter: 10 * time.Second})).To(Equal(10 * time.Second))
+	})
+
+	It("adds jitter", func() {
+		jittered := policy
+		jittered.Jitter = 0.5
+		for i := 0; i < 100; i++ {
+			delay := jittered.Delay(2, Classification{Class: Transient, Retriable: true})
+			Expect(delay).To(BeNumerically(">=", time.Second))
+			Expect(delay).To(BeNumerically("<=", 3*time.Second))
+		}
+	})
+
+	It("stops waiting when the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(Wait(ctx, time.Minute)).To(Equal(context.Canceled))
+		Expect(Wait(context.Background(), time.Millisecond)).To(BeNil())
+	})
+})
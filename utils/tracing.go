@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/webhook-tls-manager/toolkit/log"
+)
+
+// tracingRoundTripper creates a span for every request sent to the Kubernetes API server.
+type tracingRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t *tracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := log.StartSpan(req.Context(), "kubernetes.api "+req.Method+" "+apiResource(req.URL.Path), map[string]interface{}{
+		"http.method": req.Method,
+		"url.path":    req.URL.Path,
+	})
+	defer span.End()
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		span.SetStatus(err)
+		return nil, err
+	}
+	span.SetAttributes(map[string]interface{}{"http.status_code": resp.StatusCode})
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(fmt.Errorf("kubernetes api returned %s", resp.Status))
+	} else {
+		span.SetStatus(nil)
+	}
+	return resp, nil
+}
+
+// apiResource extracts the resource type from an API path such as
+// /api/v1/namespaces/kube-system/secrets/name or /apis/group/version/resource/name,
+// keeping span names low-cardinality.
+func apiResource(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return path
+	}
+	if len(parts) > 2 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+	if len(parts) == 0 {
+		return path
+	}
+	return parts[0]
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAPIResource(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/namespaces/kube-system/secrets/webhook-tls-manager-tls-certs", "secrets"},
+		{"/api/v1/namespaces/kube-system/secrets", "secrets"},
+		{"/api/v1/namespaces/kube-system", "namespaces"},
+		{"/api/v1/namespaces", "namespaces"},
+		{"/apis/admissionregistration.k8s.io/v1/mutatingwebhookconfigurations/vpa-webhook-config", "mutatingwebhookconfigurations"},
+		{"/apis/discovery.k8s.io/v1/namespaces/kube-system/endpointslices", "endpointslices"},
+		{"/api/v1", "/api/v1"},
+		{"/apis/admissionregistration.k8s.io/v1", "/apis/admissionregistration.k8s.io/v1"},
+		{"/version", "/version"},
+		{"/", "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := apiResource(tt.path); got != tt.want {
+				t.Errorf("apiResource(%q) = %q, expected %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracingRoundTripper(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		status     int
+		err        error
+		wantName   string
+		wantCode   codes.Code
+		wantStatus bool
+	}{
+		{"success", http.MethodGet, "/api/v1/namespaces/kube-system/secrets/tls", http.StatusOK, nil,
+			"kubernetes.api GET secrets", codes.Ok, true},
+		{"error status", http.MethodPatch, "/apis/admissionregistration.k8s.io/v1/mutatingwebhookconfigurations/vpa", http.StatusConflict, nil,
+			"kubernetes.api PATCH mutatingwebhookconfigurations", codes.Error, true},
+		{"transport error", http.MethodPost, "/api/v1/namespaces/default/events", 0, errors.New("connection refused"),
+			"kubernetes.api POST events", codes.Error, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				recorded := httptest.NewRecorder()
+				recorded.WriteHeader(tt.status)
+				return recorded.Result(), nil
+			})
+			req := httptest.NewRequest(tt.method, "https://kubernetes.default.svc"+tt.path, nil)
+			before := len(recorder.Ended())
+
+			resp, err := (&tracingRoundTripper{next: next}).RoundTrip(req)
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			ended := recorder.Ended()
+			if len(ended) != before+1 {
+				t.Fatalf("expected one span, got %d", len(ended)-before)
+			}
+			span := ended[len(ended)-1]
+			if span.Name() != tt.wantName {
+				t.Errorf("expected span name %q, got %q", tt.wantName, span.Name())
+			}
+			if span.Status().Code != tt.wantCode {
+				t.Errorf("expected status %s, got %s", tt.wantCode, span.Status().Code)
+			}
+			attributes := map[attribute.Key]attribute.Value{}
+			for _, kv := range span.Attributes() {
+				attributes[kv.Key] = kv.Value
+			}
+			if got := attributes["http.method"].AsString(); got != tt.method {
+				t.Errorf("expected http.method %s, got %s", tt.method, got)
+			}
+			if got := attributes["url.path"].AsString(); got != tt.path {
+				t.Errorf("expected url.path %s, got %s", tt.path, got)
+			}
+			statusCode, ok := attributes["http.status_code"]
+			if ok != tt.wantStatus || ok && statusCode.AsInt64() != int64(tt.status) {
+				t.Errorf("expected http.status_code %d (set: %t), got %v (set: %t)", tt.status, tt.wantStatus, statusCode.AsInt64(), ok)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"net/http"
+
 	"k8s.io/autoscaler/vertical-pod-autoscaler/common"
 	"k8s.io/client-go/kubernetes"
 )
@@ -13,6 +15,9 @@ const (
 
 func GetKubeClient() kubernetes.Interface {
 	config := common.CreateKubeConfigOrDie(kubeconfig, float32(kubeApiQps), int(kubeApiBurst))
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &tracingRoundTripper{next: rt}
+	})
 	kubeClient := kubernetes.NewForConfigOrDie(config)
 	var clientInterface kubernetes.Interface = kubeClient
 	return clientInterface